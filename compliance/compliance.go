@@ -0,0 +1,214 @@
+// Package compliance evaluates declarative policies against the rules of
+// every node. Policies are written with the same filter language used for
+// queries, see rulehandler.Parse. A policy whose filters are wrapped in asof
+// is checked against the rules of every node as they were at that time.
+package compliance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Neffats/wherecp/core"
+	"github.com/Neffats/wherecp/handlers/rule"
+	"github.com/Neffats/wherecp/simulate"
+)
+
+var (
+	ErrNoCondition = errors.New("policy needs either a forbid or a require filter")
+)
+
+type filter func(*core.Rule) (bool, error)
+
+// Policy is a single compliance check.
+//
+// A rule violates the policy when it is in scope, isn't excepted and either
+// matches the Forbid filter or doesn't match the Require filter. For example:
+//
+//	{
+//	  "name": "no-rdp-from-any",
+//	  "forbid": "(and (action \"permit\") (contains \"0.0.0.0/0\" in src) (contains \"tcp/3389\"))"
+//	}
+//
+// Use overlaps rather than contains to catch rules that reach only part of a
+// range, i.e. (overlaps "10.0.0.0/8" in dst) matches a rule to 10.1.0.0/16.
+type Policy struct {
+	ID          string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Severity    string `json:"severity,omitempty"`
+	// Scope selects the rules the policy applies to, every rule if empty.
+	Scope string `json:"scope,omitempty"`
+	// Forbid matches rules that violate the policy.
+	Forbid string `json:"forbid,omitempty"`
+	// Require matches rules that comply with the policy.
+	Require string `json:"require,omitempty"`
+	// Except matches rules that are exempt from the policy.
+	Except string `json:"except,omitempty"`
+
+	scope   filter
+	forbid  filter
+	require filter
+	except  filter
+	// asOf is the time set by the filters' asof keywords, zero if none.
+	asOf time.Time
+}
+
+// Config is a set of policies, usually loaded from a file.
+type Config struct {
+	Policies []*Policy `json:"policies"`
+}
+
+// Load reads and compiles the policies in a JSON config file.
+func Load(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open compliance config: %v", err)
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Read reads and compiles the policies from a JSON config.
+func Read(r io.Reader) (*Config, error) {
+	var c Config
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return nil, fmt.Errorf("failed to decode compliance config: %v", err)
+	}
+	for _, p := range c.Policies {
+		if err := p.Compile(); err != nil {
+			return nil, fmt.Errorf("invalid policy %q: %v", p.ID, err)
+		}
+	}
+	return &c, nil
+}
+
+// Compile parses the policy's filters. It must be called before Check when
+// a policy isn't created by Load or Read.
+func (p *Policy) Compile() error {
+	if p.Forbid == "" && p.Require == "" {
+		return ErrNoCondition
+	}
+	p.asOf = time.Time{}
+	var err error
+	if p.scope, err = p.compile(p.Scope); err != nil {
+		return fmt.Errorf("failed to parse scope: %v", err)
+	}
+	if p.forbid, err = p.compile(p.Forbid); err != nil {
+		return fmt.Errorf("failed to parse forbid: %v", err)
+	}
+	if p.require, err = p.compile(p.Require); err != nil {
+		return fmt.Errorf("failed to parse require: %v", err)
+	}
+	if p.except, err = p.compile(p.Except); err != nil {
+		return fmt.Errorf("failed to parse except: %v", err)
+	}
+	return nil
+}
+
+// compile parses a single filter, taking the policy's time from its asof
+// keyword. Every filter of a policy with an asof must be for the same time.
+func (p *Policy) compile(expr string) (filter, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	q, err := rulehandler.ParseQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	if !q.AsOf.IsZero() {
+		if !p.asOf.IsZero() && !p.asOf.Equal(q.AsOf) {
+			return nil, fmt.Errorf("asof %s differs from the policy's other filters", q.AsOf.Format(time.RFC3339))
+		}
+		p.asOf = q.AsOf
+	}
+	return filter(q.Filter), nil
+}
+
+// AsOf returns the time the policy's rules are taken from, zero for the
+// current rules.
+func (p *Policy) AsOf() time.Time {
+	return p.asOf
+}
+
+// Name satisfies the simulate.Check interface.
+func (p *Policy) Name() string {
+	return p.ID
+}
+
+// Check returns a violation for every rule that breaks the policy.
+// Satisfies the simulate.Check interface, so policies can be run against
+// proposed changes as well. The rules are checked as given, even if the
+// policy has an asof time.
+func (p *Policy) Check(rules []*core.Rule) ([]simulate.Violation, error) {
+	if p.forbid == nil && p.require == nil {
+		return nil, fmt.Errorf("policy %q hasn't been compiled", p.ID)
+	}
+	result := make([]simulate.Violation, 0)
+	for _, r := range rules {
+		failed, err := p.violatedBy(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check rule %d: %v", r.Number(), err)
+		}
+		if !failed {
+			continue
+		}
+		result = append(result, simulate.Violation{
+			Check:    p.ID,
+			Severity: p.Severity,
+			Rule:     simulate.RuleRef{UID: r.UID(), Name: r.Name(), Number: r.Number()},
+			Message:  p.message(),
+		})
+	}
+	return result, nil
+}
+
+func (p *Policy) violatedBy(r *core.Rule) (bool, error) {
+	if p.scope != nil {
+		inScope, err := p.scope(r)
+		if err != nil || !inScope {
+			return false, err
+		}
+	}
+	if p.except != nil {
+		excepted, err := p.except(r)
+		if err != nil || excepted {
+			return false, err
+		}
+	}
+	if p.forbid != nil {
+		forbidden, err := p.forbid(r)
+		if err != nil || forbidden {
+			return forbidden, err
+		}
+	}
+	if p.require != nil {
+		required, err := p.require(r)
+		if err != nil {
+			return false, err
+		}
+		return !required, nil
+	}
+	return false, nil
+}
+
+func (p *Policy) message() string {
+	if p.Description != "" {
+		return p.Description
+	}
+	if p.Forbid != "" {
+		return fmt.Sprintf("rule matches forbidden filter: %s", p.Forbid)
+	}
+	return fmt.Sprintf("rule doesn't match required filter: %s", p.Require)
+}
+
+// Checks returns the policies as simulate checks.
+func (c *Config) Checks() []simulate.Check {
+	result := make([]simulate.Check, 0, len(c.Policies))
+	for _, p := range c.Policies {
+		result = append(result, p)
+	}
+	return result
+}
@@ -0,0 +1,240 @@
+package compliance
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Neffats/wherecp/core"
+	"github.com/Neffats/wherecp/node"
+	rulestore "github.com/Neffats/wherecp/store/rule"
+)
+
+type testPuller struct{}
+
+func (tp *testPuller) PullRules() ([]*core.Rule, error) {
+	return make([]*core.Rule, 0), nil
+}
+
+func network(t *testing.T, name, addr, mask string) *core.Group {
+	t.Helper()
+	n, err := core.NewNetwork(name, addr, mask, "")
+	if err != nil {
+		t.Fatalf("failed to create network: %v", err)
+	}
+	grp := core.NewGroup(name, "")
+	if err := grp.Add(n); err != nil {
+		t.Fatalf("failed to add network to group: %v", err)
+	}
+	return grp
+}
+
+func service(t *testing.T, name string, port uint) *core.PortGroup {
+	t.Helper()
+	p, err := core.NewPort(name, port, "tcp", "")
+	if err != nil {
+		t.Fatalf("failed to create port: %v", err)
+	}
+	pg := core.NewPortGroup(name, "")
+	if err := pg.Add(p); err != nil {
+		t.Fatalf("failed to add port to group: %v", err)
+	}
+	return pg
+}
+
+const config = `{
+  "policies": [
+    {
+      "name": "no-rdp-from-any",
+      "severity": "high",
+      "forbid": "(and (action \"permit\") (contains \"0.0.0.0/0\" in src) (contains \"tcp/3389\"))"
+    },
+    {
+      "name": "commented",
+      "description": "every rule must have a comment",
+      "require": "(not (comment \"\"))"
+    },
+    {
+      "name": "no-internal-from-any",
+      "scope": "(action \"permit\")",
+      "forbid": "(and (contains \"0.0.0.0/0\" in src) (contains \"10.0.0.0/8\" in dst))",
+      "except": "(has \"jump\" in dst)"
+    }
+  ]
+}`
+
+func TestEvaluate(t *testing.T) {
+	any := network(t, "any", "0.0.0.0", "0.0.0.0")
+	internal := network(t, "internal", "10.0.0.0", "255.0.0.0")
+	jump := network(t, "jump", "10.0.0.0", "255.0.0.0")
+	rdp := service(t, "rdp", 3389)
+	web := service(t, "web", 443)
+
+	// Rule numbers aren't contiguous, the report must use them rather than
+	// the position of the rules.
+	rdpFromAny := core.NewNamedRule("rdp-from-any", 10, any, internal, rdp, true, "Change 1")
+	jumpHost := core.NewNamedRule("jump-host", 20, any, jump, web, true, "Change 2")
+	uncommented := core.NewNamedRule("uncommented", 30, any, any, web, false, "")
+
+	edge := rulestore.New(&testPuller{})
+	edge.Rules = []*core.Rule{uncommented, jumpHost, rdpFromAny}
+	inner := rulestore.New(&testPuller{})
+	inner.Rules = []*core.Rule{jumpHost}
+
+	cfg, err := Read(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+
+	report, err := cfg.Evaluate(map[string]*node.Node{
+		"edge": {Rules: edge},
+		"core": {Rules: inner},
+	})
+	if err != nil {
+		t.Fatalf("got error when not expected: %v", err)
+	}
+
+	if len(report.Nodes) != 2 || report.Nodes[0].Node != "core" || report.Nodes[1].Node != "edge" {
+		t.Fatalf("expected results for core and edge, got: %+v", report.Nodes)
+	}
+	if !report.Nodes[0].Passed() || report.Nodes[0].Checked != 1 {
+		t.Fatalf("expected core to pass, got: %+v", report.Nodes[0])
+	}
+
+	got := report.Nodes[1]
+	if got.Passed() || got.Checked != 3 || len(got.Rules) != 2 {
+		t.Fatalf("expected two failing rules on edge, got: %+v", got)
+	}
+	first := got.Rules[0]
+	if first.Rule.Name != "rdp-from-any" || first.Rule.Number != 10 || len(first.Violations) != 2 {
+		t.Fatalf("expected rdp-from-any to fail two policies, got: %+v", first)
+	}
+	if first.Violations[0].Check != "no-rdp-from-any" || first.Violations[0].Severity != "high" ||
+		first.Violations[1].Check != "no-internal-from-any" {
+		t.Fatalf("unexpected violations for rdp-from-any: %+v", first.Violations)
+	}
+	second := got.Rules[1]
+	if second.Rule.Name != "uncommented" || second.Rule.Number != 30 || len(second.Violations) != 1 ||
+		second.Violations[0].Message != "every rule must have a comment" {
+		t.Fatalf("expected uncommented to fail the comment policy, got: %+v", second)
+	}
+
+	if report.Passed() || report.Violations() != 3 {
+		t.Fatalf("expected 3 violations in report, got: %d", report.Violations())
+	}
+}
+
+func TestEvaluateOverlaps(t *testing.T) {
+	any := network(t, "any", "0.0.0.0", "0.0.0.0")
+	web := service(t, "web", 443)
+	untrust := core.NewZone("untrust", "")
+
+	// Neither rule covers the whole of 10.0.0.0/8, but the first opens part
+	// of it from untrust.
+	narrow := core.NewNamedRule("narrow", 10, any, network(t, "branch", "10.1.0.0", "255.255.0.0"), web, true, "Change 1")
+	narrow.AddFromZone(untrust)
+	outside := core.NewNamedRule("outside", 20, any, network(t, "dmz", "172.16.0.0", "255.255.0.0"), web, true, "Change 2")
+	outside.AddFromZone(untrust)
+
+	store := rulestore.New(&testPuller{})
+	store.Rules = []*core.Rule{narrow, outside}
+
+	cfg, err := Read(strings.NewReader(`{"policies": [
+		{"name": "no-internal-from-untrust", "scope": "(action \"permit\")",
+		 "forbid": "(and (zone \"untrust\" in src) (overlaps \"10.0.0.0/8\" in dst))"}
+	]}`))
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	report, err := cfg.Evaluate(map[string]*node.Node{"edge": {Rules: store}})
+	if err != nil {
+		t.Fatalf("got error when not expected: %v", err)
+	}
+	got := report.Nodes[0]
+	if len(got.Rules) != 1 || got.Rules[0].Rule.Name != "narrow" {
+		t.Fatalf("expected only narrow to be flagged, got: %+v", got.Rules)
+	}
+}
+
+func TestEvaluateAsOf(t *testing.T) {
+	any := network(t, "any", "0.0.0.0", "0.0.0.0")
+	rdp := service(t, "rdp", 3389)
+
+	// The rule permitted rdp from any in March and was fixed since.
+	store := rulestore.New(&testPuller{})
+	march := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	opened := core.NewNamedRule("rdp", 10, any, any, rdp, true, "Change 1")
+	if _, err := store.Record(march, []*core.Rule{opened}); err != nil {
+		t.Fatalf("failed to record snapshot: %v", err)
+	}
+	store.Rules = []*core.Rule{opened.WithAction(false)}
+
+	cfg, err := Read(strings.NewReader(`{"policies": [
+		{"name": "no-rdp", "forbid": "(asof \"2024-03-02T00:00:00Z\" (and (action \"permit\") (contains \"tcp/3389\")))"},
+		{"name": "now", "forbid": "(and (action \"permit\") (contains \"tcp/3389\"))"}
+	]}`))
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	if got := cfg.Policies[0].AsOf(); !got.Equal(march.Add(24 * time.Hour)) {
+		t.Fatalf("unexpected policy time: %s", got)
+	}
+
+	report, err := cfg.Evaluate(map[string]*node.Node{"edge": {Rules: store}})
+	if err != nil {
+		t.Fatalf("got error when not expected: %v", err)
+	}
+	got := report.Nodes[0]
+	if got.Checked != 1 || len(got.Rules) != 1 || len(got.Rules[0].Violations) != 1 ||
+		got.Rules[0].Violations[0].Check != "no-rdp" {
+		t.Fatalf("expected only the asof policy to fail, got: %+v", got)
+	}
+
+	// Before any snapshot there is nothing to check against.
+	cfg, err = Read(strings.NewReader(`{"policies": [
+		{"name": "no-rdp", "forbid": "(asof \"2024-01-01T00:00:00Z\" (action \"permit\"))"}
+	]}`))
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	if _, err := cfg.Evaluate(map[string]*node.Node{"edge": {Rules: store}}); err == nil {
+		t.Fatalf("expected error without a snapshot")
+	}
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{
+			name:   "No condition",
+			config: `{"policies": [{"name": "empty", "scope": "(action \"permit\")"}]}`,
+		},
+		{
+			name:   "Invalid filter",
+			config: `{"policies": [{"name": "bad", "forbid": "(action \"maybe\")"}]}`,
+		},
+		{
+			name:   "Different asof times",
+			config: `{"policies": [{"name": "mixed", "scope": "(asof \"2024-03-01T00:00:00Z\" (action \"permit\"))", "forbid": "(asof \"2024-04-01T00:00:00Z\" (comment \"\"))"}]}`,
+		},
+		{
+			name:   "Trailing input",
+			config: `{"policies": [{"name": "trailing", "forbid": "(action \"permit\") (comment \"\")"}]}`,
+		},
+		{
+			name:   "Invalid json",
+			config: `{"policies": [`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(tc.config))
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package compliance
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Neffats/wherecp/core"
+	"github.com/Neffats/wherecp/node"
+	"github.com/Neffats/wherecp/simulate"
+)
+
+// RuleResult holds every policy a single rule violates.
+type RuleResult struct {
+	Rule       simulate.RuleRef     `json:"rule"`
+	Violations []simulate.Violation `json:"violations"`
+}
+
+// NodeResult holds the outcome of the policies on a single node.
+type NodeResult struct {
+	Node string `json:"node"`
+	// Checked is the number of rules the policies were evaluated against.
+	Checked int `json:"checked"`
+	// Rules lists only the rules with at least one violation, in policy order.
+	Rules []RuleResult `json:"rules"`
+}
+
+// Passed returns true if no rule on the node violates a policy.
+func (nr NodeResult) Passed() bool {
+	return len(nr.Rules) == 0
+}
+
+// Report is the outcome of the policies on every node.
+type Report struct {
+	Nodes []NodeResult `json:"nodes"`
+}
+
+// history is satisfied by rule stores that keep a snapshot of every pull,
+// i.e. rulestore.RuleStore.
+type history interface {
+	AsOf(t time.Time) ([]*core.Rule, error)
+}
+
+// Evaluate runs every policy against the rules of every node. Policies with
+// an asof time are run against the node's rules as they were at that time,
+// which needs a rule store that keeps a history.
+func (c *Config) Evaluate(nodes map[string]*node.Node) (*Report, error) {
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	report := &Report{Nodes: make([]NodeResult, 0, len(names))}
+	for _, name := range names {
+		n := nodes[name]
+		if n == nil || n.Rules == nil {
+			continue
+		}
+		asOf := func(t time.Time) ([]*core.Rule, error) {
+			return nil, fmt.Errorf("rule store doesn't keep a history")
+		}
+		if h, ok := n.Rules.(history); ok {
+			asOf = h.AsOf
+		}
+		result, err := c.evaluate(n.Rules.All(), asOf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate node %s: %v", name, err)
+		}
+		result.Node = name
+		report.Nodes = append(report.Nodes, result)
+	}
+	return report, nil
+}
+
+// EvaluateRules runs every policy against a single set of rules.
+// The rules are evaluated in rule number order. Policies with an asof time
+// are run against the given rules too.
+func (c *Config) EvaluateRules(rules []*core.Rule) (NodeResult, error) {
+	return c.evaluate(rules, nil)
+}
+
+// evaluate runs every policy against the current rules, or the rules asOf
+// returns for the policy's time if it has one and asOf isn't nil.
+func (c *Config) evaluate(current []*core.Rule, asOf func(time.Time) ([]*core.Rule, error)) (NodeResult, error) {
+	checked := make(map[string]bool)
+	for _, r := range current {
+		checked[r.UID()] = true
+	}
+
+	byRule := make(map[string]*RuleResult)
+	for _, p := range c.Policies {
+		rules := current
+		if !p.AsOf().IsZero() && asOf != nil {
+			var err error
+			rules, err = asOf(p.AsOf())
+			if err != nil {
+				return NodeResult{}, fmt.Errorf("failed to get rules as of %s for policy %s: %v", p.AsOf().Format(time.RFC3339), p.ID, err)
+			}
+			for _, r := range rules {
+				checked[r.UID()] = true
+			}
+		}
+		ordered := make([]*core.Rule, len(rules))
+		copy(ordered, rules)
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return ordered[i].Number() < ordered[j].Number()
+		})
+
+		violations, err := p.Check(ordered)
+		if err != nil {
+			return NodeResult{}, fmt.Errorf("policy %s failed: %v", p.ID, err)
+		}
+		for _, v := range violations {
+			rr, ok := byRule[v.Rule.UID]
+			if !ok {
+				rr = &RuleResult{Rule: v.Rule, Violations: make([]simulate.Violation, 0)}
+				byRule[v.Rule.UID] = rr
+			}
+			rr.Violations = append(rr.Violations, v)
+		}
+	}
+
+	result := NodeResult{Checked: len(checked), Rules: make([]RuleResult, 0, len(byRule))}
+	for _, rr := range byRule {
+		result.Rules = append(result.Rules, *rr)
+	}
+	sort.Slice(result.Rules, func(i, j int) bool {
+		return result.Rules[i].Rule.Number < result.Rules[j].Rule.Number
+	})
+	return result, nil
+}
+
+// Passed returns true if every node passed.
+func (r *Report) Passed() bool {
+	for _, n := range r.Nodes {
+		if !n.Passed() {
+			return false
+		}
+	}
+	return true
+}
+
+// Violations returns the number of violations across every node.
+func (r *Report) Violations() int {
+	count := 0
+	for _, n := range r.Nodes {
+		for _, rr := range n.Rules {
+			count += len(rr.Violations)
+		}
+	}
+	return count
+}
+
+// JSON returns the report as JSON.
+func (r *Report) JSON() ([]byte, error) {
+	out, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal compliance report: %v", err)
+	}
+	return out, nil
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	for _, n := range r.Nodes {
+		if n.Passed() {
+			fmt.Fprintf(&b, "%s: passed (%d rules)\n", n.Node, n.Checked)
+			continue
+		}
+		fmt.Fprintf(&b, "%s: failed (%d of %d rules)\n", n.Node, len(n.Rules), n.Checked)
+		for _, rr := range n.Rules {
+			label := fmt.Sprintf("rule %d", rr.Rule.Number)
+			if rr.Rule.Name != "" {
+				label = fmt.Sprintf("%s (%s)", label, rr.Rule.Name)
+			}
+			for _, v := range rr.Violations {
+				fmt.Fprintf(&b, "  %s: %s: %s\n", label, v.Check, v.Message)
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"github.com/google/uuid"
+)
+
+// Application represents an application identified by a next-gen firewall,
+// i.e. ssl or web-browsing, independently of the ports it runs on. Its
+// default ports are the ones a rule matches when its service is set to the
+// application's default, PAN-OS' application-default.
+type Application struct {
+	uid      string
+	name     string
+	defaults *PortGroup
+	comment  string
+}
+
+// NewApplication returns a pointer to a new Application without any default
+// ports.
+func NewApplication(name, comment string) *Application {
+	uid := uuid.New()
+	return &Application{
+		uid:      uid.String(),
+		name:     name,
+		defaults: NewPortGroup(name, ""),
+		comment:  comment,
+	}
+}
+
+func (a *Application) UID() string {
+	return a.uid
+}
+
+func (a *Application) Name() string {
+	return a.name
+}
+
+func (a *Application) Comment() string {
+	return a.comment
+}
+
+// AddDefault adds a port object to the application's default ports.
+// Supported types: Port/Port Range/Service/Port Group
+func (a *Application) AddDefault(obj interface{}) error {
+	return a.defaults.Add(obj)
+}
+
+// Defaults returns the group of the application's default ports.
+func (a *Application) Defaults() *PortGroup {
+	return a.defaults
+}
+
+// Match will return true if both applications have the same name and
+// default ports.
+func (a *Application) Match(app *Application) bool {
+	return a.name == app.name && a.defaults.MatchContent(app.defaults)
+}
+
+// applicationsInclude returns true if apps is empty (any application) or
+// holds an application called name.
+func applicationsInclude(apps []*Application, name string) bool {
+	if len(apps) == 0 {
+		return true
+	}
+	for _, a := range apps {
+		if a.name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package core
+
+import "testing"
+
+func TestUseApplicationDefault(t *testing.T) {
+	ssl := NewApplication("ssl", "")
+	https, err := NewPort("https", 443, "tcp", "")
+	if err != nil {
+		t.Fatalf("failed to create port: %v", err)
+	}
+	if err := ssl.AddDefault(https); err != nil {
+		t.Fatalf("failed to add default port: %v", err)
+	}
+	dns := NewApplication("dns", "")
+	lookup, err := ParseService("dns", "udp/53", "")
+	if err != nil {
+		t.Fatalf("failed to parse service: %v", err)
+	}
+	if err := dns.AddDefault(lookup); err != nil {
+		t.Fatalf("failed to add default port: %v", err)
+	}
+
+	r := NewRule(1, NewGroup("src", ""), NewGroup("dst", ""), NewPortGroup("any", ""), true, "")
+	r.AddApplication(ssl)
+	r.AddApplication(dns)
+	if err := r.UseApplicationDefault(); err != nil {
+		t.Fatalf("failed to use application default: %v", err)
+	}
+
+	if got, want := r.Port().Flatten().String(), "tcp/443, udp/53"; got != want {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+	if !r.MatchApplication("dns") || r.MatchApplication("ssh") {
+		t.Fatalf("rule matched the wrong applications")
+	}
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AddressDiff describes how the effective addresses of two objects differ.
+type AddressDiff struct {
+	// Removed holds the addresses only covered by the first object.
+	Removed AddressSet
+	// Added holds the addresses only covered by the second object.
+	Added AddressSet
+}
+
+// Equal returns true if neither side has any address the other lacks.
+func (d AddressDiff) Equal() bool {
+	return len(d.Removed) == 0 && len(d.Added) == 0
+}
+
+func (d AddressDiff) String() string {
+	if d.Equal() {
+		return "no difference"
+	}
+	parts := make([]string, 0, 2)
+	if len(d.Removed) > 0 {
+		parts = append(parts, fmt.Sprintf("- %s", d.Removed))
+	}
+	if len(d.Added) > 0 {
+		parts = append(parts, fmt.Sprintf("+ %s", d.Added))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// DiffAddresses compares the effective addresses of a and b, regardless of
+// how the objects are structured.
+func DiffAddresses(a, b NetworkUnpacker) AddressDiff {
+	setA := NewAddressSet(a)
+	setB := NewAddressSet(b)
+	return AddressDiff{
+		Removed: setA.Difference(setB),
+		Added:   setB.Difference(setA),
+	}
+}
+
+// PortDiff describes how the effective services of two objects differ.
+type PortDiff struct {
+	// Removed holds the services only covered by the first object.
+	Removed PortSet
+	// Added holds the services only covered by the second object.
+	Added PortSet
+}
+
+// Equal returns true if neither side has any service the other lacks.
+func (d PortDiff) Equal() bool {
+	return len(d.Removed) == 0 && len(d.Added) == 0
+}
+
+func (d PortDiff) String() string {
+	if d.Equal() {
+		return "no difference"
+	}
+	parts := make([]string, 0, 2)
+	if len(d.Removed) > 0 {
+		parts = append(parts, fmt.Sprintf("- %s", d.Removed))
+	}
+	if len(d.Added) > 0 {
+		parts = append(parts, fmt.Sprintf("+ %s", d.Added))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// DiffPorts compares the effective services of a and b, regardless of how
+// the objects are structured.
+func DiffPorts(a, b PortUnpacker) PortDiff {
+	setA := a.UnpackPorts()
+	setB := b.UnpackPorts()
+	return PortDiff{
+		Removed: setA.Difference(setB),
+		Added:   setB.Difference(setA),
+	}
+}
+
+// Equivalent returns true if the group covers exactly the same addresses as
+// obj. Unlike MatchContent, the structure of the group doesn't matter, so a
+// group holding 10.0.0.0/25 and 10.0.0.128/25 is equivalent to 10.0.0.0/24.
+func (g *Group) Equivalent(obj NetworkUnpacker) bool {
+	return DiffAddresses(g, obj).Equal()
+}
+
+// Equivalent returns true if the group covers exactly the same services as obj.
+func (pg *PortGroup) Equivalent(obj PortUnpacker) bool {
+	return DiffPorts(pg, obj).Equal()
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestGroupEquivalent(t *testing.T) {
+	halves := testGroup(t, "halves", "10.0.0.0/255.255.255.128", "10.0.0.128/255.255.255.128")
+	whole := testGroup(t, "whole", "10.0.0.0/255.255.255.0")
+	bigger := testGroup(t, "bigger", "10.0.0.0/255.255.254.0")
+
+	if halves.MatchContent(whole) {
+		t.Fatalf("expected groups to differ structurally")
+	}
+	if !halves.Equivalent(whole) {
+		t.Fatalf("expected groups to be equivalent")
+	}
+	if halves.Equivalent(bigger) {
+		t.Fatalf("expected groups not to be equivalent")
+	}
+
+	diff := DiffAddresses(halves, bigger)
+	if len(diff.Removed) != 0 {
+		t.Fatalf("expected nothing removed, got: %s", diff.Removed)
+	}
+	if diff.Added.String() != "10.0.1.0/24" {
+		t.Fatalf("want added: %s, got: %s", "10.0.1.0/24", diff.Added)
+	}
+}
+
+func TestPortGroupEquivalent(t *testing.T) {
+	split := NewPortGroup("split", "")
+	low, err := NewPortRange("low", 1, 1023, "tcp", "")
+	if err != nil {
+		t.Fatalf("failed to create test port range: %v", err)
+	}
+	high, err := NewPortRange("high", 1024, 65535, "tcp", "")
+	if err != nil {
+		t.Fatalf("failed to create test port range: %v", err)
+	}
+	for _, obj := range []interface{}{low, high} {
+		if err := split.Add(obj); err != nil {
+			t.Fatalf("failed to add range to group: %v", err)
+		}
+	}
+	all, err := NewPortRange("all", 1, 65535, "tcp", "")
+	if err != nil {
+		t.Fatalf("failed to create test port range: %v", err)
+	}
+
+	if !split.Equivalent(all) {
+		t.Fatalf("expected port group to be equivalent to tcp/1-65535")
+	}
+
+	ssh, err := NewPort("ssh", 22, "tcp", "")
+	if err != nil {
+		t.Fatalf("failed to create test port: %v", err)
+	}
+	diff := DiffPorts(split, ssh)
+	if diff.Removed.String() != "tcp/1-21, tcp/23-65535" {
+		t.Fatalf("want removed: %s, got: %s", "tcp/1-21, tcp/23-65535", diff.Removed)
+	}
+}
+
+func TestPortGroupMatchIgnoresUID(t *testing.T) {
+	http, err := NewPort("http", 80, "tcp", "")
+	if err != nil {
+		t.Fatalf("failed to create test port: %v", err)
+	}
+	a := NewPortGroup("web", "")
+	b := NewPortGroup("web", "")
+	if err := a.Add(http); err != nil {
+		t.Fatalf("failed to add port to group: %v", err)
+	}
+	if err := b.Add(http); err != nil {
+		t.Fatalf("failed to add port to group: %v", err)
+	}
+	if !a.Match(b) {
+		t.Fatalf("expected groups with different uids to match")
+	}
+}
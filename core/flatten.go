@@ -0,0 +1,500 @@
+package core
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+
+	"github.com/Neffats/ip"
+	"github.com/google/uuid"
+)
+
+// AddressSet is a normalized set of IPv4 addresses. Its intervals are sorted by
+// start address and never overlap or touch, so two sets covering the same
+// addresses are always identical.
+type AddressSet []NetworkObject
+
+// NewAddressSet returns the normalized set of every address covered by objs.
+func NewAddressSet(objs ...NetworkUnpacker) AddressSet {
+	all := make([]NetworkObject, 0)
+	for _, o := range objs {
+		all = append(all, o.Unpack()...)
+	}
+	return normalize(all)
+}
+
+// normalize sorts the intervals and merges any that overlap or are adjacent.
+func normalize(objs []NetworkObject) AddressSet {
+	if len(objs) == 0 {
+		return AddressSet{}
+	}
+	sorted := make([]NetworkObject, len(objs))
+	copy(sorted, objs)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Start == sorted[j].Start {
+			return sorted[i].End < sorted[j].End
+		}
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	result := AddressSet{sorted[0]}
+	for _, o := range sorted[1:] {
+		last := &result[len(result)-1]
+		// Merge if the interval overlaps or directly follows the previous one.
+		if uint64(o.Start) <= uint64(last.End)+1 {
+			if o.End > last.End {
+				last.End = o.End
+			}
+			continue
+		}
+		result = append(result, o)
+	}
+	return result
+}
+
+// Unpack returns the intervals of the set.
+// Satisfies the NetworkUnpacker interface.
+func (s AddressSet) Unpack() []NetworkObject {
+	result := make([]NetworkObject, len(s))
+	copy(result, s)
+	return result
+}
+
+// Contains returns true if every address of obj is in the set.
+func (s AddressSet) Contains(obj NetworkUnpacker) bool {
+	for _, o := range obj.Unpack() {
+		// Find the first interval that ends at or after the start of o.
+		i := sort.Search(len(s), func(i int) bool {
+			return s[i].End >= o.Start
+		})
+		if i >= len(s) || s[i].Start > o.Start || s[i].End < o.End {
+			return false
+		}
+	}
+	return true
+}
+
+// Size returns the number of addresses in the set.
+func (s AddressSet) Size() uint64 {
+	var size uint64
+	for _, o := range s {
+		size += uint64(o.End) - uint64(o.Start) + 1
+	}
+	return size
+}
+
+// CIDRs returns the smallest list of networks that exactly cover the set.
+// Each network is named after its CIDR notation.
+func (s AddressSet) CIDRs() []*Network {
+	result := make([]*Network, 0)
+	for _, o := range s {
+		start := uint64(o.Start)
+		end := uint64(o.End)
+		for start <= end {
+			// Largest block aligned on start...
+			size := uint64(1) << 32
+			if start != 0 {
+				size = uint64(1) << bits.TrailingZeros64(start)
+			}
+			// ...that doesn't run past the end of the interval.
+			for start+size-1 > end {
+				size >>= 1
+			}
+			prefix := 32 - (bits.Len64(size) - 1)
+			result = append(result, newCIDR(ip.Address(start), prefix))
+			start += size
+		}
+	}
+	return result
+}
+
+func (s AddressSet) String() string {
+	parts := make([]string, 0, len(s))
+	for _, o := range s {
+		parts = append(parts, o.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// String returns the interval as a single address, a CIDR if it lines up
+// with a subnet boundary, or start-end otherwise.
+func (n NetworkObject) String() string {
+	if n.Start == n.End {
+		return addrString(n.Start)
+	}
+	size := uint64(n.End) - uint64(n.Start) + 1
+	if bits.OnesCount64(size) == 1 && uint64(n.Start)%size == 0 {
+		return fmt.Sprintf("%s/%d", addrString(n.Start), 32-(bits.Len64(size)-1))
+	}
+	return fmt.Sprintf("%s-%s", addrString(n.Start), addrString(n.End))
+}
+
+// FormatAddress returns addr in dotted decimal notation.
+func FormatAddress(addr ip.Address) string {
+	return addrString(addr)
+}
+
+// addrString formats an address in dotted decimal notation.
+func addrString(a ip.Address) string {
+	v := uint64(a)
+	return fmt.Sprintf("%d.%d.%d.%d", (v>>24)&0xff, (v>>16)&0xff, (v>>8)&0xff, v&0xff)
+}
+
+// prefixMask returns the subnet mask for a prefix length i.e. 24 -> 255.255.255.0
+func prefixMask(prefix int) ip.Address {
+	if prefix <= 0 {
+		return ip.Address(0)
+	}
+	return ip.Address(uint64(addrMax) &^ (uint64(1)<<uint(32-prefix) - 1))
+}
+
+func newCIDR(addr ip.Address, prefix int) *Network {
+	mask := prefixMask(prefix)
+	uid := uuid.New()
+	return &Network{
+		uid:     uid.String(),
+		name:    fmt.Sprintf("%s/%d", addrString(addr), prefix),
+		address: &addr,
+		mask:    &mask,
+	}
+}
+
+// Flatten resolves every nested group and returns the normalized set of
+// addresses that the group represents.
+func (g *Group) Flatten() AddressSet {
+	all := make([]NetworkObject, 0)
+	g.flattenInto(&all, make(map[*Group]bool))
+	return normalize(all)
+}
+
+func (g *Group) flattenInto(all *[]NetworkObject, seen map[*Group]bool) {
+	// Guard against a group being nested inside itself.
+	if seen[g] {
+		return
+	}
+	seen[g] = true
+
+	if len(g.excluded) == 0 && !g.negated {
+		g.membersInto(all, seen)
+		return
+	}
+	// Exclusions and negation apply to the group as a whole, so its members
+	// have to be normalized on their own first.
+	members := make([]NetworkObject, 0)
+	g.membersInto(&members, seen)
+	set := normalize(members)
+	for _, ex := range g.excluded {
+		set = set.Difference(ex.Flatten())
+	}
+	if g.negated {
+		set = AddressSet{{Start: 0, End: addrMax}}.Difference(set)
+	}
+	*all = append(*all, set...)
+}
+
+// membersInto adds the addresses of every member to all.
+func (g *Group) membersInto(all *[]NetworkObject, seen map[*Group]bool) {
+	for _, h := range g.hosts {
+		*all = append(*all, h.Unpack()...)
+	}
+	for _, n := range g.networks {
+		*all = append(*all, n.Unpack()...)
+	}
+	for _, r := range g.ranges {
+		*all = append(*all, r.Unpack()...)
+	}
+	for _, f := range g.fqdns {
+		*all = append(*all, f.Unpack()...)
+	}
+	for _, w := range g.wildcards {
+		*all = append(*all, w.Unpack()...)
+	}
+	for _, r := range g.regions {
+		*all = append(*all, r.Unpack()...)
+	}
+	for _, grp := range g.groups {
+		grp.flattenInto(all, seen)
+	}
+}
+
+// Unpack returns the flattened addresses of the group.
+// Satisfies the NetworkUnpacker interface.
+func (g *Group) Unpack() []NetworkObject {
+	return g.Flatten()
+}
+
+// PortInterval is the most basic representation of a service: a range of port
+// numbers for a single protocol.
+type PortInterval struct {
+	Start    uint
+	End      uint
+	Protocol int
+}
+
+// Value satisfies the PortObject interface.
+func (p PortInterval) Value() (start uint, end uint, proto int) {
+	return p.Start, p.End, p.Protocol
+}
+
+// Contains returns true if every service of obj is in the interval. Services
+// of the ip protocol contain those of every other IP protocol.
+func (p PortInterval) Contains(obj PortObject) bool {
+	start, end, proto := obj.Value()
+	if !protoCovers(p.Protocol, proto) {
+		return false
+	}
+	if !HasPorts(p.Protocol) {
+		return true
+	}
+	return p.Start <= start && p.End >= end
+}
+
+func (p PortInterval) String() string {
+	name := Proto2String(p.Protocol)
+	switch {
+	case !HasPorts(p.Protocol):
+		return name
+	case p.Protocol == ICMP || p.Protocol == ICMPv6:
+		if p.Start == 0 && p.End >= maxPort {
+			return name
+		}
+		return fmt.Sprintf("%s/%s", name, icmpString(p.Start, p.End))
+	case p.Start == p.End:
+		return fmt.Sprintf("%s/%d", name, p.Start)
+	}
+	return fmt.Sprintf("%s/%d-%d", name, p.Start, p.End)
+}
+
+// icmpString returns an ICMP interval in type:code notation, leaving out the
+// code when every code of the types is covered, i.e. 3 or 8:0.
+func icmpString(start, end uint) string {
+	if start == end {
+		return fmt.Sprintf("%d:%d", start>>8, start&0xff)
+	}
+	if start&0xff == 0 && end&0xff == 0xff {
+		if start>>8 == end>>8 {
+			return fmt.Sprintf("%d", start>>8)
+		}
+		return fmt.Sprintf("%d-%d", start>>8, end>>8)
+	}
+	return fmt.Sprintf("%d:%d-%d:%d", start>>8, start&0xff, end>>8, end&0xff)
+}
+
+// PortSet is a normalized set of services. Its intervals are ordered by
+// protocol then by start port, and never overlap or touch within a protocol.
+//
+// Services of the ip and any protocols are kept as a single interval covering
+// every protocol they stand for, and only split up by protocol where a set
+// operation meets a service of a single protocol. Services of protocols
+// without ports cover the whole port space, so that set operations between
+// them are exact.
+type PortSet []PortInterval
+
+// NewPortSet returns the normalized set of every service covered by objs.
+func NewPortSet(objs ...PortObject) PortSet {
+	all := make([]PortInterval, 0, len(objs))
+	for _, o := range objs {
+		start, end, proto := o.Value()
+		all = append(all, PortInterval{Start: start, End: end, Protocol: proto})
+	}
+	return normalizePorts(all)
+}
+
+// ipProtocols returns every IP protocol with all of its ports.
+func ipProtocols() []PortInterval {
+	result := make([]PortInterval, 0, 256)
+	for n := 0; n < 256; n++ {
+		result = append(result, PortInterval{Start: 0, End: maxPort, Protocol: ProtocolNumber(uint8(n))})
+	}
+	return result
+}
+
+// whole returns true if the interval covers every port of its protocol.
+func (p PortInterval) whole() bool {
+	return p.Start == 0 && p.End >= maxPort
+}
+
+func normalizePorts(ports []PortInterval) PortSet {
+	if len(ports) == 0 {
+		return PortSet{}
+	}
+	// Services of the ip or any protocol swallow those of the protocols they
+	// cover.
+	wide := -1
+	for _, p := range ports {
+		if p.Protocol == Any || (p.Protocol == IP && wide != Any) {
+			wide = p.Protocol
+		}
+	}
+	sorted := make([]PortInterval, 0, len(ports)+1)
+	if wide != -1 {
+		sorted = append(sorted, PortInterval{Start: 0, End: maxPort, Protocol: wide})
+	}
+	for _, p := range ports {
+		if wide != -1 && protoCovers(wide, p.Protocol) {
+			continue
+		}
+		if !HasPorts(p.Protocol) {
+			p = PortInterval{Start: 0, End: maxPort, Protocol: p.Protocol}
+		}
+		sorted = append(sorted, p)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Protocol != sorted[j].Protocol {
+			return sorted[i].Protocol < sorted[j].Protocol
+		}
+		if sorted[i].Start == sorted[j].Start {
+			return sorted[i].End < sorted[j].End
+		}
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	result := PortSet{sorted[0]}
+	for _, p := range sorted[1:] {
+		last := &result[len(result)-1]
+		if p.Protocol == last.Protocol && p.Start <= last.End+1 {
+			if p.End > last.End {
+				last.End = p.End
+			}
+			continue
+		}
+		result = append(result, p)
+	}
+	return result.collapse()
+}
+
+// collapse replaces the intervals of a set that add up to every IP protocol,
+// or to every service, with a single ip or any interval, so that two sets
+// covering the same services are always identical.
+func (s PortSet) collapse() PortSet {
+	ip, arp := 0, false
+	for _, p := range s {
+		switch {
+		case p.Protocol == Any:
+			return s
+		case p.Protocol == IP:
+			ip = 256
+		case p.Protocol == ARP:
+			arp = true
+		case p.whole() && isIPProtocol(p.Protocol):
+			// Numbers of the named protocols aren't IP protocols of their
+			// own, see ProtocolNumber.
+			if p.Protocol < protoNumberBase || ProtocolNumber(uint8(p.Protocol-protoNumberBase)) == p.Protocol {
+				ip++
+			}
+		}
+	}
+	if ip < 256 {
+		return s
+	}
+	if arp {
+		return PortSet{{Start: 0, End: maxPort, Protocol: Any}}
+	}
+	result := PortSet{}
+	for _, p := range s {
+		if !isIPProtocol(p.Protocol) && p.Protocol != IP {
+			result = append(result, p)
+		}
+	}
+	result = append(result, PortInterval{Start: 0, End: maxPort, Protocol: IP})
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Protocol < result[j].Protocol
+	})
+	return result
+}
+
+// Contains returns true if the whole of obj is in the set.
+func (s PortSet) Contains(obj PortObject) bool {
+	for _, o := range NewPortSet(obj) {
+		found := false
+		for _, p := range s {
+			if p.Contains(o) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Protocol returns the part of the set that uses the given protocol.
+func (s PortSet) Protocol(proto int) PortSet {
+	return s.Intersect(NewPortSet(PortInterval{Start: 0, End: maxPort, Protocol: proto}))
+}
+
+// ByProtocol splits the set up by protocol, listing every protocol covered
+// by an ip or any service on its own.
+func (s PortSet) ByProtocol() map[int]PortSet {
+	result := make(map[int]PortSet)
+	for _, p := range s {
+		switch p.Protocol {
+		case Any:
+			result[ARP] = append(result[ARP], PortInterval{Start: 0, End: maxPort, Protocol: ARP})
+			fallthrough
+		case IP:
+			for _, q := range ipProtocols() {
+				result[q.Protocol] = append(result[q.Protocol], q)
+			}
+		default:
+			result[p.Protocol] = append(result[p.Protocol], p)
+		}
+	}
+	return result
+}
+
+// String lists the services of the set, writing ip or any in place of the
+// protocols they cover.
+func (s PortSet) String() string {
+	parts := make([]string, 0, len(s))
+	rest := s
+	switch {
+	case len(s) > 0 && s.Contains(PortInterval{Protocol: Any}):
+		return "any"
+	case len(s) > 0 && s.Contains(PortInterval{Protocol: IP}):
+		parts = append(parts, "ip")
+		rest = s.Difference(NewPortSet(PortInterval{Protocol: IP}))
+	}
+	for _, p := range rest {
+		parts = append(parts, p.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Flatten resolves every nested port group and returns the normalized set of
+// services that the group represents. Source port restrictions are left out,
+// so the set can be wider than the traffic the group matches.
+func (pg *PortGroup) Flatten() PortSet {
+	all := make([]PortInterval, 0)
+	pg.flattenInto(&all, make(map[*PortGroup]bool))
+	return normalizePorts(all)
+}
+
+func (pg *PortGroup) flattenInto(all *[]PortInterval, seen map[*PortGroup]bool) {
+	if seen[pg] {
+		return
+	}
+	seen[pg] = true
+
+	for _, p := range pg.ports {
+		*all = append(*all, PortInterval{Start: p.number, End: p.number, Protocol: p.protocol})
+	}
+	for _, r := range pg.ranges {
+		*all = append(*all, PortInterval{Start: r.start, End: r.end, Protocol: r.protocol})
+	}
+	for _, svc := range pg.services {
+		*all = append(*all, PortInterval{Start: svc.start, End: svc.end, Protocol: svc.protocol})
+	}
+	for _, grp := range pg.groups {
+		grp.flattenInto(all, seen)
+	}
+}
+
+// UnpackPorts returns the flattened services of the group.
+// Satisfies the PortUnpacker interface.
+func (pg *PortGroup) UnpackPorts() PortSet {
+	return pg.Flatten()
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestGroupFlatten(t *testing.T) {
+	host, err := NewHost("host", "10.0.0.5", "")
+	if err != nil {
+		t.Fatalf("failed to create test host: %v", err)
+	}
+	lower, err := NewNetwork("lower", "10.0.0.0", "255.255.255.128", "")
+	if err != nil {
+		t.Fatalf("failed to create test network: %v", err)
+	}
+	upper, err := NewNetwork("upper", "10.0.0.128", "255.255.255.128", "")
+	if err != nil {
+		t.Fatalf("failed to create test network: %v", err)
+	}
+	rng, err := NewRange("range", "10.0.2.0", "10.0.2.9", "")
+	if err != nil {
+		t.Fatalf("failed to create test range: %v", err)
+	}
+
+	nested := NewGroup("nested", "")
+	if err := nested.Add(upper); err != nil {
+		t.Fatalf("failed to add network to nested group: %v", err)
+	}
+	if err := nested.Add(rng); err != nil {
+		t.Fatalf("failed to add range to nested group: %v", err)
+	}
+	grp := NewGroup("grp", "")
+	for _, obj := range []interface{}{host, lower, nested} {
+		if err := grp.Add(obj); err != nil {
+			t.Fatalf("failed to add object to group: %v", err)
+		}
+	}
+
+	got := grp.Flatten()
+	want := "10.0.0.0/24, 10.0.2.0-10.0.2.9"
+	if got.String() != want {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+	if got.Size() != 266 {
+		t.Fatalf("want size: %d, got: %d", 266, got.Size())
+	}
+
+	cidrs := make([]string, 0)
+	for _, n := range got.CIDRs() {
+		cidrs = append(cidrs, n.name)
+	}
+	wantCIDRs := []string{"10.0.0.0/24", "10.0.2.0/29", "10.0.2.8/31"}
+	if len(cidrs) != len(wantCIDRs) {
+		t.Fatalf("want: %v, got: %v", wantCIDRs, cidrs)
+	}
+	for i := range cidrs {
+		if cidrs[i] != wantCIDRs[i] {
+			t.Fatalf("want: %v, got: %v", wantCIDRs, cidrs)
+		}
+	}
+}
+
+func TestAddressSetContains(t *testing.T) {
+	netA, err := NewNetwork("netA", "192.168.1.0", "255.255.255.0", "")
+	if err != nil {
+		t.Fatalf("failed to create test network: %v", err)
+	}
+	netB, err := NewNetwork("netB", "192.168.3.0", "255.255.255.0", "")
+	if err != nil {
+		t.Fatalf("failed to create test network: %v", err)
+	}
+	set := NewAddressSet(netA, netB)
+
+	tests := []struct {
+		name  string
+		start string
+		end   string
+		want  bool
+	}{
+		{name: "Host in first interval", start: "192.168.1.1", end: "192.168.1.1", want: true},
+		{name: "Range in second interval", start: "192.168.3.1", end: "192.168.3.200", want: true},
+		{name: "Range across gap", start: "192.168.1.1", end: "192.168.3.1", want: false},
+		{name: "Host outside set", start: "192.168.2.1", end: "192.168.2.1", want: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rng, err := NewRange("test", tc.start, tc.end, "")
+			if err != nil {
+				t.Fatalf("failed to create test range: %v", err)
+			}
+			got := set.Contains(rng)
+			if got != tc.want {
+				t.Fatalf("want: %t, got: %t", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestAddressSetCIDRsFullSpace(t *testing.T) {
+	all, err := NewNetwork("any", "0.0.0.0", "0.0.0.0", "")
+	if err != nil {
+		t.Fatalf("failed to create test network: %v", err)
+	}
+	cidrs := NewAddressSet(all).CIDRs()
+	if len(cidrs) != 1 || cidrs[0].name != "0.0.0.0/0" {
+		t.Fatalf("expected a single 0.0.0.0/0 network, got: %v", cidrs)
+	}
+}
+
+func TestPortGroupFlatten(t *testing.T) {
+	http, err := NewPort("http", 80, "tcp", "")
+	if err != nil {
+		t.Fatalf("failed to create test port: %v", err)
+	}
+	alt, err := NewPortRange("alt", 81, 90, "tcp", "")
+	if err != nil {
+		t.Fatalf("failed to create test port range: %v", err)
+	}
+	dns, err := NewPort("dns", 53, "udp", "")
+	if err != nil {
+		t.Fatalf("failed to create test port: %v", err)
+	}
+	nested := NewPortGroup("nested", "")
+	if err := nested.Add(dns); err != nil {
+		t.Fatalf("failed to add port to nested group: %v", err)
+	}
+	pg := NewPortGroup("pg", "")
+	for _, obj := range []interface{}{http, alt, nested} {
+		if err := pg.Add(obj); err != nil {
+			t.Fatalf("failed to add object to port group: %v", err)
+		}
+	}
+
+	got := pg.Flatten()
+	want := "tcp/80-90, udp/53"
+	if got.String() != want {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+	if len(got.Protocol(UDP)) != 1 {
+		t.Fatalf("expected a single udp interval, got: %s", got.Protocol(UDP))
+	}
+}
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Neffats/ip"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUnknownFQDN = errors.New("fqdn has no static mapping")
+)
+
+// Resolver looks up the addresses of a fully qualified domain name.
+type Resolver interface {
+	Resolve(fqdn string) ([]ip.Address, error)
+}
+
+// FQDN represents an address object defined by a domain name, i.e.
+// www.example.com. It covers no addresses until it has been resolved.
+type FQDN struct {
+	uid       string
+	name      string
+	fqdn      string
+	addresses []ip.Address
+	comment   string
+}
+
+// NewFQDN returns a pointer to a new, unresolved FQDN object.
+func NewFQDN(name, fqdn, comment string) *FQDN {
+	uid := uuid.New()
+	return &FQDN{
+		uid:       uid.String(),
+		name:      name,
+		fqdn:      normalizeFQDN(fqdn),
+		addresses: make([]ip.Address, 0),
+		comment:   comment,
+	}
+}
+
+func normalizeFQDN(fqdn string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(fqdn)), ".")
+}
+
+func (f *FQDN) UID() string {
+	return f.uid
+}
+
+func (f *FQDN) Name() string {
+	return f.name
+}
+
+// FQDN returns the domain name of the object.
+func (f *FQDN) FQDN() string {
+	return f.fqdn
+}
+
+func (f *FQDN) Comment() string {
+	return f.comment
+}
+
+func (f *FQDN) String() string {
+	return f.fqdn
+}
+
+// Resolved returns true if the object has at least one address.
+func (f *FQDN) Resolved() bool {
+	return len(f.addresses) > 0
+}
+
+// Resolve replaces the object's addresses with the ones returned by r.
+func (f *FQDN) Resolve(r Resolver) error {
+	addrs, err := r.Resolve(f.fqdn)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", f.fqdn, err)
+	}
+	f.addresses = make([]ip.Address, len(addrs))
+	copy(f.addresses, addrs)
+	return nil
+}
+
+// Unpack returns the resolved addresses, nothing if the object hasn't been
+// resolved.
+func (f *FQDN) Unpack() []NetworkObject {
+	result := make([]NetworkObject, 0, len(f.addresses))
+	for _, a := range f.addresses {
+		result = append(result, NetworkObject{Start: a, End: a})
+	}
+	return result
+}
+
+// Match will return true if both objects have the same domain name.
+func (f *FQDN) Match(obj *FQDN) bool {
+	return f.fqdn == obj.fqdn
+}
+
+// StaticResolver resolves domain names from a fixed mapping.
+type StaticResolver struct {
+	hosts map[string][]ip.Address
+}
+
+// NewStaticResolver returns an empty resolver.
+func NewStaticResolver() *StaticResolver {
+	return &StaticResolver{hosts: make(map[string][]ip.Address)}
+}
+
+// LoadStaticResolver reads a mapping file in the hosts file format, one
+// address per line followed by one or more names:
+//
+//	# comment
+//	203.0.113.10 www.example.com example.com
+func LoadStaticResolver(path string) (*StaticResolver, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mapping file: %v", err)
+	}
+	defer f.Close()
+	return ReadStaticResolver(f)
+}
+
+// ReadStaticResolver reads a mapping in the hosts file format.
+func ReadStaticResolver(r io.Reader) (*StaticResolver, error) {
+	s := NewStaticResolver()
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i != -1 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected an address followed by a name", line)
+		}
+		addr, err := ip.NewAddress(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid address: %v", line, err)
+		}
+		for _, name := range fields[1:] {
+			s.Add(name, *addr)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read mapping: %v", err)
+	}
+	return s, nil
+}
+
+// Add maps the domain name onto addr.
+func (s *StaticResolver) Add(fqdn string, addr ip.Address) {
+	fqdn = normalizeFQDN(fqdn)
+	for _, existing := range s.hosts[fqdn] {
+		if existing == addr {
+			return
+		}
+	}
+	s.hosts[fqdn] = append(s.hosts[fqdn], addr)
+}
+
+// Resolve returns the addresses mapped to the domain name.
+// Satisfies the Resolver interface.
+func (s *StaticResolver) Resolve(fqdn string) ([]ip.Address, error) {
+	addrs, ok := s.hosts[normalizeFQDN(fqdn)]
+	if !ok {
+		return nil, ErrUnknownFQDN
+	}
+	result := make([]ip.Address, len(addrs))
+	copy(result, addrs)
+	return result, nil
+}
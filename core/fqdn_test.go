@@ -0,0 +1,52 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testHosts = `
+# static mappings
+203.0.113.10 www.example.com example.com
+203.0.113.11 www.example.com
+`
+
+func TestFQDNResolve(t *testing.T) {
+	resolver, err := ReadStaticResolver(strings.NewReader(testHosts))
+	if err != nil {
+		t.Fatalf("failed to read mapping: %v", err)
+	}
+
+	web := NewFQDN("web", "WWW.Example.com.", "")
+	if web.Resolved() || len(web.Unpack()) != 0 {
+		t.Fatalf("expected new fqdn to be unresolved")
+	}
+	grp := NewGroup("grp", "")
+	if err := grp.Add(web); err != nil {
+		t.Fatalf("failed to add fqdn to group: %v", err)
+	}
+	if grp.Contains(web) {
+		t.Fatalf("expected unresolved fqdn not to be contained")
+	}
+
+	if err := grp.Resolve(resolver); err != nil {
+		t.Fatalf("failed to resolve group: %v", err)
+	}
+	if got := grp.Flatten().String(); got != "203.0.113.10/31" {
+		t.Fatalf("unexpected addresses: %s", got)
+	}
+	if !grp.Contains(testGroup(t, "host", "203.0.113.11/255.255.255.255")) {
+		t.Fatalf("expected resolved address to be contained")
+	}
+	if has, err := grp.HasObject(NewFQDN("other", "www.example.com", "")); err != nil || !has {
+		t.Fatalf("expected group to have fqdn with the same name, got: %t, %v", has, err)
+	}
+
+	if err := NewFQDN("missing", "missing.example.com", "").Resolve(resolver); !errors.Is(err, ErrUnknownFQDN) {
+		t.Fatalf("expected unknown fqdn error, got: %v", err)
+	}
+	if _, err := ReadStaticResolver(strings.NewReader("203.0.113.10\n")); err == nil {
+		t.Fatalf("expected error for line without a name")
+	}
+}
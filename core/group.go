@@ -15,14 +15,24 @@ const defaultGroupCapacity = 100
 // for efficient searching.
 // The Network objects are ordered by Address, and the Groups
 // are ordered by name.
+//
+// A group can also exclude the addresses of other groups (Check Point
+// "group with exclusion") and be negated (PAN-OS negate-source), both of
+// which are applied by Flatten and Contains but ignored by HasObject, which
+// only reports what is configured as a member.
 type Group struct {
-	uid      string
-	name     string
-	hosts    []*Host
-	networks []*Network
-	ranges   []*Range
-	groups   []*Group
-	comment  string
+	uid       string
+	name      string
+	hosts     []*Host
+	networks  []*Network
+	ranges    []*Range
+	groups    []*Group
+	fqdns     []*FQDN
+	wildcards []*Wildcard
+	regions   []*Region
+	excluded  []*Group
+	negated   bool
+	comment   string
 }
 
 // NewGroup returns a new empty group.
@@ -39,6 +49,124 @@ func NewGroup(name, comment string) *Group {
 	}
 }
 
+// FQDNs returns a copy of the group's FQDN members.
+func (g *Group) FQDNs() []*FQDN {
+	result := make([]*FQDN, len(g.fqdns))
+	copy(result, g.fqdns)
+	return result
+}
+
+// Wildcards returns a copy of the group's wildcard members.
+func (g *Group) Wildcards() []*Wildcard {
+	result := make([]*Wildcard, len(g.wildcards))
+	copy(result, g.wildcards)
+	return result
+}
+
+// Regions returns a copy of the group's region members.
+func (g *Group) Regions() []*Region {
+	result := make([]*Region, len(g.regions))
+	copy(result, g.regions)
+	return result
+}
+
+// Excluded returns a copy of the groups whose addresses are excluded.
+func (g *Group) Excluded() []*Group {
+	result := make([]*Group, len(g.excluded))
+	copy(result, g.excluded)
+	return result
+}
+
+// Exclude removes the addresses of grp from the group.
+func (g *Group) Exclude(grp *Group) {
+	g.excluded = append(g.excluded, grp)
+}
+
+// Negate flips the group to match every address except its members.
+func (g *Group) Negate() {
+	g.negated = !g.negated
+}
+
+// Negated returns true if the group matches every address except its members.
+func (g *Group) Negated() bool {
+	return g.negated
+}
+
+// Resolve resolves every FQDN member, including those of nested and
+// excluded groups.
+func (g *Group) Resolve(r Resolver) error {
+	return g.resolve(r, make(map[*Group]bool))
+}
+
+func (g *Group) resolve(r Resolver, seen map[*Group]bool) error {
+	if seen[g] {
+		return nil
+	}
+	seen[g] = true
+	for _, f := range g.fqdns {
+		if err := f.Resolve(r); err != nil {
+			return err
+		}
+	}
+	for _, grp := range append(g.Groups(), g.excluded...) {
+		if err := grp.resolve(r, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolveRegions resolves every region member, including those of nested
+// and excluded groups.
+func (g *Group) ResolveRegions(m *RegionMap) {
+	g.resolveRegions(m, make(map[*Group]bool))
+}
+
+func (g *Group) resolveRegions(m *RegionMap, seen map[*Group]bool) {
+	if seen[g] {
+		return
+	}
+	seen[g] = true
+	for _, r := range g.regions {
+		r.Resolve(m)
+	}
+	for _, grp := range append(g.Groups(), g.excluded...) {
+		grp.resolveRegions(m, seen)
+	}
+}
+
+func (g *Group) Name() string {
+	return g.name
+}
+
+// Hosts returns a copy of the group's host members.
+func (g *Group) Hosts() []*Host {
+	result := make([]*Host, len(g.hosts))
+	copy(result, g.hosts)
+	return result
+}
+
+// Networks returns a copy of the group's network members.
+func (g *Group) Networks() []*Network {
+	result := make([]*Network, len(g.networks))
+	copy(result, g.networks)
+	return result
+}
+
+// Ranges returns a copy of the group's range members.
+func (g *Group) Ranges() []*Range {
+	result := make([]*Range, len(g.ranges))
+	copy(result, g.ranges)
+	return result
+}
+
+// Groups returns a copy of the group's nested groups.
+func (g *Group) Groups() []*Group {
+	result := make([]*Group, len(g.groups))
+	copy(result, g.groups)
+	return result
+}
+
 // Match will return true if the two groups are identical.
 func (g *Group) Match(grp *Group) bool {
 	if grp.name == g.name && g.MatchContent(grp) {
@@ -63,6 +191,13 @@ func (g *Group) MatchContent(grp *Group) bool {
 	if len(g.groups) != len(grp.groups) {
 		return false
 	}
+	if len(g.fqdns) != len(grp.fqdns) || len(g.wildcards) != len(grp.wildcards) ||
+		len(g.regions) != len(grp.regions) || len(g.excluded) != len(grp.excluded) {
+		return false
+	}
+	if g.negated != grp.negated {
+		return false
+	}
 
 	var match bool
 
@@ -99,11 +234,32 @@ func (g *Group) MatchContent(grp *Group) bool {
 		}
 	}
 
+	for i := 0; i < len(g.fqdns); i++ {
+		if !g.fqdns[i].Match(grp.fqdns[i]) {
+			return false
+		}
+	}
+	for i := 0; i < len(g.wildcards); i++ {
+		if !g.wildcards[i].Match(grp.wildcards[i]) {
+			return false
+		}
+	}
+	for i := 0; i < len(g.regions); i++ {
+		if !g.regions[i].Match(grp.regions[i]) {
+			return false
+		}
+	}
+	for i := 0; i < len(g.excluded); i++ {
+		if !g.excluded[i].Match(grp.excluded[i]) {
+			return false
+		}
+	}
+
 	return true
 }
 
 // Add will add the specified object to the group.
-// Supported types: Host/Network/Range/Group
+// Supported types: Host/Network/Range/Group/FQDN/Wildcard/Region
 func (g *Group) Add(obj interface{}) error {
 	present, err := g.HasObject(obj)
 	if err != nil {
@@ -122,6 +278,28 @@ func (g *Group) Add(obj interface{}) error {
 		g.addRange(v)
 	case *Group:
 		g.addGroup(v)
+	case *FQDN:
+		// Ordered alphabetically by domain name.
+		i := sort.Search(len(g.fqdns), func(i int) bool {
+			return g.fqdns[i].fqdn >= v.fqdn
+		})
+		g.fqdns = append(g.fqdns[:i], append([]*FQDN{v}, g.fqdns[i:]...)...)
+	case *Wildcard:
+		// Ordered by address then wildcard.
+		i := sort.Search(len(g.wildcards), func(i int) bool {
+			w := g.wildcards[i]
+			if *w.address != *v.address {
+				return *w.address > *v.address
+			}
+			return *w.wildcard >= *v.wildcard
+		})
+		g.wildcards = append(g.wildcards[:i], append([]*Wildcard{v}, g.wildcards[i:]...)...)
+	case *Region:
+		// Ordered alphabetically by code.
+		i := sort.Search(len(g.regions), func(i int) bool {
+			return g.regions[i].code >= v.code
+		})
+		g.regions = append(g.regions[:i], append([]*Region{v}, g.regions[i:]...)...)
 	default:
 		return errors.New("unsupported data type")
 	}
@@ -234,6 +412,24 @@ func (g *Group) HasObject(obj interface{}) (bool, error) {
 		if has {
 			return has, nil
 		}
+	case *FQDN:
+		for _, f := range g.fqdns {
+			if f.Match(v) {
+				return true, nil
+			}
+		}
+	case *Wildcard:
+		for _, w := range g.wildcards {
+			if w.Match(v) {
+				return true, nil
+			}
+		}
+	case *Region:
+		for _, r := range g.regions {
+			if r.Match(v) {
+				return true, nil
+			}
+		}
 	default:
 		return false, fmt.Errorf("unsupported data type: %T", v)
 	}
@@ -344,7 +540,43 @@ func (g *Group) HasGroup(grp *Group) bool {
 	return g.groups[i].Match(grp)
 }
 
+// Contains returns true if a single member of the group covers every address
+// of obj, nested groups being searched too. Addresses of excluded groups are
+// never contained, and a negated group contains obj if none of its members
+// overlap it. To check coverage spread across several members, i.e.
+// 10.0.0.0/24 by 10.0.0.0/25 and 10.0.0.128/25, use Flatten().Contains.
+// Objects without any addresses, like an unresolved FQDN, are never contained.
 func (g *Group) Contains(obj NetworkUnpacker) bool {
+	if len(obj.Unpack()) == 0 {
+		return false
+	}
+	return g.contains(obj, make(map[*Group]bool))
+}
+
+// Overlaps returns true if the group shares any address with obj, nested
+// groups, exclusions and negation included.
+func (g *Group) Overlaps(obj NetworkUnpacker) bool {
+	return g.Flatten().Overlaps(NewAddressSet(obj))
+}
+
+func (g *Group) contains(obj NetworkUnpacker, seen map[*Group]bool) bool {
+	// Guard against a group being nested inside itself.
+	if seen[g] {
+		return false
+	}
+	seen[g] = true
+
+	for _, ex := range g.excluded {
+		if Overlap(ex, obj) {
+			return false
+		}
+	}
+	if g.negated {
+		members := make([]NetworkObject, 0)
+		g.membersInto(&members, make(map[*Group]bool))
+		return !NewAddressSet(obj).Overlaps(normalize(members))
+	}
+
 	for _, h := range g.hosts {
 		if h.Contains(obj) {
 			return true
@@ -360,10 +592,122 @@ func (g *Group) Contains(obj NetworkUnpacker) bool {
 			return true
 		}
 	}
+	for _, f := range g.fqdns {
+		if normalize(f.Unpack()).Contains(obj) {
+			return true
+		}
+	}
+	for _, w := range g.wildcards {
+		if normalize(w.Unpack()).Contains(obj) {
+			return true
+		}
+	}
+	for _, r := range g.regions {
+		if normalize(r.Unpack()).Contains(obj) {
+			return true
+		}
+	}
 	for _, grp := range g.groups {
-		if grp.Contains(obj) {
+		if grp.contains(obj, seen) {
 			return true
 		}
 	}
 	return false
 }
+
+func (g *Group) UID() string {
+	return g.uid
+}
+
+func (g *Group) Comment() string {
+	return g.comment
+}
+
+// clone returns a copy of the group whose member lists can be changed without
+// affecting the original. Members themselves are shared.
+func (g *Group) clone() *Group {
+	c := *g
+	c.hosts = append([]*Host{}, g.hosts...)
+	c.networks = append([]*Network{}, g.networks...)
+	c.ranges = append([]*Range{}, g.ranges...)
+	c.groups = append([]*Group{}, g.groups...)
+	c.fqdns = append([]*FQDN{}, g.fqdns...)
+	c.wildcards = append([]*Wildcard{}, g.wildcards...)
+	c.regions = append([]*Region{}, g.regions...)
+	c.excluded = append([]*Group{}, g.excluded...)
+	return &c
+}
+
+// WithName returns a copy of the group with a new name. Copies keep the UID
+// of the original, so they can replace it with a store's Update.
+func (g *Group) WithName(name string) *Group {
+	c := g.clone()
+	c.name = name
+	return c
+}
+
+// WithComment returns a copy of the group with a new comment.
+func (g *Group) WithComment(comment string) *Group {
+	c := g.clone()
+	c.comment = comment
+	return c
+}
+
+// WithMember returns a copy of the group with obj added, see Add for the
+// supported types.
+func (g *Group) WithMember(obj interface{}) (*Group, error) {
+	c := g.clone()
+	if err := c.Add(obj); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// WithoutMember returns a copy of the group without the direct member whose
+// UID is uid. Returns an error if there is no such member.
+func (g *Group) WithoutMember(uid string) (*Group, error) {
+	c := g.clone()
+	for i, h := range c.hosts {
+		if h.uid == uid {
+			c.hosts = append(c.hosts[:i], c.hosts[i+1:]...)
+			return c, nil
+		}
+	}
+	for i, n := range c.networks {
+		if n.uid == uid {
+			c.networks = append(c.networks[:i], c.networks[i+1:]...)
+			return c, nil
+		}
+	}
+	for i, r := range c.ranges {
+		if r.uid == uid {
+			c.ranges = append(c.ranges[:i], c.ranges[i+1:]...)
+			return c, nil
+		}
+	}
+	for i, grp := range c.groups {
+		if grp.uid == uid {
+			c.groups = append(c.groups[:i], c.groups[i+1:]...)
+			return c, nil
+		}
+	}
+	for i, f := range c.fqdns {
+		if f.uid == uid {
+			c.fqdns = append(c.fqdns[:i], c.fqdns[i+1:]...)
+			return c, nil
+		}
+	}
+	for i, w := range c.wildcards {
+		if w.uid == uid {
+			c.wildcards = append(c.wildcards[:i], c.wildcards[i+1:]...)
+			return c, nil
+		}
+	}
+	for i, r := range c.regions {
+		if r.uid == uid {
+			c.regions = append(c.regions[:i], c.regions[i+1:]...)
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("group %s has no member with uid: %s", g.name, uid)
+}
@@ -615,3 +615,98 @@ func TestGroupMatchContent(t *testing.T) {
 		})
 	}
 }
+
+func TestGroupExclusionAndNegation(t *testing.T) {
+	internal := testGroup(t, "internal", "10.0.0.0/255.0.0.0")
+	servers := testGroup(t, "servers", "10.1.0.0/255.255.0.0")
+	host := testGroup(t, "host", "10.1.2.3/255.255.255.255")
+
+	excluded := testGroup(t, "clients", "10.0.0.0/255.0.0.0")
+	excluded.Exclude(servers)
+	if got := excluded.Flatten().String(); got != "10.0.0.0/16, 10.2.0.0-10.255.255.255" {
+		t.Fatalf("unexpected addresses after exclusion: %s", got)
+	}
+	if excluded.Contains(host) {
+		t.Fatalf("expected excluded address not to be contained")
+	}
+	if has, err := excluded.HasObject(internal.Networks()[0]); err != nil || !has {
+		t.Fatalf("expected HasObject to ignore exclusions, got: %t, %v", has, err)
+	}
+
+	negated := testGroup(t, "not-internal", "10.0.0.0/255.0.0.0")
+	negated.Negate()
+	if !negated.Negated() || negated.Contains(host) {
+		t.Fatalf("expected negated group not to contain internal host")
+	}
+	if !negated.Contains(testGroup(t, "public", "8.8.8.0/255.255.255.0")) {
+		t.Fatalf("expected negated group to contain public addresses")
+	}
+	if negated.MatchContent(internal) {
+		t.Fatalf("expected negated group not to match the plain group")
+	}
+
+	// Negation and exclusions still apply when the group is nested.
+	parent := NewGroup("parent", "")
+	if err := parent.Add(excluded); err != nil {
+		t.Fatalf("failed to add nested group: %v", err)
+	}
+	if parent.Contains(host) {
+		t.Fatalf("expected nested exclusion to apply")
+	}
+}
+
+func TestGroupWithMember(t *testing.T) {
+	host, err := NewHost("web", "10.0.0.1", "")
+	if err != nil {
+		t.Fatalf("failed to create host: %v", err)
+	}
+	network, err := NewNetwork("lan", "10.1.0.0", "255.255.0.0", "")
+	if err != nil {
+		t.Fatalf("failed to create network: %v", err)
+	}
+	original := NewGroup("servers", "")
+	if err := original.Add(host); err != nil {
+		t.Fatalf("failed to add host: %v", err)
+	}
+
+	added, err := original.WithMember(network)
+	if err != nil {
+		t.Fatalf("failed to add member: %v", err)
+	}
+	if len(original.Networks()) != 0 || len(added.Networks()) != 1 || added.UID() != original.UID() {
+		t.Fatalf("expected a copy with the network and the same uid")
+	}
+
+	removed, err := added.WithoutMember(host.UID())
+	if err != nil {
+		t.Fatalf("failed to remove member: %v", err)
+	}
+	if got := removed.Flatten().String(); got != "10.1.0.0/16" {
+		t.Fatalf("want: 10.1.0.0/16, got: %s", got)
+	}
+	if len(added.Hosts()) != 1 {
+		t.Fatalf("removing from the copy changed its source")
+	}
+	if _, err := removed.WithoutMember(host.UID()); err == nil {
+		t.Fatalf("expected error removing a missing member")
+	}
+}
+
+func TestGroupContainsSplit(t *testing.T) {
+	split := testGroup(t, "split", "10.0.0.0/255.255.255.128")
+	if err := split.Add(testGroup(t, "upper", "10.0.0.128/255.255.255.128")); err != nil {
+		t.Fatalf("failed to add nested group: %v", err)
+	}
+	whole := testGroup(t, "whole", "10.0.0.0/255.255.255.0")
+
+	// No single member covers the /24, but the members do between them.
+	if split.Contains(whole) {
+		t.Fatalf("expected network split across members not to be contained")
+	}
+	if !split.Flatten().Contains(whole) {
+		t.Fatalf("expected flattened group to contain network split across members")
+	}
+	if !split.Contains(testGroup(t, "part", "10.0.0.192/255.255.255.192")) {
+		t.Fatalf("expected network within a nested member to be contained")
+	}
+}
@@ -36,6 +36,15 @@ func (h *Host) UID() string {
 	return h.uid
 }
 
+func (h *Host) Name() string {
+	return h.name
+}
+
+// String returns the host's address in dotted decimal notation.
+func (h *Host) String() string {
+	return addrString(*h.address)
+}
+
 func (h *Host) Unpack() []NetworkObject {
 	result := make([]NetworkObject, 0)
 	result = append(result,
@@ -61,3 +70,38 @@ func (h *Host) Contains(obj NetworkUnpacker) bool {
 	}
 	return true
 }
+
+// Address returns the host's address in dotted form.
+func (h *Host) Address() string {
+	return addrString(*h.address)
+}
+
+func (h *Host) Comment() string {
+	return h.comment
+}
+
+// WithName returns a copy of the host with a new name. Copies keep the UID
+// of the original, so they can replace it with a store's Update.
+func (h *Host) WithName(name string) *Host {
+	c := *h
+	c.name = name
+	return &c
+}
+
+// WithAddress returns a copy of the host with a new address.
+func (h *Host) WithAddress(addr string) (*Host, error) {
+	address, err := ip.NewAddress(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host address: %v", err)
+	}
+	c := *h
+	c.address = address
+	return &c, nil
+}
+
+// WithComment returns a copy of the host with a new comment.
+func (h *Host) WithComment(comment string) *Host {
+	c := *h
+	c.comment = comment
+	return &c
+}
@@ -0,0 +1,326 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// identityNamespace namespaces every stable UID so they can't collide with
+// UIDs built the same way by other tools.
+var identityNamespace = uuid.MustParse("6f1c2d7e-3b8a-4c55-9e0f-5a7d2b91c4e3")
+
+// Identifier is implemented by objects that can be given a stable UID.
+//
+// Constructors give every object a random UID, so importing the same firewall
+// twice gives different UIDs. Identify replaces it with one derived from the
+// node the object was pulled from, its kind and the vendor's name for it, or
+// its content if it doesn't have a name. Importing the same configuration
+// again then gives the same UIDs, which keeps diffs and links stable.
+//
+// Identify changes the UID, so it must be called before the object is put in
+// a store. Containers identify their members first, since their content is
+// made up of their members' UIDs.
+type Identifier interface {
+	UID() string
+	Identify(node string)
+}
+
+// StableUID returns the UID of an object of kind on node. name is the
+// vendor's name for the object, if empty the UID is derived from content.
+// Two anonymous objects of the same kind and content get the same UID.
+func StableUID(node, kind, name, content string) string {
+	key := "name:" + name
+	if name == "" {
+		key = "content:" + content
+	}
+	return uuid.NewSHA1(identityNamespace, []byte(strings.Join([]string{node, kind, key}, "\x00"))).String()
+}
+
+// memberKey returns the sorted UIDs of a set of members, so that the content
+// of a container doesn't depend on the order its members were added in.
+func memberKey(uids []string) string {
+	sorted := make([]string, len(uids))
+	copy(sorted, uids)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+func (h *Host) Identify(node string) {
+	h.uid = StableUID(node, "host", h.name, h.String())
+}
+
+func (n *Network) Identify(node string) {
+	n.uid = StableUID(node, "network", n.name, fmt.Sprintf("%s/%s", addrString(*n.address), addrString(*n.mask)))
+}
+
+func (r *Range) Identify(node string) {
+	r.uid = StableUID(node, "range", r.name, r.String())
+}
+
+func (f *FQDN) Identify(node string) {
+	f.uid = StableUID(node, "fqdn", f.name, f.String())
+}
+
+func (w *Wildcard) Identify(node string) {
+	w.uid = StableUID(node, "wildcard", w.name, w.String())
+}
+
+func (r *Region) Identify(node string) {
+	r.uid = StableUID(node, "region", r.name, r.String())
+}
+
+// Identify gives the group and, recursively, every member and excluded group
+// a stable UID.
+func (g *Group) Identify(node string) {
+	g.identify(node, make(map[*Group]bool))
+}
+
+func (g *Group) identify(node string, seen map[*Group]bool) {
+	if seen[g] {
+		return
+	}
+	seen[g] = true
+
+	members := make([]string, 0)
+	for _, h := range g.hosts {
+		h.Identify(node)
+		members = append(members, h.uid)
+	}
+	for _, n := range g.networks {
+		n.Identify(node)
+		members = append(members, n.uid)
+	}
+	for _, r := range g.ranges {
+		r.Identify(node)
+		members = append(members, r.uid)
+	}
+	for _, f := range g.fqdns {
+		f.Identify(node)
+		members = append(members, f.uid)
+	}
+	for _, w := range g.wildcards {
+		w.Identify(node)
+		members = append(members, w.uid)
+	}
+	for _, r := range g.regions {
+		r.Identify(node)
+		members = append(members, r.uid)
+	}
+	for _, sub := range g.groups {
+		sub.identify(node, seen)
+		members = append(members, sub.uid)
+	}
+	excluded := make([]string, 0)
+	for _, ex := range g.excluded {
+		ex.identify(node, seen)
+		excluded = append(excluded, ex.uid)
+	}
+	content := fmt.Sprintf("%s except %s negated %t", memberKey(members), memberKey(excluded), g.negated)
+	g.uid = StableUID(node, "group", g.name, content)
+}
+
+func (p *Port) Identify(node string) {
+	p.uid = StableUID(node, "port", p.name, p.String())
+}
+
+func (pr *PortRange) Identify(node string) {
+	pr.uid = StableUID(node, "port-range", pr.name, pr.String())
+}
+
+func (s *Service) Identify(node string) {
+	s.uid = StableUID(node, "service", s.name, s.String())
+}
+
+// Identify gives the port group and, recursively, every member a stable UID.
+func (pg *PortGroup) Identify(node string) {
+	pg.identify(node, make(map[*PortGroup]bool))
+}
+
+func (pg *PortGroup) identify(node string, seen map[*PortGroup]bool) {
+	if seen[pg] {
+		return
+	}
+	seen[pg] = true
+
+	members := make([]string, 0)
+	for _, p := range pg.ports {
+		p.Identify(node)
+		members = append(members, p.uid)
+	}
+	for _, r := range pg.ranges {
+		r.Identify(node)
+		members = append(members, r.uid)
+	}
+	for _, s := range pg.services {
+		s.Identify(node)
+		members = append(members, s.uid)
+	}
+	for _, sub := range pg.groups {
+		sub.identify(node, seen)
+		members = append(members, sub.uid)
+	}
+	pg.uid = StableUID(node, "port-group", pg.name, memberKey(members))
+}
+
+func (i *Interface) Identify(node string) {
+	i.uid = StableUID(node, "interface", i.name, "")
+}
+
+// Identify gives the zone and its interfaces a stable UID.
+func (z *Zone) Identify(node string) {
+	members := make([]string, 0)
+	for _, i := range z.interfaces {
+		i.Identify(node)
+		members = append(members, i.uid)
+	}
+	z.uid = StableUID(node, "zone", z.name, memberKey(members))
+}
+
+// Identify gives the application and its default ports a stable UID.
+func (a *Application) Identify(node string) {
+	a.defaults.Identify(node)
+	a.uid = StableUID(node, "application", a.name, a.defaults.uid)
+}
+
+func (u *User) Identify(node string) {
+	u.uid = StableUID(node, "user", u.name, "")
+}
+
+// Identify gives the user group and, recursively, every member a stable UID.
+func (ug *UserGroup) Identify(node string) {
+	ug.identify(node, make(map[*UserGroup]bool))
+}
+
+func (ug *UserGroup) identify(node string, seen map[*UserGroup]bool) {
+	if seen[ug] {
+		return
+	}
+	seen[ug] = true
+
+	members := make([]string, 0)
+	for _, u := range ug.users {
+		u.Identify(node)
+		members = append(members, u.uid)
+	}
+	for _, sub := range ug.groups {
+		sub.identify(node, seen)
+		members = append(members, sub.uid)
+	}
+	ug.uid = StableUID(node, "user-group", ug.name, memberKey(members))
+}
+
+func (s *Schedule) Identify(node string) {
+	parts := []string{s.location.String()}
+	for _, w := range s.windows {
+		parts = append(parts, fmt.Sprintf("%v %s-%s", w.Days, w.Start, w.End))
+	}
+	for _, r := range s.ranges {
+		parts = append(parts, fmt.Sprintf("%s-%s", r.Start.UTC(), r.End.UTC()))
+	}
+	s.uid = StableUID(node, "schedule", s.name, strings.Join(parts, ";"))
+}
+
+// Identify gives the rule and every object it references a stable UID.
+// Rules without a vendor name are identified by what they match and their
+// action, not their number, so reordering them doesn't change their UIDs.
+// Identical unnamed rules get the same UID, use IdentifyRules to identify the
+// rules of a node.
+func (r *Rule) Identify(node string) {
+	r.uid = StableUID(node, "rule", r.name, r.content(node))
+}
+
+// IdentifyRules identifies every rule of a node like Identify, but gives
+// unnamed rules with identical content, i.e. a duplicate shadowed rule,
+// distinct UIDs: in rule number order, every such rule after the first has
+// its occurrence added to its content.
+func IdentifyRules(node string, rules []*Rule) {
+	ordered := make([]*Rule, len(rules))
+	copy(ordered, rules)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].number < ordered[j].number
+	})
+
+	seen := make(map[string]int)
+	for _, r := range ordered {
+		content := r.content(node)
+		if r.name == "" {
+			seen[content]++
+			if n := seen[content]; n > 1 {
+				content = fmt.Sprintf("%s;occurrence %d", content, n)
+			}
+		}
+		r.uid = StableUID(node, "rule", r.name, content)
+	}
+}
+
+// content identifies the objects the rule references and returns what the
+// rule matches and its action.
+func (r *Rule) content(node string) string {
+	parts := make([]string, 0)
+	if r.source != nil {
+		r.source.Identify(node)
+		parts = append(parts, "src "+r.source.uid)
+	}
+	if r.destination != nil {
+		r.destination.Identify(node)
+		parts = append(parts, "dst "+r.destination.uid)
+	}
+	if r.port != nil {
+		r.port.Identify(node)
+		parts = append(parts, "svc "+r.port.uid)
+	}
+	parts = append(parts, fmt.Sprintf("action %t", r.action))
+
+	from := make([]string, 0)
+	for _, z := range r.fromZones {
+		z.Identify(node)
+		from = append(from, z.uid)
+	}
+	to := make([]string, 0)
+	for _, z := range r.toZones {
+		z.Identify(node)
+		to = append(to, z.uid)
+	}
+	apps := make([]string, 0)
+	for _, a := range r.applications {
+		a.Identify(node)
+		apps = append(apps, a.uid)
+	}
+	users := make([]string, 0)
+	for _, u := range r.users {
+		u.Identify(node)
+		users = append(users, u.uid)
+	}
+	for _, ug := range r.userGroups {
+		ug.Identify(node)
+		users = append(users, ug.uid)
+	}
+	parts = append(parts, "from "+memberKey(from), "to "+memberKey(to), "app "+memberKey(apps), "user "+memberKey(users))
+	if r.schedule != nil {
+		r.schedule.Identify(node)
+		parts = append(parts, "schedule "+r.schedule.uid)
+	}
+	return strings.Join(parts, ";")
+}
+
+// Identify gives the NAT rule and every group it references a stable UID.
+func (n *NATRule) Identify(node string) {
+	parts := []string{n.natType.String()}
+	for _, g := range []*Group{n.source, n.destination, n.translatedSource, n.translatedDestination} {
+		if g == nil {
+			parts = append(parts, "-")
+			continue
+		}
+		g.Identify(node)
+		parts = append(parts, g.uid)
+	}
+	if n.service != nil {
+		n.service.Identify(node)
+		parts = append(parts, n.service.uid)
+	}
+	parts = append(parts, fmt.Sprintf("%d", n.translatedPort))
+	n.uid = StableUID(node, "nat-rule", n.name, strings.Join(parts, ";"))
+}
@@ -0,0 +1,97 @@
+package core
+
+import "testing"
+
+func TestIdentify(t *testing.T) {
+	// build returns a rule as a puller would on every import, with members
+	// added in the given order and a new anonymous host each time.
+	build := func(reversed bool) *Rule {
+		web, _ := NewHost("web", "10.0.0.1", "")
+		anon, _ := NewHost("", "10.0.0.2", "")
+		dst := NewGroup("", "")
+		members := []*Host{web, anon}
+		if reversed {
+			members = []*Host{anon, web}
+		}
+		for _, h := range members {
+			if err := dst.Add(h); err != nil {
+				t.Fatalf("failed to add host: %v", err)
+			}
+		}
+		https, _ := NewPort("https", 443, "tcp", "")
+		svc := NewPortGroup("svc", "")
+		if err := svc.Add(https); err != nil {
+			t.Fatalf("failed to add port: %v", err)
+		}
+		return NewRule(10, NewGroup("any", ""), dst, svc, true, "")
+	}
+
+	first := build(false)
+	first.Identify("fw01")
+	second := build(true)
+	second.Identify("fw01")
+	other := build(false)
+	other.Identify("fw02")
+
+	if first.UID() != second.UID() {
+		t.Fatalf("same rule got different UIDs: %s, %s", first.UID(), second.UID())
+	}
+	if first.Destination().UID() != second.Destination().UID() {
+		t.Fatalf("same anonymous group got different UIDs")
+	}
+	if first.UID() == other.UID() {
+		t.Fatalf("rules on different nodes got the same UID")
+	}
+
+	// Reordering doesn't change a rule's UID, changing what it matches does.
+	moved := build(false).WithNumber(20)
+	moved.Identify("fw01")
+	if moved.UID() != first.UID() {
+		t.Fatalf("renumbering changed the UID")
+	}
+	denied := build(false).WithAction(false)
+	denied.Identify("fw01")
+	if denied.UID() == first.UID() {
+		t.Fatalf("deny rule got the same UID as the permit rule")
+	}
+
+	// Named objects keep their UID when their content changes.
+	web, _ := NewHost("web", "10.0.0.1", "")
+	web.Identify("fw01")
+	readdressed, _ := NewHost("web", "10.0.0.9", "")
+	readdressed.Identify("fw01")
+	if web.UID() != readdressed.UID() {
+		t.Fatalf("changing a named host's address changed its UID")
+	}
+}
+
+func TestIdentifyRules(t *testing.T) {
+	build := func(number int) *Rule {
+		dst, _ := NewHost("", "10.0.0.1", "")
+		grp := NewGroup("", "")
+		if err := grp.Add(dst); err != nil {
+			t.Fatalf("failed to add host: %v", err)
+		}
+		return NewRule(number, NewGroup("any", ""), grp, NewPortGroup("svc", ""), true, "")
+	}
+
+	// Rule 20 duplicates rule 10 and is shadowed by it.
+	rules := []*Rule{build(20), build(10), NewNamedRule("web", 30, NewGroup("any", ""), NewGroup("", ""), NewPortGroup("svc", ""), true, "")}
+	IdentifyRules("fw01", rules)
+	if rules[0].UID() == rules[1].UID() {
+		t.Fatalf("identical unnamed rules got the same UID: %s", rules[0].UID())
+	}
+
+	// The first occurrence keeps the UID Identify gives it, and importing
+	// the same rules again gives the same UIDs.
+	single := build(10)
+	single.Identify("fw01")
+	if rules[1].UID() != single.UID() {
+		t.Fatalf("first occurrence changed UID: %s, %s", rules[1].UID(), single.UID())
+	}
+	again := []*Rule{build(10), build(20)}
+	IdentifyRules("fw01", again)
+	if again[0].UID() != rules[1].UID() || again[1].UID() != rules[0].UID() {
+		t.Fatalf("reimport gave different UIDs")
+	}
+}
@@ -0,0 +1,869 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Neffats/ip"
+)
+
+var (
+	ErrUnknownReference = errors.New("reference to unknown group")
+)
+
+// JSON encoding of the core types.
+//
+// Every object is encoded with its UID, addresses in dotted or CIDR form and
+// protocols by name. Groups encode their own members inline but reference
+// nested and excluded groups by UID. Decoding a group on its own leaves those
+// references as placeholders that only carry the UID; decode an Export to
+// have them linked to the groups they refer to.
+
+type hostJSON struct {
+	UID     string `json:"uid"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Comment string `json:"comment,omitempty"`
+}
+
+func (h *Host) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hostJSON{UID: h.uid, Name: h.name, Address: addrString(*h.address), Comment: h.comment})
+}
+
+func (h *Host) UnmarshalJSON(data []byte) error {
+	var v hostJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	decoded, err := NewHost(v.Name, v.Address, v.Comment)
+	if err != nil {
+		return fmt.Errorf("failed to decode host: %v", err)
+	}
+	*h = *decoded
+	h.uid = keepUID(v.UID, h.uid)
+	return nil
+}
+
+// keepUID returns the decoded UID, or the generated one if there wasn't any.
+func keepUID(decoded, generated string) string {
+	if decoded == "" {
+		return generated
+	}
+	return decoded
+}
+
+type networkJSON struct {
+	UID     string `json:"uid"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// cidrString returns the network in CIDR notation, or address/mask if the
+// mask isn't contiguous.
+func (n *Network) cidrString() string {
+	mask := uint32(*n.mask)
+	prefix := bits.LeadingZeros32(^mask)
+	if uint32(prefixMask(prefix)) != mask {
+		return fmt.Sprintf("%s/%s", addrString(*n.address), addrString(*n.mask))
+	}
+	return fmt.Sprintf("%s/%d", addrString(*n.address), prefix)
+}
+
+func (n *Network) MarshalJSON() ([]byte, error) {
+	return json.Marshal(networkJSON{UID: n.uid, Name: n.name, Address: n.cidrString(), Comment: n.comment})
+}
+
+func (n *Network) UnmarshalJSON(data []byte) error {
+	var v networkJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	parts := strings.SplitN(v.Address, "/", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("failed to decode network: address isn't in CIDR form: %s", v.Address)
+	}
+	mask := parts[1]
+	if !strings.Contains(mask, ".") {
+		prefix, err := strconv.Atoi(mask)
+		if err != nil || prefix < 0 || prefix > 32 {
+			return fmt.Errorf("failed to decode network: invalid prefix length: %s", mask)
+		}
+		mask = addrString(prefixMask(prefix))
+	}
+	decoded, err := NewNetwork(v.Name, parts[0], mask, v.Comment)
+	if err != nil {
+		return fmt.Errorf("failed to decode network: %v", err)
+	}
+	*n = *decoded
+	n.uid = keepUID(v.UID, n.uid)
+	return nil
+}
+
+type rangeJSON struct {
+	UID     string `json:"uid"`
+	Name    string `json:"name"`
+	Start   string `json:"start"`
+	End     string `json:"end"`
+	Comment string `json:"comment,omitempty"`
+}
+
+func (r *Range) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rangeJSON{
+		UID:     r.uid,
+		Name:    r.name,
+		Start:   addrString(*r.startAddress),
+		End:     addrString(*r.endAddress),
+		Comment: r.comment,
+	})
+}
+
+func (r *Range) UnmarshalJSON(data []byte) error {
+	var v rangeJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	decoded, err := NewRange(v.Name, v.Start, v.End, v.Comment)
+	if err != nil {
+		return fmt.Errorf("failed to decode range: %v", err)
+	}
+	*r = *decoded
+	r.uid = keepUID(v.UID, r.uid)
+	return nil
+}
+
+type fqdnJSON struct {
+	UID       string   `json:"uid"`
+	Name      string   `json:"name"`
+	FQDN      string   `json:"fqdn"`
+	Addresses []string `json:"addresses,omitempty"`
+	Comment   string   `json:"comment,omitempty"`
+}
+
+func (f *FQDN) MarshalJSON() ([]byte, error) {
+	v := fqdnJSON{UID: f.uid, Name: f.name, FQDN: f.fqdn, Comment: f.comment}
+	for _, a := range f.addresses {
+		v.Addresses = append(v.Addresses, addrString(a))
+	}
+	return json.Marshal(v)
+}
+
+func (f *FQDN) UnmarshalJSON(data []byte) error {
+	var v fqdnJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	decoded := NewFQDN(v.Name, v.FQDN, v.Comment)
+	for _, a := range v.Addresses {
+		addr, err := ip.NewAddress(a)
+		if err != nil {
+			return fmt.Errorf("failed to decode fqdn: invalid address: %v", err)
+		}
+		decoded.addresses = append(decoded.addresses, *addr)
+	}
+	*f = *decoded
+	f.uid = keepUID(v.UID, f.uid)
+	return nil
+}
+
+type wildcardJSON struct {
+	UID      string `json:"uid"`
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	Wildcard string `json:"wildcard"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+func (w *Wildcard) MarshalJSON() ([]byte, error) {
+	return json.Marshal(wildcardJSON{
+		UID:      w.uid,
+		Name:     w.name,
+		Address:  addrString(*w.address),
+		Wildcard: addrString(*w.wildcard),
+		Comment:  w.comment,
+	})
+}
+
+func (w *Wildcard) UnmarshalJSON(data []byte) error {
+	var v wildcardJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	decoded, err := NewWildcard(v.Name, v.Address, v.Wildcard, v.Comment)
+	if err != nil {
+		return fmt.Errorf("failed to decode wildcard: %v", err)
+	}
+	*w = *decoded
+	w.uid = keepUID(v.UID, w.uid)
+	return nil
+}
+
+// Regions are encoded by code only, they have to be resolved again after
+// decoding.
+type regionJSON struct {
+	UID     string `json:"uid"`
+	Name    string `json:"name"`
+	Code    string `json:"code"`
+	Comment string `json:"comment,omitempty"`
+}
+
+func (r *Region) MarshalJSON() ([]byte, error) {
+	return json.Marshal(regionJSON{UID: r.uid, Name: r.name, Code: r.code, Comment: r.comment})
+}
+
+func (r *Region) UnmarshalJSON(data []byte) error {
+	var v regionJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*r = *NewRegion(v.Name, v.Code, v.Comment)
+	r.uid = keepUID(v.UID, r.uid)
+	return nil
+}
+
+type groupJSON struct {
+	UID       string      `json:"uid"`
+	Name      string      `json:"name"`
+	Hosts     []*Host     `json:"hosts,omitempty"`
+	Networks  []*Network  `json:"networks,omitempty"`
+	Ranges    []*Range    `json:"ranges,omitempty"`
+	FQDNs     []*FQDN     `json:"fqdns,omitempty"`
+	Wildcards []*Wildcard `json:"wildcards,omitempty"`
+	Regions   []*Region   `json:"regions,omitempty"`
+	Groups    []string    `json:"groups,omitempty"`
+	Excluded  []string    `json:"excluded,omitempty"`
+	Negated   bool        `json:"negated,omitempty"`
+	Comment   string      `json:"comment,omitempty"`
+}
+
+func (g *Group) MarshalJSON() ([]byte, error) {
+	v := groupJSON{
+		UID:       g.uid,
+		Name:      g.name,
+		Hosts:     g.hosts,
+		Networks:  g.networks,
+		Ranges:    g.ranges,
+		FQDNs:     g.fqdns,
+		Wildcards: g.wildcards,
+		Regions:   g.regions,
+		Negated:   g.negated,
+		Comment:   g.comment,
+	}
+	for _, grp := range g.groups {
+		v.Groups = append(v.Groups, grp.uid)
+	}
+	for _, grp := range g.excluded {
+		v.Excluded = append(v.Excluded, grp.uid)
+	}
+	return json.Marshal(v)
+}
+
+func (g *Group) UnmarshalJSON(data []byte) error {
+	var v groupJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	decoded := NewGroup(v.Name, v.Comment)
+	decoded.uid = keepUID(v.UID, decoded.uid)
+	decoded.negated = v.Negated
+	members := make([]interface{}, 0)
+	for _, h := range v.Hosts {
+		members = append(members, h)
+	}
+	for _, n := range v.Networks {
+		members = append(members, n)
+	}
+	for _, r := range v.Ranges {
+		members = append(members, r)
+	}
+	for _, f := range v.FQDNs {
+		members = append(members, f)
+	}
+	for _, w := range v.Wildcards {
+		members = append(members, w)
+	}
+	for _, r := range v.Regions {
+		members = append(members, r)
+	}
+	for _, m := range members {
+		if err := decoded.Add(m); err != nil {
+			return fmt.Errorf("failed to decode group %s: %v", v.Name, err)
+		}
+	}
+	// Placeholders until linked by an Export.
+	for _, uid := range v.Groups {
+		decoded.groups = append(decoded.groups, &Group{uid: uid})
+	}
+	for _, uid := range v.Excluded {
+		decoded.excluded = append(decoded.excluded, &Group{uid: uid})
+	}
+	*g = *decoded
+	return nil
+}
+
+// link replaces the group's nested and excluded groups with the groups of
+// the same UID.
+func (g *Group) link(byUID map[string]*Group) error {
+	refs := g.groups
+	g.groups = make([]*Group, 0, len(refs))
+	for _, ref := range refs {
+		grp, ok := byUID[ref.uid]
+		if !ok {
+			return fmt.Errorf("failed to link group %s: %s: %w", g.name, ref.uid, ErrUnknownReference)
+		}
+		g.addGroup(grp)
+	}
+	for i, ref := range g.excluded {
+		grp, ok := byUID[ref.uid]
+		if !ok {
+			return fmt.Errorf("failed to link group %s: %s: %w", g.name, ref.uid, ErrUnknownReference)
+		}
+		g.excluded[i] = grp
+	}
+	return nil
+}
+
+type portJSON struct {
+	UID      string `json:"uid"`
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+	Port     uint   `json:"port"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+func (p *Port) MarshalJSON() ([]byte, error) {
+	return json.Marshal(portJSON{UID: p.uid, Name: p.name, Protocol: Proto2String(p.protocol), Port: p.number, Comment: p.comment})
+}
+
+func (p *Port) UnmarshalJSON(data []byte) error {
+	var v portJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	decoded, err := NewPort(v.Name, v.Port, v.Protocol, v.Comment)
+	if err != nil {
+		return fmt.Errorf("failed to decode port: %v", err)
+	}
+	*p = *decoded
+	p.uid = keepUID(v.UID, p.uid)
+	return nil
+}
+
+type portRangeJSON struct {
+	UID      string `json:"uid"`
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+	Start    uint   `json:"start"`
+	End      uint   `json:"end"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+func (pr *PortRange) MarshalJSON() ([]byte, error) {
+	return json.Marshal(portRangeJSON{
+		UID:      pr.uid,
+		Name:     pr.name,
+		Protocol: Proto2String(pr.protocol),
+		Start:    pr.start,
+		End:      pr.end,
+		Comment:  pr.comment,
+	})
+}
+
+func (pr *PortRange) UnmarshalJSON(data []byte) error {
+	var v portRangeJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	decoded, err := NewPortRange(v.Name, v.Start, v.End, v.Protocol, v.Comment)
+	if err != nil {
+		return fmt.Errorf("failed to decode port range: %v", err)
+	}
+	*pr = *decoded
+	pr.uid = keepUID(v.UID, pr.uid)
+	return nil
+}
+
+// Services are encoded in the notation of ParseService.
+type serviceJSON struct {
+	UID     string `json:"uid"`
+	Name    string `json:"name"`
+	Service string `json:"service"`
+	Comment string `json:"comment,omitempty"`
+}
+
+func (s *Service) MarshalJSON() ([]byte, error) {
+	return json.Marshal(serviceJSON{UID: s.uid, Name: s.name, Service: s.String(), Comment: s.comment})
+}
+
+func (s *Service) UnmarshalJSON(data []byte) error {
+	var v serviceJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	decoded, err := ParseService(v.Name, v.Service, v.Comment)
+	if err != nil {
+		return fmt.Errorf("failed to decode service: %v", err)
+	}
+	*s = *decoded
+	s.uid = keepUID(v.UID, s.uid)
+	return nil
+}
+
+type portGroupJSON struct {
+	UID      string       `json:"uid"`
+	Name     string       `json:"name"`
+	Ports    []*Port      `json:"ports,omitempty"`
+	Ranges   []*PortRange `json:"ranges,omitempty"`
+	Services []*Service   `json:"services,omitempty"`
+	Groups   []string     `json:"groups,omitempty"`
+	Comment  string       `json:"comment,omitempty"`
+}
+
+func (pg *PortGroup) MarshalJSON() ([]byte, error) {
+	v := portGroupJSON{
+		UID:      pg.uid,
+		Name:     pg.name,
+		Ports:    pg.ports,
+		Ranges:   pg.ranges,
+		Services: pg.services,
+		Comment:  pg.comment,
+	}
+	for _, grp := range pg.groups {
+		v.Groups = append(v.Groups, grp.uid)
+	}
+	return json.Marshal(v)
+}
+
+func (pg *PortGroup) UnmarshalJSON(data []byte) error {
+	var v portGroupJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	decoded := NewPortGroup(v.Name, v.Comment)
+	decoded.uid = keepUID(v.UID, decoded.uid)
+	members := make([]interface{}, 0)
+	for _, p := range v.Ports {
+		members = append(members, p)
+	}
+	for _, r := range v.Ranges {
+		members = append(members, r)
+	}
+	for _, s := range v.Services {
+		members = append(members, s)
+	}
+	for _, m := range members {
+		if err := decoded.Add(m); err != nil {
+			return fmt.Errorf("failed to decode port group %s: %v", v.Name, err)
+		}
+	}
+	// Placeholders until linked by an Export.
+	for _, uid := range v.Groups {
+		decoded.groups = append(decoded.groups, &PortGroup{uid: uid})
+	}
+	*pg = *decoded
+	return nil
+}
+
+// link replaces the group's nested groups with the groups of the same UID.
+func (pg *PortGroup) link(byUID map[string]*PortGroup) error {
+	refs := pg.groups
+	pg.groups = make([]*PortGroup, 0, len(refs))
+	for _, ref := range refs {
+		grp, ok := byUID[ref.uid]
+		if !ok {
+			return fmt.Errorf("failed to link port group %s: %s: %w", pg.name, ref.uid, ErrUnknownReference)
+		}
+		pg.addPortGroup(grp)
+	}
+	return nil
+}
+
+type interfaceJSON struct {
+	UID     string `json:"uid"`
+	Name    string `json:"name"`
+	Comment string `json:"comment,omitempty"`
+}
+
+type zoneJSON struct {
+	UID        string          `json:"uid"`
+	Name       string          `json:"name"`
+	Interfaces []interfaceJSON `json:"interfaces,omitempty"`
+	Comment    string          `json:"comment,omitempty"`
+}
+
+func (z *Zone) MarshalJSON() ([]byte, error) {
+	v := zoneJSON{UID: z.uid, Name: z.name, Comment: z.comment}
+	for _, i := range z.interfaces {
+		v.Interfaces = append(v.Interfaces, interfaceJSON{UID: i.uid, Name: i.name, Comment: i.comment})
+	}
+	return json.Marshal(v)
+}
+
+func (z *Zone) UnmarshalJSON(data []byte) error {
+	var v zoneJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	decoded := NewZone(v.Name, v.Comment)
+	decoded.uid = keepUID(v.UID, decoded.uid)
+	for _, i := range v.Interfaces {
+		iface := NewInterface(i.Name, i.Comment)
+		iface.uid = keepUID(i.UID, iface.uid)
+		decoded.Add(iface)
+	}
+	*z = *decoded
+	return nil
+}
+
+type applicationJSON struct {
+	UID      string     `json:"uid"`
+	Name     string     `json:"name"`
+	Defaults *PortGroup `json:"defaults,omitempty"`
+	Comment  string     `json:"comment,omitempty"`
+}
+
+func (a *Application) MarshalJSON() ([]byte, error) {
+	v := applicationJSON{UID: a.uid, Name: a.name, Comment: a.comment}
+	if len(a.defaults.ports)+len(a.defaults.ranges)+len(a.defaults.services)+len(a.defaults.groups) > 0 {
+		v.Defaults = a.defaults
+	}
+	return json.Marshal(v)
+}
+
+func (a *Application) UnmarshalJSON(data []byte) error {
+	var v applicationJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	decoded := NewApplication(v.Name, v.Comment)
+	decoded.uid = keepUID(v.UID, decoded.uid)
+	if v.Defaults != nil {
+		decoded.defaults = v.Defaults
+	}
+	*a = *decoded
+	return nil
+}
+
+type userJSON struct {
+	UID     string `json:"uid"`
+	Name    string `json:"name"`
+	Comment string `json:"comment,omitempty"`
+}
+
+func (u *User) MarshalJSON() ([]byte, error) {
+	return json.Marshal(userJSON{UID: u.uid, Name: u.name, Comment: u.comment})
+}
+
+func (u *User) UnmarshalJSON(data []byte) error {
+	var v userJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*u = *NewUser(v.Name, v.Comment)
+	u.uid = keepUID(v.UID, u.uid)
+	return nil
+}
+
+// User groups are encoded with their nested groups inline.
+type userGroupJSON struct {
+	UID     string       `json:"uid"`
+	Name    string       `json:"name"`
+	Users   []*User      `json:"users,omitempty"`
+	Groups  []*UserGroup `json:"groups,omitempty"`
+	Comment string       `json:"comment,omitempty"`
+}
+
+func (g *UserGroup) MarshalJSON() ([]byte, error) {
+	return json.Marshal(userGroupJSON{UID: g.uid, Name: g.name, Users: g.users, Groups: g.groups, Comment: g.comment})
+}
+
+func (g *UserGroup) UnmarshalJSON(data []byte) error {
+	var v userGroupJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	decoded := NewUserGroup(v.Name, v.Comment)
+	decoded.uid = keepUID(v.UID, decoded.uid)
+	for _, u := range v.Users {
+		if err := decoded.Add(u); err != nil {
+			return fmt.Errorf("failed to decode user group %s: %v", v.Name, err)
+		}
+	}
+	for _, grp := range v.Groups {
+		if err := decoded.Add(grp); err != nil {
+			return fmt.Errorf("failed to decode user group %s: %v", v.Name, err)
+		}
+	}
+	*g = *decoded
+	return nil
+}
+
+type windowJSON struct {
+	Days  []string `json:"days"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+type dateRangeJSON struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+type scheduleJSON struct {
+	UID      string          `json:"uid"`
+	Name     string          `json:"name"`
+	TimeZone string          `json:"timezone"`
+	Windows  []windowJSON    `json:"windows,omitempty"`
+	Ranges   []dateRangeJSON `json:"ranges,omitempty"`
+	Comment  string          `json:"comment,omitempty"`
+}
+
+// clockString returns an offset from midnight in HH:MM format.
+func clockString(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
+
+func (s *Schedule) MarshalJSON() ([]byte, error) {
+	v := scheduleJSON{UID: s.uid, Name: s.name, TimeZone: s.location.String(), Comment: s.comment}
+	for _, w := range s.windows {
+		wj := windowJSON{Start: clockString(w.Start), End: clockString(w.End)}
+		for _, d := range w.Days {
+			wj.Days = append(wj.Days, strings.ToLower(d.String()))
+		}
+		v.Windows = append(v.Windows, wj)
+	}
+	for _, r := range s.ranges {
+		v.Ranges = append(v.Ranges, dateRangeJSON{Start: r.Start, End: r.End})
+	}
+	return json.Marshal(v)
+}
+
+func (s *Schedule) UnmarshalJSON(data []byte) error {
+	var v scheduleJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	decoded, err := NewSchedule(v.Name, v.TimeZone, v.Comment)
+	if err != nil {
+		return fmt.Errorf("failed to decode schedule: %v", err)
+	}
+	decoded.uid = keepUID(v.UID, decoded.uid)
+	for _, w := range v.Windows {
+		days := make([]time.Weekday, 0, len(w.Days))
+		for _, name := range w.Days {
+			day, err := parseWeekday(name)
+			if err != nil {
+				return fmt.Errorf("failed to decode schedule: %v", err)
+			}
+			days = append(days, day)
+		}
+		if err := decoded.AddWindow(days, w.Start, w.End); err != nil {
+			return fmt.Errorf("failed to decode schedule: %v", err)
+		}
+	}
+	for _, r := range v.Ranges {
+		if err := decoded.AddRange(r.Start, r.End); err != nil {
+			return fmt.Errorf("failed to decode schedule: %v", err)
+		}
+	}
+	*s = *decoded
+	return nil
+}
+
+func parseWeekday(name string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(d.String(), name) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid day: %s", name)
+}
+
+// Rules encode their groups inline, see Group for how nested groups are
+// referenced.
+type ruleJSON struct {
+	UID          string         `json:"uid"`
+	Name         string         `json:"name,omitempty"`
+	Number       int            `json:"number"`
+	Source       *Group         `json:"source"`
+	Destination  *Group         `json:"destination"`
+	Service      *PortGroup     `json:"service"`
+	Action       string         `json:"action"`
+	Comment      string         `json:"comment,omitempty"`
+	FromZones    []*Zone        `json:"from_zones,omitempty"`
+	ToZones      []*Zone        `json:"to_zones,omitempty"`
+	Applications []*Application `json:"applications,omitempty"`
+	Users        []*User        `json:"users,omitempty"`
+	UserGroups   []*UserGroup   `json:"user_groups,omitempty"`
+	Schedule     *Schedule      `json:"schedule,omitempty"`
+}
+
+func (r *Rule) MarshalJSON() ([]byte, error) {
+	action := "deny"
+	if r.action {
+		action = "permit"
+	}
+	return json.Marshal(ruleJSON{
+		UID:          r.uid,
+		Name:         r.name,
+		Number:       r.number,
+		Source:       r.source,
+		Destination:  r.destination,
+		Service:      r.port,
+		Action:       action,
+		Comment:      r.comment,
+		FromZones:    r.fromZones,
+		ToZones:      r.toZones,
+		Applications: r.applications,
+		Users:        r.users,
+		UserGroups:   r.userGroups,
+		Schedule:     r.schedule,
+	})
+}
+
+func (r *Rule) UnmarshalJSON(data []byte) error {
+	var v ruleJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	var action bool
+	switch v.Action {
+	case "permit":
+		action = true
+	case "deny":
+	default:
+		return fmt.Errorf("failed to decode rule: invalid action: %s", v.Action)
+	}
+	decoded := NewNamedRule(v.Name, v.Number, v.Source, v.Destination, v.Service, action, v.Comment)
+	decoded.uid = keepUID(v.UID, decoded.uid)
+	decoded.fromZones = v.FromZones
+	decoded.toZones = v.ToZones
+	decoded.applications = v.Applications
+	decoded.users = v.Users
+	decoded.userGroups = v.UserGroups
+	decoded.schedule = v.Schedule
+	*r = *decoded
+	return nil
+}
+
+// Export is a self contained set of rules along with every group nested
+// inside them, so that it can be decoded with its group references linked.
+type Export struct {
+	Groups     []*Group     `json:"groups"`
+	PortGroups []*PortGroup `json:"port_groups"`
+	Rules      []*Rule      `json:"rules"`
+}
+
+// NewExport returns an export of rules.
+func NewExport(rules []*Rule) *Export {
+	e := &Export{
+		Groups:     make([]*Group, 0),
+		PortGroups: make([]*PortGroup, 0),
+		Rules:      rules,
+	}
+	seen := make(map[*Group]bool)
+	seenPorts := make(map[*PortGroup]bool)
+	for _, r := range rules {
+		for _, grp := range []*Group{r.source, r.destination} {
+			if grp != nil {
+				e.addNested(grp, seen)
+			}
+		}
+		if r.port != nil {
+			e.addNestedPorts(r.port, seenPorts)
+		}
+		for _, app := range r.applications {
+			e.addNestedPorts(app.defaults, seenPorts)
+		}
+	}
+	return e
+}
+
+// addNested adds the groups nested in or excluded by grp.
+func (e *Export) addNested(grp *Group, seen map[*Group]bool) {
+	for _, nested := range append(grp.Groups(), grp.excluded...) {
+		if seen[nested] {
+			continue
+		}
+		seen[nested] = true
+		e.Groups = append(e.Groups, nested)
+		e.addNested(nested, seen)
+	}
+}
+
+// addNestedPorts adds the port groups nested in pg.
+func (e *Export) addNestedPorts(pg *PortGroup, seen map[*PortGroup]bool) {
+	for _, nested := range pg.groups {
+		if seen[nested] {
+			continue
+		}
+		seen[nested] = true
+		e.PortGroups = append(e.PortGroups, nested)
+		e.addNestedPorts(nested, seen)
+	}
+}
+
+// UnmarshalJSON decodes the export and links every group reference.
+// Returns ErrUnknownReference if a group isn't part of the export.
+func (e *Export) UnmarshalJSON(data []byte) error {
+	type export Export
+	var v export
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	groups := make(map[string]*Group)
+	all := make([]*Group, 0)
+	add := func(grp *Group) {
+		if grp == nil {
+			return
+		}
+		all = append(all, grp)
+		if _, ok := groups[grp.uid]; !ok {
+			groups[grp.uid] = grp
+		}
+	}
+	portGroups := make(map[string]*PortGroup)
+	allPorts := make([]*PortGroup, 0)
+	addPorts := func(pg *PortGroup) {
+		if pg == nil {
+			return
+		}
+		allPorts = append(allPorts, pg)
+		if _, ok := portGroups[pg.uid]; !ok {
+			portGroups[pg.uid] = pg
+		}
+	}
+	for _, grp := range v.Groups {
+		add(grp)
+	}
+	for _, pg := range v.PortGroups {
+		addPorts(pg)
+	}
+	for _, r := range v.Rules {
+		add(r.source)
+		add(r.destination)
+		addPorts(r.port)
+		for _, app := range r.applications {
+			addPorts(app.defaults)
+		}
+	}
+
+	for _, grp := range all {
+		if err := grp.link(groups); err != nil {
+			return err
+		}
+	}
+	for _, pg := range allPorts {
+		if err := pg.link(portGroups); err != nil {
+			return err
+		}
+	}
+	*e = Export(v)
+	return nil
+}
@@ -0,0 +1,136 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestObjectJSON(t *testing.T) {
+	host, _ := NewHost("web", "10.0.0.1", "web server")
+	network, _ := NewNetwork("lan", "10.0.0.0", "255.255.255.0", "")
+	sparse, _ := NewNetwork("sparse", "10.0.0.0", "255.0.255.0", "")
+	rng, _ := NewRange("pool", "10.0.0.10", "10.0.0.20", "")
+	port, _ := NewPort("https", 443, "tcp", "")
+	portRange, _ := NewPortRange("high", 1024, 65535, "udp", "")
+	service, _ := ParseService("dns", "udp/53 sport 1024-65535", "")
+
+	tests := []struct {
+		name string
+		obj  interface{}
+		into interface{}
+		want string
+	}{
+		{name: "Host", obj: host, into: &Host{}, want: `"address":"10.0.0.1"`},
+		{name: "Network", obj: network, into: &Network{}, want: `"address":"10.0.0.0/24"`},
+		{name: "Non-contiguous mask", obj: sparse, into: &Network{}, want: `"address":"10.0.0.0/255.0.255.0"`},
+		{name: "Range", obj: rng, into: &Range{}, want: `"start":"10.0.0.10","end":"10.0.0.20"`},
+		{name: "Port", obj: port, into: &Port{}, want: `"protocol":"tcp","port":443`},
+		{name: "Port range", obj: portRange, into: &PortRange{}, want: `"protocol":"udp","start":1024,"end":65535`},
+		{name: "Service", obj: service, into: &Service{}, want: `"service":"udp/53 sport 1024-65535"`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := json.Marshal(tc.obj)
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+			if !strings.Contains(string(data), tc.want) {
+				t.Fatalf("expected %s in %s", tc.want, data)
+			}
+			if err := json.Unmarshal(data, tc.into); err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+			again, err := json.Marshal(tc.into)
+			if err != nil {
+				t.Fatalf("failed to marshal decoded object: %v", err)
+			}
+			if string(again) != string(data) {
+				t.Fatalf("round trip changed the object\nbefore: %s\nafter: %s", data, again)
+			}
+		})
+	}
+}
+
+func TestExportJSON(t *testing.T) {
+	host, _ := NewHost("web", "10.0.0.1", "")
+	network, _ := NewNetwork("lan", "10.0.0.0", "255.255.255.0", "")
+	servers := NewGroup("servers", "")
+	if err := servers.Add(host); err != nil {
+		t.Fatalf("failed to add host: %v", err)
+	}
+	lan := NewGroup("lan", "")
+	if err := lan.Add(network); err != nil {
+		t.Fatalf("failed to add network: %v", err)
+	}
+	lan.Exclude(servers)
+	src := NewGroup("src", "")
+	if err := src.Add(lan); err != nil {
+		t.Fatalf("failed to add group: %v", err)
+	}
+	dst := NewGroup("dst", "")
+	if err := dst.Add(servers); err != nil {
+		t.Fatalf("failed to add group: %v", err)
+	}
+
+	https, _ := NewPort("https", 443, "tcp", "")
+	web := NewPortGroup("web", "")
+	if err := web.Add(https); err != nil {
+		t.Fatalf("failed to add port: %v", err)
+	}
+	svc := NewPortGroup("svc", "")
+	if err := svc.Add(web); err != nil {
+		t.Fatalf("failed to add port group: %v", err)
+	}
+
+	rule := NewNamedRule("allow-web", 1, src, dst, svc, true, "")
+	trust := NewZone("trust", "")
+	trust.Add(NewInterface("ethernet1/1", ""))
+	rule.AddFromZone(trust)
+	rule.AddApplication(NewApplication("ssl", ""))
+	rule.AddUser(NewUser("jsmith", ""))
+	schedule, err := NewSchedule("weekend", "UTC", "")
+	if err != nil {
+		t.Fatalf("failed to create schedule: %v", err)
+	}
+	if err := schedule.AddWindow([]time.Weekday{time.Saturday, time.Sunday}, "08:00", "18:00"); err != nil {
+		t.Fatalf("failed to add window: %v", err)
+	}
+	rule.SetSchedule(schedule)
+
+	data, err := json.Marshal(NewExport([]*Rule{rule}))
+	if err != nil {
+		t.Fatalf("failed to marshal export: %v", err)
+	}
+	var decoded Export
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal export: %v", err)
+	}
+	again, err := json.Marshal(&decoded)
+	if err != nil {
+		t.Fatalf("failed to marshal decoded export: %v", err)
+	}
+	if string(again) != string(data) {
+		t.Fatalf("round trip changed the export\nbefore: %s\nafter: %s", data, again)
+	}
+
+	got := decoded.Rules[0]
+	if got.Traffic().String() != rule.Traffic().String() {
+		t.Fatalf("want traffic: %s, got: %s", rule.Traffic(), got.Traffic())
+	}
+	if !got.MatchFromZone("trust") || got.MatchFromZone("untrust") || !got.MatchUser("jsmith") {
+		t.Fatalf("decoded rule lost its zones or users")
+	}
+	if !got.ActiveAt(time.Date(2024, time.March, 2, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("decoded rule lost its schedule")
+	}
+
+	// Without the export, nested groups can't be linked.
+	var broken Export
+	partial := []byte(`{"rules":[{"uid":"r","number":1,"source":{"uid":"s","name":"s","groups":["missing"]},"action":"deny"}]}`)
+	if err := json.Unmarshal(partial, &broken); !errors.Is(err, ErrUnknownReference) {
+		t.Fatalf("expected ErrUnknownReference, got: %v", err)
+	}
+}
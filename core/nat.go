@@ -0,0 +1,267 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Neffats/ip"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNATSizeMismatch = errors.New("real and mapped addresses aren't the same size")
+	ErrNATSingleMapped = errors.New("PAT needs a single mapped address")
+)
+
+// NATType is the kind of translation a NAT rule does.
+type NATType int
+
+const (
+	// StaticNAT maps real addresses one-to-one onto mapped addresses, in both
+	// directions.
+	StaticNAT NATType = iota
+	// DynamicNAT maps real source addresses onto a pool of mapped addresses.
+	DynamicNAT
+	// PAT maps real source addresses onto a single mapped address.
+	PAT
+	// TwiceNAT matches on both source and destination and can translate either.
+	TwiceNAT
+)
+
+var natTypes = [4]string{"static", "dynamic", "pat", "twice"}
+
+func (t NATType) String() string {
+	if t < 0 || int(t) > len(natTypes)-1 {
+		return ""
+	}
+	return natTypes[t]
+}
+
+// Flow is a single packet as seen by NAT. Port is the destination port, or
+// the ICMPPort of an ICMP packet.
+type Flow struct {
+	Source      ip.Address
+	Destination ip.Address
+	Protocol    int
+	Port        uint
+}
+
+func (f Flow) String() string {
+	return fmt.Sprintf("%s -> %s %s/%d", addrString(f.Source), addrString(f.Destination), Proto2String(f.Protocol), f.Port)
+}
+
+// NATRule is a representation of a firewall NAT rule.
+//
+// Rules are written from the inside out: source is the real address and
+// translatedSource the address it is mapped to on the way out. For static and
+// twice NAT, destination is the mapped address and translatedDestination the
+// real address it is translated to on the way in. Security rules are expected
+// to reference real addresses.
+type NATRule struct {
+	uid     string
+	name    string
+	number  int
+	natType NATType
+	// Original packet match. A nil group or port group matches anything.
+	source      *Group
+	destination *Group
+	service     *PortGroup
+	// Translations, nil or 0 when that part of the packet isn't translated.
+	translatedSource      *Group
+	translatedDestination *Group
+	translatedPort        uint
+	comment               string
+}
+
+// NewStaticNAT returns a NAT rule mapping real onto mapped one-to-one.
+// Outbound packets from real get a mapped source and inbound packets to
+// mapped get a real destination.
+func NewStaticNAT(name string, number int, real, mapped *Group, comment string) (*NATRule, error) {
+	if real.Flatten().Size() != mapped.Flatten().Size() {
+		return nil, fmt.Errorf("failed to create static NAT %s: %w", name, ErrNATSizeMismatch)
+	}
+	return newNATRule(name, number, StaticNAT, comment, func(n *NATRule) {
+		n.source = real
+		n.translatedSource = mapped
+	}), nil
+}
+
+// NewDynamicNAT returns a NAT rule mapping real source addresses onto the
+// addresses of pool.
+func NewDynamicNAT(name string, number int, real, pool *Group, comment string) *NATRule {
+	return newNATRule(name, number, DynamicNAT, comment, func(n *NATRule) {
+		n.source = real
+		n.translatedSource = pool
+	})
+}
+
+// NewPAT returns a NAT rule hiding real source addresses behind mapped,
+// which must be a single address.
+func NewPAT(name string, number int, real, mapped *Group, comment string) (*NATRule, error) {
+	if mapped.Flatten().Size() != 1 {
+		return nil, fmt.Errorf("failed to create PAT %s: %w", name, ErrNATSingleMapped)
+	}
+	return newNATRule(name, number, PAT, comment, func(n *NATRule) {
+		n.source = real
+		n.translatedSource = mapped
+	}), nil
+}
+
+// NewTwiceNAT returns a NAT rule that matches on source, destination and
+// service, and translates any of the source, destination and port.
+// Pass nil (or 0 for the port) for the parts that shouldn't be translated.
+func NewTwiceNAT(name string, number int, src, dst *Group, svc *PortGroup, translatedSrc, translatedDst *Group, translatedPort uint, comment string) *NATRule {
+	return newNATRule(name, number, TwiceNAT, comment, func(n *NATRule) {
+		n.source = src
+		n.destination = dst
+		n.service = svc
+		n.translatedSource = translatedSrc
+		n.translatedDestination = translatedDst
+		n.translatedPort = translatedPort
+	})
+}
+
+func newNATRule(name string, number int, natType NATType, comment string, set func(n *NATRule)) *NATRule {
+	uid := uuid.New()
+	n := &NATRule{
+		uid:     uid.String(),
+		name:    name,
+		number:  number,
+		natType: natType,
+		comment: comment,
+	}
+	set(n)
+	return n
+}
+
+func (n *NATRule) UID() string {
+	return n.uid
+}
+
+func (n *NATRule) Name() string {
+	return n.name
+}
+
+// Number returns the position of the rule in the NAT policy.
+func (n *NATRule) Number() int {
+	return n.number
+}
+
+func (n *NATRule) Type() NATType {
+	return n.natType
+}
+
+func (n *NATRule) Source() *Group {
+	return n.source
+}
+
+func (n *NATRule) Destination() *Group {
+	return n.destination
+}
+
+func (n *NATRule) Service() *PortGroup {
+	return n.service
+}
+
+func (n *NATRule) TranslatedSource() *Group {
+	return n.translatedSource
+}
+
+func (n *NATRule) TranslatedDestination() *Group {
+	return n.translatedDestination
+}
+
+func (n *NATRule) TranslatedPort() uint {
+	return n.translatedPort
+}
+
+func (n *NATRule) Comment() string {
+	return n.comment
+}
+
+// Translate returns the flow after NAT. It returns false if the rule doesn't
+// match the flow, in which case the flow is returned unchanged.
+func (n *NATRule) Translate(f Flow) (Flow, bool) {
+	src := AddressSet{{Start: f.Source, End: f.Source}}
+	dst := AddressSet{{Start: f.Destination, End: f.Destination}}
+
+	if n.natType == StaticNAT {
+		// Inbound traffic to the mapped addresses.
+		mapped := n.translatedSource.Flatten()
+		if mapped.Contains(dst) {
+			f.Destination = translateAddress(f.Destination, mapped, n.source.Flatten())
+			return f, true
+		}
+	}
+
+	if !matchAddress(n.source, src) || !matchAddress(n.destination, dst) {
+		return f, false
+	}
+	if n.service != nil {
+		svc := PortInterval{Start: f.Port, End: f.Port, Protocol: f.Protocol}
+		if !n.service.Flatten().Contains(svc) {
+			return f, false
+		}
+	}
+
+	if n.translatedSource != nil {
+		f.Source = translateAddress(f.Source, natSet(n.source), n.translatedSource.Flatten())
+	}
+	if n.translatedDestination != nil {
+		f.Destination = translateAddress(f.Destination, natSet(n.destination), n.translatedDestination.Flatten())
+	}
+	if n.translatedPort != 0 && (f.Protocol == TCP || f.Protocol == UDP) {
+		f.Port = n.translatedPort
+	}
+	return f, true
+}
+
+// ApplyNAT translates the flow with the first rule that matches it. The rules
+// must be in policy order. It returns nil if no rule matched.
+func ApplyNAT(rules []*NATRule, f Flow) (Flow, *NATRule) {
+	for _, n := range rules {
+		if translated, ok := n.Translate(f); ok {
+			return translated, n
+		}
+	}
+	return f, nil
+}
+
+func matchAddress(grp *Group, addr AddressSet) bool {
+	return natSet(grp).Contains(addr)
+}
+
+// natSet returns the addresses of grp, every address if grp is nil.
+func natSet(grp *Group) AddressSet {
+	if grp == nil {
+		return AddressSet{{Start: 0, End: addrMax}}
+	}
+	return grp.Flatten()
+}
+
+// translateAddress maps addr from one set onto the other by its position in
+// the set. When to is smaller than from, positions wrap around, which stands
+// in for the arbitrary pool allocation of dynamic NAT.
+func translateAddress(addr ip.Address, from, to AddressSet) ip.Address {
+	size := to.Size()
+	if size == 0 {
+		return addr
+	}
+	var index uint64
+	for _, o := range from {
+		if addr >= o.Start && addr <= o.End {
+			index += uint64(addr) - uint64(o.Start)
+			break
+		}
+		index += uint64(o.End) - uint64(o.Start) + 1
+	}
+	index %= size
+	for _, o := range to {
+		width := uint64(o.End) - uint64(o.Start) + 1
+		if index < width {
+			return ip.Address(uint64(o.Start) + index)
+		}
+		index -= width
+	}
+	return addr
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Neffats/ip"
+)
+
+func testFlow(t *testing.T, src, dst string, port uint) Flow {
+	t.Helper()
+	s, err := ip.NewAddress(src)
+	if err != nil {
+		t.Fatalf("failed to create source: %v", err)
+	}
+	d, err := ip.NewAddress(dst)
+	if err != nil {
+		t.Fatalf("failed to create destination: %v", err)
+	}
+	return Flow{Source: *s, Destination: *d, Protocol: TCP, Port: port}
+}
+
+func TestNATTranslate(t *testing.T) {
+	web := testGroup(t, "web", "10.1.0.0/255.255.255.252")
+	public := testGroup(t, "public", "203.0.113.8/255.255.255.252")
+	clients := testGroup(t, "clients", "10.0.0.0/255.255.255.0")
+	pool := testGroup(t, "pool", "198.51.100.0/255.255.255.254")
+	outside := testGroup(t, "outside", "198.51.100.10/255.255.255.255")
+	server := testGroup(t, "server", "10.1.0.20/255.255.255.255")
+
+	static, err := NewStaticNAT("web", 1, web, public, "")
+	if err != nil {
+		t.Fatalf("failed to create static nat: %v", err)
+	}
+	pat, err := NewPAT("hide", 2, clients, outside, "")
+	if err != nil {
+		t.Fatalf("failed to create pat: %v", err)
+	}
+	dynamic := NewDynamicNAT("pool", 3, clients, pool, "")
+	twice := NewTwiceNAT("forward", 4, nil, outside, testPortGroup(t, "https", 443), nil, server, 8443, "")
+
+	tests := []struct {
+		name  string
+		rule  *NATRule
+		flow  Flow
+		match bool
+		want  string
+	}{
+		{name: "Static inbound", rule: static, flow: testFlow(t, "8.8.8.8", "203.0.113.10", 443), match: true, want: "8.8.8.8 -> 10.1.0.2 tcp/443"},
+		{name: "Static outbound", rule: static, flow: testFlow(t, "10.1.0.3", "8.8.8.8", 53), match: true, want: "203.0.113.11 -> 8.8.8.8 tcp/53"},
+		{name: "Static no match", rule: static, flow: testFlow(t, "10.2.0.1", "8.8.8.8", 53), match: false, want: "10.2.0.1 -> 8.8.8.8 tcp/53"},
+		{name: "PAT", rule: pat, flow: testFlow(t, "10.0.0.77", "8.8.8.8", 80), match: true, want: "198.51.100.10 -> 8.8.8.8 tcp/80"},
+		{name: "Dynamic wraps pool", rule: dynamic, flow: testFlow(t, "10.0.0.3", "8.8.8.8", 80), match: true, want: "198.51.100.1 -> 8.8.8.8 tcp/80"},
+		{name: "Twice with port", rule: twice, flow: testFlow(t, "8.8.8.8", "198.51.100.10", 443), match: true, want: "8.8.8.8 -> 10.1.0.20 tcp/8443"},
+		{name: "Twice wrong service", rule: twice, flow: testFlow(t, "8.8.8.8", "198.51.100.10", 80), match: false, want: "8.8.8.8 -> 198.51.100.10 tcp/80"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := tc.rule.Translate(tc.flow)
+			if ok != tc.match {
+				t.Fatalf("expected match to be %t", tc.match)
+			}
+			if got.String() != tc.want {
+				t.Fatalf("want: %s, got: %s", tc.want, got)
+			}
+		})
+	}
+
+	t.Run("First match", func(t *testing.T) {
+		_, matched := ApplyNAT([]*NATRule{static, pat, dynamic}, testFlow(t, "10.0.0.1", "8.8.8.8", 80))
+		if matched != pat {
+			t.Fatalf("expected pat to match first, got: %v", matched)
+		}
+		_, matched = ApplyNAT([]*NATRule{static}, testFlow(t, "10.0.0.1", "8.8.8.8", 80))
+		if matched != nil {
+			t.Fatalf("expected no match, got: %v", matched)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		if _, err := NewStaticNAT("bad", 1, web, outside, ""); !errors.Is(err, ErrNATSizeMismatch) {
+			t.Fatalf("expected size mismatch, got: %v", err)
+		}
+		if _, err := NewPAT("bad", 1, clients, pool, ""); !errors.Is(err, ErrNATSingleMapped) {
+			t.Fatalf("expected single mapped error, got: %v", err)
+		}
+	})
+}
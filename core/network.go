@@ -57,6 +57,15 @@ func NewNetwork(name, addr, mask, comment string) (*Network, error) {
 	return network, nil
 }
 
+func (n *Network) Name() string {
+	return n.name
+}
+
+// String returns the network in CIDR notation i.e. 192.168.1.0/24
+func (n *Network) String() string {
+	return n.Unpack()[0].String()
+}
+
 // Value returns the first and last address in the Network's Address range (network and broadcast).
 // Statisfies the NetworkObject interface.
 func (n *Network) Unpack() []NetworkObject {
@@ -95,3 +104,52 @@ func (n *Network) Contains(obj NetworkUnpacker) bool {
 	}
 	return true
 }
+
+func (n *Network) UID() string {
+	return n.uid
+}
+
+// Address returns the network address in dotted form.
+func (n *Network) Address() string {
+	return addrString(*n.address)
+}
+
+// Mask returns the subnet mask in dotted form.
+func (n *Network) Mask() string {
+	return addrString(*n.mask)
+}
+
+// CIDR returns the network in CIDR notation, or address/mask if the mask
+// isn't contiguous.
+func (n *Network) CIDR() string {
+	return n.cidrString()
+}
+
+func (n *Network) Comment() string {
+	return n.comment
+}
+
+// WithName returns a copy of the network with a new name. Copies keep the
+// UID of the original, so they can replace it with a store's Update.
+func (n *Network) WithName(name string) *Network {
+	c := *n
+	c.name = name
+	return &c
+}
+
+// WithAddress returns a copy of the network with a new address and mask.
+func (n *Network) WithAddress(addr, mask string) (*Network, error) {
+	updated, err := NewNetwork(n.name, addr, mask, n.comment)
+	if err != nil {
+		return nil, err
+	}
+	updated.uid = n.uid
+	return updated, nil
+}
+
+// WithComment returns a copy of the network with a new comment.
+func (n *Network) WithComment(comment string) *Network {
+	c := *n
+	c.comment = comment
+	return &c
+}
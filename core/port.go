@@ -2,6 +2,7 @@ package core
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/google/uuid"
@@ -12,12 +13,38 @@ const (
 	UDP
 	ICMP
 	ARP
+	// IP matches every IP protocol, including TCP, UDP and ICMP.
 	IP
+	ICMPv6
+	// Any matches every service, IP or not.
+	Any
 )
 
-var proto = [5]string{"tcp", "udp", "icmp", "arp", "ip"}
+var proto = [7]string{"tcp", "udp", "icmp", "arp", "ip", "icmpv6", "any"}
 
-// String2Proto returns the enum of string provided.
+// Protocols without a name above are identified by their IP protocol number,
+// offset by protoNumberBase so they never clash with the named protocols.
+const protoNumberBase = 256
+
+// maxPort is the highest port number. ICMP services use the same space for
+// their type and code, see ICMPPort.
+const maxPort = 65535
+
+// Well known IP protocol numbers that can be referred to by name.
+var protoNumbers = map[string]uint8{
+	"igmp": 2,
+	"gre":  47,
+	"esp":  50,
+	"ah":   51,
+	"ospf": 89,
+	"pim":  103,
+	"vrrp": 112,
+	"sctp": 132,
+}
+
+// String2Proto returns the enum of string provided. Besides the named
+// protocols it accepts well known IP protocol names (gre, esp...) and IP
+// protocol numbers, either bare or as proto-<number>.
 func String2Proto(protocol string) int {
 	lowerProto := strings.ToLower(protocol)
 	for i, p := range proto {
@@ -25,17 +52,85 @@ func String2Proto(protocol string) int {
 			return i
 		}
 	}
-	return -1
+	if n, ok := protoNumbers[lowerProto]; ok {
+		return ProtocolNumber(n)
+	}
+	n, err := strconv.ParseUint(strings.TrimPrefix(lowerProto, "proto-"), 10, 8)
+	if err != nil {
+		return -1
+	}
+	return ProtocolNumber(uint8(n))
 }
 
 // Proto2String returns the string of the protocol enum.
 func Proto2String(protocol int) string {
+	if protocol >= protoNumberBase && protocol < protoNumberBase+256 {
+		n := uint8(protocol - protoNumberBase)
+		for name, number := range protoNumbers {
+			if number == n {
+				return name
+			}
+		}
+		return fmt.Sprintf("proto-%d", n)
+	}
 	if protocol < 0 || protocol > len(proto)-1 {
 		return ""
 	}
 	return proto[protocol]
 }
 
+// ProtocolNumber returns the enum of an IP protocol number. The numbers of
+// the named protocols map onto their enum, i.e. 6 is TCP.
+func ProtocolNumber(n uint8) int {
+	switch n {
+	case 1:
+		return ICMP
+	case 6:
+		return TCP
+	case 17:
+		return UDP
+	case 58:
+		return ICMPv6
+	}
+	return protoNumberBase + int(n)
+}
+
+// HasPorts returns true if services of the protocol are told apart by port,
+// or for ICMP by type and code. Services of any other protocol cover the
+// whole protocol.
+func HasPorts(protocol int) bool {
+	switch protocol {
+	case TCP, UDP, ICMP, ICMPv6:
+		return true
+	}
+	return false
+}
+
+// isIPProtocol returns true if the protocol runs over IP.
+func isIPProtocol(protocol int) bool {
+	switch protocol {
+	case TCP, UDP, ICMP, ICMPv6:
+		return true
+	}
+	return protocol >= protoNumberBase && protocol < protoNumberBase+256
+}
+
+// protoCovers returns true if every service of inner is a service of outer.
+func protoCovers(outer, inner int) bool {
+	switch outer {
+	case inner, Any:
+		return true
+	case IP:
+		return inner == IP || isIPProtocol(inner)
+	}
+	return false
+}
+
+// ICMPPort returns the port number ICMP services use for a type and code.
+func ICMPPort(icmpType, code uint8) uint {
+	return uint(icmpType)<<8 | uint(code)
+}
+
 type Port struct {
 	uid      string
 	name     string
@@ -59,6 +154,15 @@ func NewPort(name string, number uint, protocol, comment string) (*Port, error)
 	}, nil
 }
 
+func (p *Port) Name() string {
+	return p.name
+}
+
+// String returns the port in protocol/number notation i.e. tcp/443
+func (p *Port) String() string {
+	return PortInterval{Start: p.number, End: p.number, Protocol: p.protocol}.String()
+}
+
 func (p *Port) Value() (start uint, end uint, proto int) {
 	start = p.number
 	end = p.number
@@ -71,6 +175,50 @@ func (p *Port) Match(prt *Port) bool {
 }
 
 func (p *Port) Contains(obj PortObject) bool {
-	otherStart, otherEnd, otherProto := obj.Value()
-	return otherStart == p.number && otherEnd == p.number && otherProto == p.protocol
+	return PortInterval{Start: p.number, End: p.number, Protocol: p.protocol}.Contains(obj)
+}
+
+// UnpackPorts satisfies the PortUnpacker interface.
+func (p *Port) UnpackPorts() PortSet {
+	return NewPortSet(p)
+}
+
+func (p *Port) UID() string {
+	return p.uid
+}
+
+// Number returns the port number.
+func (p *Port) Number() uint {
+	return p.number
+}
+
+// Protocol returns the protocol enum of the port.
+func (p *Port) Protocol() int {
+	return p.protocol
+}
+
+func (p *Port) Comment() string {
+	return p.comment
+}
+
+// WithName returns a copy of the port with a new name. Copies keep the UID
+// of the original, so they can replace it with a store's Update.
+func (p *Port) WithName(name string) *Port {
+	c := *p
+	c.name = name
+	return &c
+}
+
+// WithNumber returns a copy of the port with a new port number.
+func (p *Port) WithNumber(number uint) *Port {
+	c := *p
+	c.number = number
+	return &c
+}
+
+// WithComment returns a copy of the port with a new comment.
+func (p *Port) WithComment(comment string) *Port {
+	c := *p
+	c.comment = comment
+	return &c
 }
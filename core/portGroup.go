@@ -3,37 +3,70 @@ package core
 import (
 	"errors"
 	"fmt"
-	"reflect"
 	"sort"
 
 	"github.com/google/uuid"
 )
 
-// PortGroup groups together different Port, PortRanges and other PortGroup objects.
+// PortGroup groups together different Port, PortRange, Service and other PortGroup objects.
 type PortGroup struct {
-	uid     string
-	name    string
-	ports   []*Port
-	ranges  []*PortRange
-	groups  []*PortGroup
-	comment string
+	uid      string
+	name     string
+	ports    []*Port
+	ranges   []*PortRange
+	services []*Service
+	groups   []*PortGroup
+	comment  string
 }
 
 // NewPortGroup returns a new empty oort group.
 func NewPortGroup(name, comment string) *PortGroup {
 	uid := uuid.New()
 	return &PortGroup{
-		uid:     uid.String(),
-		name:    name,
-		ports:   make([]*Port, 0),
-		ranges:  make([]*PortRange, 0),
-		groups:  make([]*PortGroup, 0),
-		comment: comment,
+		uid:      uid.String(),
+		name:     name,
+		ports:    make([]*Port, 0),
+		ranges:   make([]*PortRange, 0),
+		services: make([]*Service, 0),
+		groups:   make([]*PortGroup, 0),
+		comment:  comment,
 	}
 }
 
+func (pg *PortGroup) Name() string {
+	return pg.name
+}
+
+// Ports returns a copy of the group's port members.
+func (pg *PortGroup) Ports() []*Port {
+	result := make([]*Port, len(pg.ports))
+	copy(result, pg.ports)
+	return result
+}
+
+// Ranges returns a copy of the group's port range members.
+func (pg *PortGroup) Ranges() []*PortRange {
+	result := make([]*PortRange, len(pg.ranges))
+	copy(result, pg.ranges)
+	return result
+}
+
+// Services returns a copy of the group's service members.
+func (pg *PortGroup) Services() []*Service {
+	result := make([]*Service, len(pg.services))
+	copy(result, pg.services)
+	return result
+}
+
+// Groups returns a copy of the group's nested port groups.
+func (pg *PortGroup) Groups() []*PortGroup {
+	result := make([]*PortGroup, len(pg.groups))
+	copy(result, pg.groups)
+	return result
+}
+
 // Add will add the specified object to the group.
-// Supported types: Port/Port Range/Port Group
+// Supported types: Port/Port Range/Service/Port Group
 func (pg *PortGroup) Add(obj interface{}) error {
 	present, err := pg.HasObject(obj)
 	if err != nil {
@@ -48,6 +81,8 @@ func (pg *PortGroup) Add(obj interface{}) error {
 		pg.addPort(v)
 	case *PortRange:
 		pg.addPortRange(v)
+	case *Service:
+		pg.addService(v)
 	case *PortGroup:
 		pg.addPortGroup(v)
 	default:
@@ -98,6 +133,23 @@ func (pg *PortGroup) addPortRange(pr *PortRange) {
 	pg.ranges = newRanges
 }
 
+func (pg *PortGroup) addService(svc *Service) {
+	// Ordered by protocol, then by destination ports.
+	i := sort.Search(len(pg.services), func(i int) bool {
+		other := pg.services[i]
+		if other.protocol != svc.protocol {
+			return other.protocol > svc.protocol
+		}
+		if other.start != svc.start {
+			return other.start > svc.start
+		}
+		return other.end >= svc.end
+	})
+	pg.services = append(pg.services, nil)
+	copy(pg.services[i+1:], pg.services[i:])
+	pg.services[i] = svc
+}
+
 func (pg *PortGroup) addPortGroup(grp *PortGroup) {
 	// Ordered alphabetically by Group name.
 	i := sort.Search(len(pg.groups), func(i int) bool {
@@ -168,6 +220,12 @@ func (pg *PortGroup) HasObject(obj interface{}) (bool, error) {
 		if pg.ranges[i].Match(v) {
 			return true, nil
 		}
+	case *Service:
+		for _, svc := range pg.services {
+			if svc.Match(v) {
+				return true, nil
+			}
+		}
 	case *PortGroup:
 		var i int
 		// Edge case handling. When len() == 0, sort.Search() was return index of 1 with is oob.
@@ -217,6 +275,11 @@ func (pg *PortGroup) Contains(obj PortObject) bool {
 			return true
 		}
 	}
+	for _, svc := range pg.services {
+		if svc.Contains(obj) {
+			return true
+		}
+	}
 	for _, g := range pg.groups {
 		if g.Contains(obj) {
 			return true
@@ -225,9 +288,46 @@ func (pg *PortGroup) Contains(obj PortObject) bool {
 	return false
 }
 
+// Allows returns true if a member of the group matches a packet, including
+// its source port. dstPort is the destination port, or the ICMPPort of an
+// ICMP packet.
+func (pg *PortGroup) Allows(protocol int, srcPort, dstPort uint) bool {
+	return pg.allows(protocol, srcPort, dstPort, make(map[*PortGroup]bool))
+}
+
+func (pg *PortGroup) allows(protocol int, srcPort, dstPort uint, seen map[*PortGroup]bool) bool {
+	if pg == nil || seen[pg] {
+		return false
+	}
+	seen[pg] = true
+
+	packet := PortInterval{Start: dstPort, End: dstPort, Protocol: protocol}
+	for _, p := range pg.ports {
+		if p.Contains(packet) {
+			return true
+		}
+	}
+	for _, r := range pg.ranges {
+		if r.Contains(packet) {
+			return true
+		}
+	}
+	for _, svc := range pg.services {
+		if svc.Allows(protocol, srcPort, dstPort) {
+			return true
+		}
+	}
+	for _, g := range pg.groups {
+		if g.allows(protocol, srcPort, dstPort, seen) {
+			return true
+		}
+	}
+	return false
+}
+
 // Match will return true if both groups are identical.
 func (pg *PortGroup) Match(grp *PortGroup) bool {
-	return reflect.DeepEqual(pg, grp)
+	return grp.name == pg.name && pg.MatchContent(grp)
 }
 
 // MatchContent returns true if both groups contain the exact same members.
@@ -240,6 +340,9 @@ func (pg *PortGroup) MatchContent(grp *PortGroup) bool {
 	if len(pg.ranges) != len(grp.ranges) {
 		return false
 	}
+	if len(pg.services) != len(grp.services) {
+		return false
+	}
 	if len(pg.groups) != len(grp.groups) {
 		return false
 	}
@@ -263,6 +366,14 @@ func (pg *PortGroup) MatchContent(grp *PortGroup) bool {
 		}
 	}
 
+	// Compare Services of both groups.
+	for i := 0; i < len(pg.services); i++ {
+		match = pg.services[i].Match(grp.services[i])
+		if !match {
+			return false
+		}
+	}
+
 	// Compare Groups of groups.
 	for i := 0; i < len(pg.groups); i++ {
 		match = pg.groups[i].Match(grp.groups[i])
@@ -273,3 +384,78 @@ func (pg *PortGroup) MatchContent(grp *PortGroup) bool {
 
 	return true
 }
+
+func (pg *PortGroup) UID() string {
+	return pg.uid
+}
+
+func (pg *PortGroup) Comment() string {
+	return pg.comment
+}
+
+// clone returns a copy of the group whose member lists can be changed without
+// affecting the original. Members themselves are shared.
+func (pg *PortGroup) clone() *PortGroup {
+	c := *pg
+	c.ports = append([]*Port{}, pg.ports...)
+	c.ranges = append([]*PortRange{}, pg.ranges...)
+	c.services = append([]*Service{}, pg.services...)
+	c.groups = append([]*PortGroup{}, pg.groups...)
+	return &c
+}
+
+// WithName returns a copy of the group with a new name. Copies keep the UID
+// of the original, so they can replace it with a store's Update.
+func (pg *PortGroup) WithName(name string) *PortGroup {
+	c := pg.clone()
+	c.name = name
+	return c
+}
+
+// WithComment returns a copy of the group with a new comment.
+func (pg *PortGroup) WithComment(comment string) *PortGroup {
+	c := pg.clone()
+	c.comment = comment
+	return c
+}
+
+// WithMember returns a copy of the group with obj added, see Add for the
+// supported types.
+func (pg *PortGroup) WithMember(obj interface{}) (*PortGroup, error) {
+	c := pg.clone()
+	if err := c.Add(obj); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// WithoutMember returns a copy of the group without the direct member whose
+// UID is uid. Returns an error if there is no such member.
+func (pg *PortGroup) WithoutMember(uid string) (*PortGroup, error) {
+	c := pg.clone()
+	for i, p := range c.ports {
+		if p.uid == uid {
+			c.ports = append(c.ports[:i], c.ports[i+1:]...)
+			return c, nil
+		}
+	}
+	for i, r := range c.ranges {
+		if r.uid == uid {
+			c.ranges = append(c.ranges[:i], c.ranges[i+1:]...)
+			return c, nil
+		}
+	}
+	for i, svc := range c.services {
+		if svc.uid == uid {
+			c.services = append(c.services[:i], c.services[i+1:]...)
+			return c, nil
+		}
+	}
+	for i, grp := range c.groups {
+		if grp.uid == uid {
+			c.groups = append(c.groups[:i], c.groups[i+1:]...)
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("port group %s has no member with uid: %s", pg.name, uid)
+}
@@ -1,9 +1,13 @@
 package core
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
 
 type PortRange struct {
-	uid      int
+	uid      string
 	name     string
 	start    uint
 	end      uint
@@ -16,7 +20,9 @@ func NewPortRange(name string, start, end uint, protocol, comment string) (*Port
 	if protoEnum == -1 {
 		return nil, fmt.Errorf("failed to create new Port object because invalid protocol provided: %s", protocol)
 	}
+	uid := uuid.New()
 	return &PortRange{
+		uid:      uid.String(),
 		name:     name,
 		start:    start,
 		end:      end,
@@ -25,6 +31,15 @@ func NewPortRange(name string, start, end uint, protocol, comment string) (*Port
 	}, nil
 }
 
+func (pr *PortRange) Name() string {
+	return pr.name
+}
+
+// String returns the range in protocol/start-end notation i.e. tcp/8000-8080
+func (pr *PortRange) String() string {
+	return PortInterval{Start: pr.start, End: pr.end, Protocol: pr.protocol}.String()
+}
+
 func (pr *PortRange) Value() (start uint, end uint, proto int) {
 	start = pr.start
 	end = pr.end
@@ -37,6 +52,59 @@ func (pr *PortRange) Match(other *PortRange) bool {
 }
 
 func (pr *PortRange) Contains(obj PortObject) bool {
-	otherStart, otherEnd, otherProto := obj.Value()
-	return pr.start <= otherStart && pr.end >= otherEnd && otherProto == pr.protocol
+	return PortInterval{Start: pr.start, End: pr.end, Protocol: pr.protocol}.Contains(obj)
+}
+
+// UnpackPorts satisfies the PortUnpacker interface.
+func (pr *PortRange) UnpackPorts() PortSet {
+	return NewPortSet(pr)
+}
+
+func (pr *PortRange) UID() string {
+	return pr.uid
+}
+
+// Start returns the first port of the range.
+func (pr *PortRange) Start() uint {
+	return pr.start
+}
+
+// End returns the last port of the range.
+func (pr *PortRange) End() uint {
+	return pr.end
+}
+
+// Protocol returns the protocol enum of the range.
+func (pr *PortRange) Protocol() int {
+	return pr.protocol
+}
+
+func (pr *PortRange) Comment() string {
+	return pr.comment
+}
+
+// WithName returns a copy of the range with a new name. Copies keep the UID
+// of the original, so they can replace it with a store's Update.
+func (pr *PortRange) WithName(name string) *PortRange {
+	c := *pr
+	c.name = name
+	return &c
+}
+
+// WithPorts returns a copy of the range with new start and end ports.
+func (pr *PortRange) WithPorts(start, end uint) (*PortRange, error) {
+	if start > end {
+		return nil, fmt.Errorf("range start port must be less than the end port: %d-%d", start, end)
+	}
+	c := *pr
+	c.start = start
+	c.end = end
+	return &c, nil
+}
+
+// WithComment returns a copy of the range with a new comment.
+func (pr *PortRange) WithComment(comment string) *PortRange {
+	c := *pr
+	c.comment = comment
+	return &c
 }
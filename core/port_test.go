@@ -11,6 +11,10 @@ func TestString2Proto(t *testing.T) {
 		{name: "Valid-tcp", in: "tcp", want: 0},
 		{name: "Upper-case-tcp", in: "TCP", want: 0},
 		{name: "Valid-icmp", in: "icmp", want: 2},
+		{name: "Named-protocol-number", in: "gre", want: protoNumberBase + 47},
+		{name: "Protocol-number", in: "proto-47", want: protoNumberBase + 47},
+		{name: "Protocol-number-of-named-proto", in: "6", want: TCP},
+		{name: "Protocol-number-too-high", in: "256", want: -1},
 		{name: "Invalid-proto", in: "INVALID", want: -1},
 	}
 	for _, tc := range tests {
@@ -31,6 +35,8 @@ func TestProto2String(t *testing.T) {
 	}{
 		{name: "Valid-tcp", in: 0, want: "tcp"},
 		{name: "Valid-icmp", in: 2, want: "icmp"},
+		{name: "Named-protocol-number", in: protoNumberBase + 50, want: "esp"},
+		{name: "Protocol-number", in: protoNumberBase + 4, want: "proto-4"},
 		{name: "Invalid-proto-too-high", in: 10, want: ""},
 		{name: "Invalid-proto-negative-number", in: -1, want: ""},
 	}
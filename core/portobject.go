@@ -3,3 +3,9 @@ package core
 type PortObject interface {
 	Value() (start uint, end uint, proto int)
 }
+
+// PortUnpacker is implemented by any object that can be broken down into a
+// set of services.
+type PortUnpacker interface {
+	UnpackPorts() PortSet
+}
@@ -48,6 +48,15 @@ func NewRange(name, start, end, comment string) (*Range, error) {
 	return r, nil
 }
 
+func (r *Range) Name() string {
+	return r.name
+}
+
+// String returns the range in start-end notation.
+func (r *Range) String() string {
+	return fmt.Sprintf("%s-%s", addrString(*r.startAddress), addrString(*r.endAddress))
+}
+
 func (r *Range) Unpack() []NetworkObject {
 	result := make([]NetworkObject, 0)
 	result = append(result,
@@ -91,3 +100,46 @@ func checkRangeFmt(addr string) ([]string, error) {
 	}
 	return components, nil
 }
+
+func (r *Range) UID() string {
+	return r.uid
+}
+
+// Start returns the first address of the range in dotted form.
+func (r *Range) Start() string {
+	return addrString(*r.startAddress)
+}
+
+// End returns the last address of the range in dotted form.
+func (r *Range) End() string {
+	return addrString(*r.endAddress)
+}
+
+func (r *Range) Comment() string {
+	return r.comment
+}
+
+// WithName returns a copy of the range with a new name. Copies keep the UID
+// of the original, so they can replace it with a store's Update.
+func (r *Range) WithName(name string) *Range {
+	c := *r
+	c.name = name
+	return &c
+}
+
+// WithRange returns a copy of the range with new start and end addresses.
+func (r *Range) WithRange(start, end string) (*Range, error) {
+	updated, err := NewRange(r.name, start, end, r.comment)
+	if err != nil {
+		return nil, err
+	}
+	updated.uid = r.uid
+	return updated, nil
+}
+
+// WithComment returns a copy of the range with a new comment.
+func (r *Range) WithComment(comment string) *Range {
+	c := *r
+	c.comment = comment
+	return &c
+}
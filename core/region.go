@@ -0,0 +1,168 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Neffats/ip"
+	"github.com/google/uuid"
+)
+
+// Region represents a geo location object, i.e. a country code. It covers no
+// addresses until it has been resolved against a RegionMap.
+type Region struct {
+	uid       string
+	name      string
+	code      string
+	addresses AddressSet
+	comment   string
+}
+
+// NewRegion returns a pointer to a new, unresolved Region object.
+func NewRegion(name, code, comment string) *Region {
+	uid := uuid.New()
+	return &Region{
+		uid:       uid.String(),
+		name:      name,
+		code:      strings.ToUpper(code),
+		addresses: AddressSet{},
+		comment:   comment,
+	}
+}
+
+func (r *Region) UID() string {
+	return r.uid
+}
+
+func (r *Region) Name() string {
+	return r.name
+}
+
+// Code returns the region's code, i.e. GB.
+func (r *Region) Code() string {
+	return r.code
+}
+
+func (r *Region) Comment() string {
+	return r.comment
+}
+
+func (r *Region) String() string {
+	return r.code
+}
+
+// Resolve replaces the region's addresses with the ones in the map.
+func (r *Region) Resolve(m *RegionMap) {
+	r.addresses = m.Addresses(r.code)
+}
+
+// Unpack returns the resolved addresses, nothing if the region hasn't been
+// resolved.
+func (r *Region) Unpack() []NetworkObject {
+	return r.addresses.Unpack()
+}
+
+// Match will return true if both regions have the same code.
+func (r *Region) Match(obj *Region) bool {
+	return r.code == obj.code
+}
+
+// RegionMap holds the address space of each region.
+type RegionMap struct {
+	regions map[string]AddressSet
+}
+
+// NewRegionMap returns an empty region map.
+func NewRegionMap() *RegionMap {
+	return &RegionMap{regions: make(map[string]AddressSet)}
+}
+
+// LoadRegionMap reads a region file, one CIDR or start-end range per line
+// followed by the region code:
+//
+//	# comment
+//	81.2.69.0/24 GB
+//	203.0.113.0-203.0.113.127 AU
+func LoadRegionMap(path string) (*RegionMap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open region file: %v", err)
+	}
+	defer f.Close()
+	return ReadRegionMap(f)
+}
+
+// ReadRegionMap reads a region mapping in the format of LoadRegionMap.
+func ReadRegionMap(r io.Reader) (*RegionMap, error) {
+	m := NewRegionMap()
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i != -1 {
+			text = text[:i]
+		}
+		fields := strings.Fields(strings.Replace(text, ",", " ", -1))
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected an address block followed by a region code", line)
+		}
+		block, err := parseBlock(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		m.Add(fields[1], block)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read region file: %v", err)
+	}
+	return m, nil
+}
+
+// parseBlock parses an address block in CIDR or start-end notation.
+func parseBlock(block string) (NetworkObject, error) {
+	if parts := strings.SplitN(block, "/", 2); len(parts) == 2 {
+		addr, err := ip.NewAddress(parts[0])
+		if err != nil {
+			return NetworkObject{}, fmt.Errorf("invalid address: %v", err)
+		}
+		prefix, err := strconv.Atoi(parts[1])
+		if err != nil || prefix < 0 || prefix > 32 {
+			return NetworkObject{}, fmt.Errorf("invalid prefix length: %s", parts[1])
+		}
+		if *addr&^prefixMask(prefix) != 0 {
+			return NetworkObject{}, fmt.Errorf("address not the network address for prefix: %s", block)
+		}
+		return newCIDR(*addr, prefix).Unpack()[0], nil
+	}
+	if parts := strings.SplitN(block, "-", 2); len(parts) == 2 {
+		rng, err := NewRange(block, parts[0], parts[1], "")
+		if err != nil {
+			return NetworkObject{}, err
+		}
+		return rng.Unpack()[0], nil
+	}
+	addr, err := ip.NewAddress(block)
+	if err != nil {
+		return NetworkObject{}, fmt.Errorf("invalid address: %v", err)
+	}
+	return NetworkObject{Start: *addr, End: *addr}, nil
+}
+
+// Add adds an address block to the region.
+func (m *RegionMap) Add(code string, block NetworkObject) {
+	code = strings.ToUpper(code)
+	m.regions[code] = m.regions[code].Union(AddressSet{block})
+}
+
+// Addresses returns the address space of the region, empty if it is unknown.
+func (m *RegionMap) Addresses(code string) AddressSet {
+	return m.regions[strings.ToUpper(code)].Union(AddressSet{})
+}
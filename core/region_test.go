@@ -0,0 +1,40 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegionResolve(t *testing.T) {
+	regions, err := ReadRegionMap(strings.NewReader(`
+# geo mapping
+81.2.69.0/24 gb
+81.2.70.0/24,GB
+203.0.113.0-203.0.113.127 AU
+`))
+	if err != nil {
+		t.Fatalf("failed to read region map: %v", err)
+	}
+
+	gb := NewRegion("uk", "GB", "")
+	grp := NewGroup("geo", "")
+	if err := grp.Add(gb); err != nil {
+		t.Fatalf("failed to add region to group: %v", err)
+	}
+	if grp.Flatten().Size() != 0 {
+		t.Fatalf("expected unresolved region to have no addresses")
+	}
+	grp.ResolveRegions(regions)
+	if got := grp.Flatten().String(); got != "81.2.69.0-81.2.70.255" {
+		t.Fatalf("unexpected addresses: %s", got)
+	}
+	if got := regions.Addresses("au").String(); got != "203.0.113.0/25" {
+		t.Fatalf("unexpected addresses for AU: %s", got)
+	}
+
+	for _, bad := range []string{"81.2.69.1/24 GB", "81.2.69.0/24", "81.2.69.0/33 GB"} {
+		if _, err := ReadRegionMap(strings.NewReader(bad)); err == nil {
+			t.Fatalf("expected error for: %s", bad)
+		}
+	}
+}
@@ -1,18 +1,31 @@
 package core
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/google/uuid"
 )
 
 // Rule is a representation of a firewall rule.
 type Rule struct {
 	uid         string
+	name        string
 	number      int
 	source      *Group
 	destination *Group
 	port        *PortGroup
 	action      bool
 	comment     string
+	// Zones the rule is scoped to, empty meaning any zone.
+	fromZones []*Zone
+	toZones   []*Zone
+	// Applications and users the rule is scoped to, empty meaning any.
+	applications []*Application
+	users        []*User
+	userGroups   []*UserGroup
+	// Schedule of the rule, nil meaning it always applies.
+	schedule *Schedule
 }
 
 // NewRule returns a pointer to a new Rule object.
@@ -29,14 +42,289 @@ func NewRule(number int, src, dst *Group, prt *PortGroup, action bool, comment s
 	}
 }
 
+// NewNamedRule returns a pointer to a new Rule object that carries the
+// vendor's identifier for the rule i.e. the PAN-OS rule name or FortiGate policy id.
+func NewNamedRule(name string, number int, src, dst *Group, prt *PortGroup, action bool, comment string) *Rule {
+	r := NewRule(number, src, dst, prt, action, comment)
+	r.name = name
+	return r
+}
+
 func (r *Rule) UID() string {
 	return r.uid
 }
 
+// Name returns the vendor's identifier for the rule, empty if it has none.
+func (r *Rule) Name() string {
+	return r.name
+}
+
+// Number returns the position of the rule in the policy.
+func (r *Rule) Number() int {
+	return r.number
+}
+
+func (r *Rule) Source() *Group {
+	return r.source
+}
+
+func (r *Rule) Destination() *Group {
+	return r.destination
+}
+
 func (r *Rule) Port() *PortGroup {
 	return r.port
 }
 
+// Action returns true if the rule permits traffic, false if it denies it.
+func (r *Rule) Action() bool {
+	return r.action
+}
+
+func (r *Rule) Comment() string {
+	return r.comment
+}
+
+// AddFromZone scopes the rule to traffic entering through the zone.
+func (r *Rule) AddFromZone(z *Zone) {
+	r.fromZones = append(r.fromZones, z)
+}
+
+// AddToZone scopes the rule to traffic leaving through the zone.
+func (r *Rule) AddToZone(z *Zone) {
+	r.toZones = append(r.toZones, z)
+}
+
+// FromZones returns a copy of the rule's ingress zones, empty meaning any zone.
+func (r *Rule) FromZones() []*Zone {
+	result := make([]*Zone, len(r.fromZones))
+	copy(result, r.fromZones)
+	return result
+}
+
+// ToZones returns a copy of the rule's egress zones, empty meaning any zone.
+func (r *Rule) ToZones() []*Zone {
+	result := make([]*Zone, len(r.toZones))
+	copy(result, r.toZones)
+	return result
+}
+
+// MatchFromZone returns true if the rule applies to traffic entering through
+// the named zone.
+func (r *Rule) MatchFromZone(name string) bool {
+	return zonesInclude(r.fromZones, name)
+}
+
+// MatchToZone returns true if the rule applies to traffic leaving through
+// the named zone.
+func (r *Rule) MatchToZone(name string) bool {
+	return zonesInclude(r.toZones, name)
+}
+
+// AddApplication scopes the rule to traffic identified as the application.
+func (r *Rule) AddApplication(app *Application) {
+	r.applications = append(r.applications, app)
+}
+
+// Applications returns a copy of the rule's applications, empty meaning any
+// application.
+func (r *Rule) Applications() []*Application {
+	result := make([]*Application, len(r.applications))
+	copy(result, r.applications)
+	return result
+}
+
+// MatchApplication returns true if the rule applies to the named application.
+func (r *Rule) MatchApplication(name string) bool {
+	return applicationsInclude(r.applications, name)
+}
+
+// UseApplicationDefault replaces the rule's service with the default ports
+// of its applications, like PAN-OS' application-default service. Call it
+// after adding the applications.
+func (r *Rule) UseApplicationDefault() error {
+	defaults := NewPortGroup("application-default", "")
+	for _, app := range r.applications {
+		if err := defaults.Add(app.Defaults()); err != nil {
+			return fmt.Errorf("failed to add default ports of %s: %v", app.Name(), err)
+		}
+	}
+	r.port = defaults
+	return nil
+}
+
+// AddUser scopes the rule to traffic from the user.
+func (r *Rule) AddUser(u *User) {
+	r.users = append(r.users, u)
+}
+
+// AddUserGroup scopes the rule to traffic from members of the group.
+func (r *Rule) AddUserGroup(g *UserGroup) {
+	r.userGroups = append(r.userGroups, g)
+}
+
+// Users returns a copy of the rule's users.
+func (r *Rule) Users() []*User {
+	result := make([]*User, len(r.users))
+	copy(result, r.users)
+	return result
+}
+
+// UserGroups returns a copy of the rule's user groups.
+func (r *Rule) UserGroups() []*UserGroup {
+	result := make([]*UserGroup, len(r.userGroups))
+	copy(result, r.userGroups)
+	return result
+}
+
+// MatchUser returns true if the rule applies to the named user or user group:
+// the rule isn't scoped to any users, lists the name, or lists a group that
+// includes it.
+func (r *Rule) MatchUser(name string) bool {
+	if len(r.users) == 0 && len(r.userGroups) == 0 {
+		return true
+	}
+	for _, u := range r.users {
+		if u.name == name {
+			return true
+		}
+	}
+	for _, g := range r.userGroups {
+		if g.Includes(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetSchedule limits the rule to the times the schedule applies. Pass nil to
+// have the rule always apply.
+func (r *Rule) SetSchedule(s *Schedule) {
+	r.schedule = s
+}
+
+// Schedule returns the rule's schedule, nil if it always applies.
+func (r *Rule) Schedule() *Schedule {
+	return r.schedule
+}
+
+// ActiveAt returns true if the rule applies at t.
+func (r *Rule) ActiveAt(t time.Time) bool {
+	return r.schedule == nil || r.schedule.Active(t)
+}
+
+// Scoped returns true if the rule only applies to some of the traffic its
+// addresses and services match: it is limited to zones, applications, users
+// or a schedule.
+func (r *Rule) Scoped() bool {
+	return len(r.fromZones) > 0 || len(r.toZones) > 0 ||
+		len(r.applications) > 0 || len(r.users) > 0 || len(r.userGroups) > 0 ||
+		r.schedule != nil
+}
+
+// clone returns a copy of the rule whose zone, application and user lists can
+// be changed without affecting the original.
+func (r *Rule) clone() *Rule {
+	c := *r
+	c.fromZones = append([]*Zone{}, r.fromZones...)
+	c.toZones = append([]*Zone{}, r.toZones...)
+	c.applications = append([]*Application{}, r.applications...)
+	c.users = append([]*User{}, r.users...)
+	c.userGroups = append([]*UserGroup{}, r.userGroups...)
+	return &c
+}
+
+// WithName returns a copy of the rule with a new name. Copies keep the UID of
+// the original, so they can replace it with a store's Update.
+func (r *Rule) WithName(name string) *Rule {
+	c := r.clone()
+	c.name = name
+	return c
+}
+
+// WithNumber returns a copy of the rule at a new position in the policy.
+func (r *Rule) WithNumber(number int) *Rule {
+	c := r.clone()
+	c.number = number
+	return c
+}
+
+// WithSource returns a copy of the rule with a new source group.
+func (r *Rule) WithSource(src *Group) *Rule {
+	c := r.clone()
+	c.source = src
+	return c
+}
+
+// WithDestination returns a copy of the rule with a new destination group.
+func (r *Rule) WithDestination(dst *Group) *Rule {
+	c := r.clone()
+	c.destination = dst
+	return c
+}
+
+// WithPort returns a copy of the rule with a new service group.
+func (r *Rule) WithPort(prt *PortGroup) *Rule {
+	c := r.clone()
+	c.port = prt
+	return c
+}
+
+// WithAction returns a copy of the rule with a new action, true to permit.
+func (r *Rule) WithAction(action bool) *Rule {
+	c := r.clone()
+	c.action = action
+	return c
+}
+
+// WithComment returns a copy of the rule with a new comment.
+func (r *Rule) WithComment(comment string) *Rule {
+	c := r.clone()
+	c.comment = comment
+	return c
+}
+
+// WithFromZones returns a copy of the rule scoped to new ingress zones, none
+// meaning any zone.
+func (r *Rule) WithFromZones(zones ...*Zone) *Rule {
+	c := r.clone()
+	c.fromZones = append([]*Zone{}, zones...)
+	return c
+}
+
+// WithToZones returns a copy of the rule scoped to new egress zones, none
+// meaning any zone.
+func (r *Rule) WithToZones(zones ...*Zone) *Rule {
+	c := r.clone()
+	c.toZones = append([]*Zone{}, zones...)
+	return c
+}
+
+// WithApplications returns a copy of the rule scoped to new applications,
+// none meaning any application.
+func (r *Rule) WithApplications(apps ...*Application) *Rule {
+	c := r.clone()
+	c.applications = append([]*Application{}, apps...)
+	return c
+}
+
+// WithUsers returns a copy of the rule scoped to new users and user groups,
+// none of either meaning any user.
+func (r *Rule) WithUsers(users []*User, groups []*UserGroup) *Rule {
+	c := r.clone()
+	c.users = append([]*User{}, users...)
+	c.userGroups = append([]*UserGroup{}, groups...)
+	return c
+}
+
+// WithSchedule returns a copy of the rule with a new schedule, nil to have it
+// always apply.
+func (r *Rule) WithSchedule(s *Schedule) *Rule {
+	c := r.clone()
+	c.schedule = s
+	return c
+}
+
 type Haser interface {
 	HasObject(obj interface{}) (bool, error)
 }
@@ -73,17 +361,33 @@ func HasInService() func(*Rule) Haser {
 }
 
 type NetContainser interface {
-	Contains(obj NetworkObject) bool
+	Contains(obj NetworkUnpacker) bool
 }
 
-func ContainsInSource() func(*Rule) Haser {
-	return func(r *Rule) Haser {
+func ContainsInSource() func(*Rule) NetContainser {
+	return func(r *Rule) NetContainser {
 		return r.source
 	}
 }
 
-func ContainsInDestination() func(*Rule) Haser {
-	return func(r *Rule) Haser {
+func ContainsInDestination() func(*Rule) NetContainser {
+	return func(r *Rule) NetContainser {
+		return r.destination
+	}
+}
+
+type NetOverlapper interface {
+	Overlaps(obj NetworkUnpacker) bool
+}
+
+func OverlapsInSource() func(*Rule) NetOverlapper {
+	return func(r *Rule) NetOverlapper {
+		return r.source
+	}
+}
+
+func OverlapsInDestination() func(*Rule) NetOverlapper {
+	return func(r *Rule) NetOverlapper {
 		return r.destination
 	}
 }
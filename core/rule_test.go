@@ -1,3 +1,34 @@
 package core
 
+import "testing"
 
+func TestRuleWith(t *testing.T) {
+	original := NewNamedRule("allow-web", 1, NewGroup("src", ""), NewGroup("dst", ""), NewPortGroup("svc", ""), true, "")
+	original.AddFromZone(NewZone("trust", ""))
+
+	updated := original.WithAction(false).WithNumber(5).WithComment("CHG-1")
+	updated.AddFromZone(NewZone("dmz", ""))
+
+	if updated.UID() != original.UID() {
+		t.Fatalf("expected the copy to keep the uid")
+	}
+	if updated.Action() || updated.Number() != 5 || updated.Comment() != "CHG-1" {
+		t.Fatalf("copy wasn't updated: %+v", updated)
+	}
+	if !original.Action() || original.Number() != 1 || original.Comment() != "" || len(original.FromZones()) != 1 {
+		t.Fatalf("original was changed: %+v", original)
+	}
+
+	scoped := original.WithFromZones().
+		WithToZones(NewZone("untrust", "")).
+		WithApplications(NewApplication("ssl", "")).
+		WithUsers([]*User{NewUser("alice", "")}, []*UserGroup{NewUserGroup("admins", "")})
+	if len(scoped.FromZones()) != 0 || !scoped.MatchToZone("untrust") || len(scoped.Applications()) != 1 ||
+		len(scoped.Users()) != 1 || len(scoped.UserGroups()) != 1 {
+		t.Fatalf("copy wasn't scoped: %+v", scoped)
+	}
+	if len(original.FromZones()) != 1 || len(original.ToZones()) != 0 || len(original.Applications()) != 0 ||
+		len(original.Users()) != 0 || len(original.UserGroups()) != 0 {
+		t.Fatalf("original was changed: %+v", original)
+	}
+}
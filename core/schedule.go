@@ -0,0 +1,203 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidWindow = errors.New("invalid schedule window")
+)
+
+// Window is a recurring weekly time window, i.e. Saturdays 22:00 to 02:00.
+// Start and End are offsets from midnight. A window whose end is at or before
+// its start runs over into the next day.
+type Window struct {
+	Days  []time.Weekday
+	Start time.Duration
+	End   time.Duration
+}
+
+// contains returns true if t, in the schedule's time zone, is in the window.
+func (w Window) contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+	for _, d := range w.Days {
+		if w.End > w.Start {
+			if t.Weekday() == d && offset >= w.Start && offset < w.End {
+				return true
+			}
+			continue
+		}
+		// The window runs over midnight.
+		if t.Weekday() == d && offset >= w.Start {
+			return true
+		}
+		if t.Weekday() == (d+1)%7 && offset < w.End {
+			return true
+		}
+	}
+	return false
+}
+
+// DateRange is a one-off period of time. End is exclusive.
+type DateRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Schedule represents a firewall schedule: the times a rule applies.
+//
+// A schedule applies at a time that is in one of its date ranges and in one of
+// its weekly windows. A schedule without date ranges applies on every date and
+// one without windows at every time of day.
+type Schedule struct {
+	uid      string
+	name     string
+	location *time.Location
+	windows  []Window
+	ranges   []DateRange
+	comment  string
+}
+
+// NewSchedule returns a pointer to a new Schedule that always applies. Its
+// windows are in the named IANA time zone, i.e. Europe/London, UTC if empty.
+func NewSchedule(name, timezone, comment string) (*Schedule, error) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load time zone: %v", err)
+	}
+	uid := uuid.New()
+	return &Schedule{
+		uid:      uid.String(),
+		name:     name,
+		location: location,
+		windows:  make([]Window, 0),
+		ranges:   make([]DateRange, 0),
+		comment:  comment,
+	}, nil
+}
+
+func (s *Schedule) UID() string {
+	return s.uid
+}
+
+func (s *Schedule) Name() string {
+	return s.name
+}
+
+func (s *Schedule) Comment() string {
+	return s.comment
+}
+
+// Location returns the time zone of the schedule's windows.
+func (s *Schedule) Location() *time.Location {
+	return s.location
+}
+
+// AddWindow adds a weekly window running from start to end, both in HH:MM
+// format, on each of the days.
+func (s *Schedule) AddWindow(days []time.Weekday, start, end string) error {
+	if len(days) == 0 {
+		return fmt.Errorf("no days given: %w", ErrInvalidWindow)
+	}
+	from, err := parseClock(start)
+	if err != nil {
+		return err
+	}
+	to, err := parseClock(end)
+	if err != nil {
+		return err
+	}
+	w := Window{Days: make([]time.Weekday, len(days)), Start: from, End: to}
+	copy(w.Days, days)
+	s.windows = append(s.windows, w)
+	return nil
+}
+
+// parseClock parses a time of day in HH:MM format into an offset from
+// midnight. 24:00 is accepted as the end of the day.
+func parseClock(clock string) (time.Duration, error) {
+	var hours, minutes int
+	if _, err := fmt.Sscanf(clock, "%d:%d", &hours, &minutes); err != nil {
+		return 0, fmt.Errorf("failed to parse time of day %s: %w", clock, ErrInvalidWindow)
+	}
+	if hours < 0 || minutes < 0 || minutes > 59 || hours > 24 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("time of day out of range %s: %w", clock, ErrInvalidWindow)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+// AddRange adds a one-off period running from start up to end.
+func (s *Schedule) AddRange(start, end time.Time) error {
+	if !end.After(start) {
+		return fmt.Errorf("range ends before it starts: %w", ErrInvalidWindow)
+	}
+	s.ranges = append(s.ranges, DateRange{Start: start, End: end})
+	return nil
+}
+
+// Windows returns a copy of the schedule's weekly windows.
+func (s *Schedule) Windows() []Window {
+	result := make([]Window, len(s.windows))
+	copy(result, s.windows)
+	return result
+}
+
+// Ranges returns a copy of the schedule's one-off date ranges.
+func (s *Schedule) Ranges() []DateRange {
+	result := make([]DateRange, len(s.ranges))
+	copy(result, s.ranges)
+	return result
+}
+
+// Active returns true if the schedule applies at t.
+func (s *Schedule) Active(t time.Time) bool {
+	if len(s.ranges) > 0 {
+		inRange := false
+		for _, r := range s.ranges {
+			if !t.Before(r.Start) && t.Before(r.End) {
+				inRange = true
+				break
+			}
+		}
+		if !inRange {
+			return false
+		}
+	}
+	if len(s.windows) == 0 {
+		return true
+	}
+	local := t.In(s.location)
+	for _, w := range s.windows {
+		if w.contains(local) {
+			return true
+		}
+	}
+	return false
+}
+
+// Expiry returns the time after which the schedule never applies again, the
+// end of its last date range. ok is false if the schedule has no date ranges
+// and so never expires.
+func (s *Schedule) Expiry() (expiry time.Time, ok bool) {
+	for _, r := range s.ranges {
+		if r.End.After(expiry) {
+			expiry = r.End
+		}
+	}
+	return expiry, len(s.ranges) > 0
+}
+
+// Expired returns true if the schedule never applies again after t.
+func (s *Schedule) Expired(t time.Time) bool {
+	expiry, ok := s.Expiry()
+	return ok && !t.Before(expiry)
+}
+
+func (s *Schedule) String() string {
+	return s.name
+}
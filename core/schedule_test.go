@@ -0,0 +1,47 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleActive(t *testing.T) {
+	s, err := NewSchedule("maintenance", "UTC", "")
+	if err != nil {
+		t.Fatalf("failed to create schedule: %v", err)
+	}
+	if err := s.AddWindow([]time.Weekday{time.Saturday}, "22:00", "02:00"); err != nil {
+		t.Fatalf("failed to add window: %v", err)
+	}
+	start := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	if err := s.AddRange(start, start.AddDate(0, 1, 0)); err != nil {
+		t.Fatalf("failed to add range: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want bool
+	}{
+		{name: "Saturday night", at: time.Date(2024, time.March, 2, 23, 0, 0, 0, time.UTC), want: true},
+		{name: "Sunday morning", at: time.Date(2024, time.March, 3, 1, 59, 0, 0, time.UTC), want: true},
+		{name: "After window", at: time.Date(2024, time.March, 3, 2, 0, 0, 0, time.UTC), want: false},
+		{name: "Saturday afternoon", at: time.Date(2024, time.March, 2, 15, 0, 0, 0, time.UTC), want: false},
+		{name: "Before range", at: time.Date(2024, time.February, 24, 23, 0, 0, 0, time.UTC), want: false},
+		{name: "After range", at: time.Date(2024, time.April, 6, 23, 0, 0, 0, time.UTC), want: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := s.Active(tc.at); got != tc.want {
+				t.Fatalf("want: %t, got: %t", tc.want, got)
+			}
+		})
+	}
+
+	if !s.Expired(start.AddDate(0, 1, 0)) || s.Expired(start) {
+		t.Fatalf("expected schedule to expire at the end of its range")
+	}
+	if err := s.AddWindow([]time.Weekday{time.Monday}, "25:00", "26:00"); err == nil {
+		t.Fatalf("expected error for out of range window")
+	}
+}
@@ -0,0 +1,306 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNoSourcePorts = errors.New("only tcp and udp services have source ports")
+)
+
+// Service represents a service of any protocol: a tcp or udp port range, an
+// ICMP type and code, an IP protocol number, ip or any.
+//
+// TCP and UDP services can also be restricted to a range of source ports.
+// Set operations only look at the destination side, so flattening a group
+// drops the restriction; use Allows to check a packet against it.
+type Service struct {
+	uid      string
+	name     string
+	protocol int
+	// Destination ports, ICMP services keep their type and code as ICMPPort.
+	start uint
+	end   uint
+	// Source port range, only used if source is true.
+	source      bool
+	sourceStart uint
+	sourceEnd   uint
+	comment     string
+}
+
+// NewService returns a pointer to a new Service for a range of destination
+// ports. The ports are ignored for protocols that don't have any, i.e. gre.
+func NewService(name, protocol string, start, end uint, comment string) (*Service, error) {
+	protoEnum := String2Proto(protocol)
+	if protoEnum == -1 {
+		return nil, fmt.Errorf("failed to create new Service object because invalid protocol provided: %s", protocol)
+	}
+	if !HasPorts(protoEnum) {
+		start, end = 0, 0
+	}
+	if start > end || end > maxPort {
+		return nil, fmt.Errorf("failed to create new Service object because invalid port range provided: %d-%d", start, end)
+	}
+	return newService(name, protoEnum, start, end, comment), nil
+}
+
+// NewICMPService returns a pointer to a new ICMP or ICMPv6 Service. Pass -1
+// as the code to match every code of the type, and -1 as both to match every
+// ICMP message.
+func NewICMPService(name, protocol string, icmpType, code int, comment string) (*Service, error) {
+	protoEnum := String2Proto(protocol)
+	if protoEnum != ICMP && protoEnum != ICMPv6 {
+		return nil, fmt.Errorf("failed to create new ICMP Service object because protocol isn't icmp or icmpv6: %s", protocol)
+	}
+	if icmpType < -1 || icmpType > 255 || code < -1 || code > 255 || (icmpType == -1 && code != -1) {
+		return nil, fmt.Errorf("failed to create new ICMP Service object because invalid type or code provided: %d/%d", icmpType, code)
+	}
+	start, end := uint(0), uint(maxPort)
+	switch {
+	case code != -1:
+		start = ICMPPort(uint8(icmpType), uint8(code))
+		end = start
+	case icmpType != -1:
+		start = ICMPPort(uint8(icmpType), 0)
+		end = ICMPPort(uint8(icmpType), 255)
+	}
+	return newService(name, protoEnum, start, end, comment), nil
+}
+
+// NewProtocolService returns a pointer to a new Service matching every
+// packet of an IP protocol number.
+func NewProtocolService(name string, number uint8, comment string) *Service {
+	protoEnum := ProtocolNumber(number)
+	var end uint
+	if HasPorts(protoEnum) {
+		end = maxPort
+	}
+	return newService(name, protoEnum, 0, end, comment)
+}
+
+// NewAnyService returns a pointer to a new Service matching every packet.
+func NewAnyService(name, comment string) *Service {
+	return newService(name, Any, 0, 0, comment)
+}
+
+// ParseService returns a Service from its string form, one of:
+//
+//	any, ip, gre, 47, proto-47           a whole protocol
+//	tcp/443, udp/5000-5010               destination ports
+//	icmp, icmp/3, icmp/8:0, icmpv6/128   ICMP messages by type and code
+//
+// A tcp or udp service may be followed by " sport <port>[-<port>]" to
+// restrict its source ports.
+func ParseService(name, service, comment string) (*Service, error) {
+	var sport string
+	if fields := strings.Fields(service); len(fields) == 3 && fields[1] == "sport" {
+		service, sport = fields[0], fields[2]
+	}
+
+	parts := strings.SplitN(strings.TrimSpace(service), "/", 2)
+	protocol := String2Proto(parts[0])
+	if protocol == -1 {
+		return nil, fmt.Errorf("invalid protocol: %s", parts[0])
+	}
+
+	var svc *Service
+	switch {
+	case len(parts) == 1:
+		if HasPorts(protocol) {
+			svc = newService(name, protocol, 0, maxPort, comment)
+		} else {
+			svc = newService(name, protocol, 0, 0, comment)
+		}
+	case protocol == ICMP || protocol == ICMPv6:
+		icmpType, code, err := parseICMP(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		svc, err = NewICMPService(name, parts[0], icmpType, code, comment)
+		if err != nil {
+			return nil, err
+		}
+	case HasPorts(protocol):
+		start, end, err := parsePorts(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		svc, err = NewService(name, parts[0], start, end, comment)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("protocol doesn't have ports: %s", parts[0])
+	}
+
+	if sport != "" {
+		start, end, err := parsePorts(sport)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source ports: %v", err)
+		}
+		if err := svc.SetSourcePorts(start, end); err != nil {
+			return nil, err
+		}
+	}
+	return svc, nil
+}
+
+// parsePorts parses a port or a start-end port range.
+func parsePorts(ports string) (uint, uint, error) {
+	bounds := strings.SplitN(ports, "-", 2)
+	start, err := strconv.ParseUint(bounds[0], 10, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port: %s", bounds[0])
+	}
+	end := start
+	if len(bounds) == 2 {
+		end, err = strconv.ParseUint(bounds[1], 10, 16)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid port: %s", bounds[1])
+		}
+	}
+	return uint(start), uint(end), nil
+}
+
+// parseICMP parses an ICMP type with an optional code, i.e. 8 or 8:0.
+func parseICMP(icmp string) (int, int, error) {
+	values := strings.SplitN(icmp, ":", 2)
+	icmpType, err := strconv.ParseUint(values[0], 10, 8)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid ICMP type: %s", values[0])
+	}
+	code := -1
+	if len(values) == 2 {
+		c, err := strconv.ParseUint(values[1], 10, 8)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid ICMP code: %s", values[1])
+		}
+		code = int(c)
+	}
+	return int(icmpType), code, nil
+}
+
+func newService(name string, protocol int, start, end uint, comment string) *Service {
+	uid := uuid.New()
+	return &Service{
+		uid:      uid.String(),
+		name:     name,
+		protocol: protocol,
+		start:    start,
+		end:      end,
+		comment:  comment,
+	}
+}
+
+func (s *Service) UID() string {
+	return s.uid
+}
+
+func (s *Service) Name() string {
+	return s.name
+}
+
+func (s *Service) Comment() string {
+	return s.comment
+}
+
+// Protocol returns the protocol enum of the service.
+func (s *Service) Protocol() int {
+	return s.protocol
+}
+
+// SetSourcePorts restricts a tcp or udp service to a range of source ports.
+func (s *Service) SetSourcePorts(start, end uint) error {
+	if s.protocol != TCP && s.protocol != UDP {
+		return fmt.Errorf("failed to set source ports of %s: %w", s, ErrNoSourcePorts)
+	}
+	if start > end || end > maxPort {
+		return fmt.Errorf("invalid source port range: %d-%d", start, end)
+	}
+	s.source = true
+	s.sourceStart = start
+	s.sourceEnd = end
+	return nil
+}
+
+// SourcePorts returns the source port range of the service. ok is false if
+// the service matches any source port.
+func (s *Service) SourcePorts() (start uint, end uint, ok bool) {
+	return s.sourceStart, s.sourceEnd, s.source
+}
+
+// String returns the service in the notation of ParseService.
+func (s *Service) String() string {
+	str := PortInterval{Start: s.start, End: s.end, Protocol: s.protocol}.String()
+	if !s.source {
+		return str
+	}
+	if s.sourceStart == s.sourceEnd {
+		return fmt.Sprintf("%s sport %d", str, s.sourceStart)
+	}
+	return fmt.Sprintf("%s sport %d-%d", str, s.sourceStart, s.sourceEnd)
+}
+
+// Value satisfies the PortObject interface, it returns the destination side
+// of the service.
+func (s *Service) Value() (start uint, end uint, proto int) {
+	return s.start, s.end, s.protocol
+}
+
+// Match will return true if both services match the same traffic.
+func (s *Service) Match(svc *Service) bool {
+	return s.protocol == svc.protocol && s.start == svc.start && s.end == svc.end &&
+		s.source == svc.source && s.sourceStart == svc.sourceStart && s.sourceEnd == svc.sourceEnd
+}
+
+// Contains returns true if every service of obj is matched by the service.
+// If the service has source ports, obj must be a Service whose source ports
+// are within them.
+func (s *Service) Contains(obj PortObject) bool {
+	if !(PortInterval{Start: s.start, End: s.end, Protocol: s.protocol}).Contains(obj) {
+		return false
+	}
+	if !s.source {
+		return true
+	}
+	other, ok := obj.(*Service)
+	if !ok || !other.source {
+		return false
+	}
+	return s.sourceStart <= other.sourceStart && s.sourceEnd >= other.sourceEnd
+}
+
+// Allows returns true if the service matches a packet. dstPort is the
+// destination port, or the ICMPPort of an ICMP packet.
+func (s *Service) Allows(protocol int, srcPort, dstPort uint) bool {
+	packet := PortInterval{Start: dstPort, End: dstPort, Protocol: protocol}
+	if !(PortInterval{Start: s.start, End: s.end, Protocol: s.protocol}).Contains(packet) {
+		return false
+	}
+	return !s.source || (srcPort >= s.sourceStart && srcPort <= s.sourceEnd)
+}
+
+// UnpackPorts satisfies the PortUnpacker interface.
+func (s *Service) UnpackPorts() PortSet {
+	return NewPortSet(s)
+}
+
+// WithName returns a copy of the service with a new name. Copies keep the
+// UID of the original, so they can replace it with a store's Update.
+func (s *Service) WithName(name string) *Service {
+	c := *s
+	c.name = name
+	return &c
+}
+
+// WithComment returns a copy of the service with a new comment.
+func (s *Service) WithComment(comment string) *Service {
+	c := *s
+	c.comment = comment
+	return &c
+}
@@ -0,0 +1,139 @@
+package core
+
+import "testing"
+
+func TestParseService(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+		err  bool
+	}{
+		{name: "tcp port", in: "tcp/443", want: "tcp/443"},
+		{name: "udp range", in: "udp/5000-5010", want: "udp/5000-5010"},
+		{name: "whole protocol", in: "tcp", want: "tcp/0-65535"},
+		{name: "icmp type and code", in: "icmp/8:0", want: "icmp/8:0"},
+		{name: "icmp type", in: "icmp/3", want: "icmp/3"},
+		{name: "any icmp", in: "icmpv6", want: "icmpv6"},
+		{name: "protocol name", in: "gre", want: "gre"},
+		{name: "protocol number", in: "112", want: "vrrp"},
+		{name: "ip", in: "ip", want: "ip"},
+		{name: "any", in: "any", want: "any"},
+		{name: "source ports", in: "udp/53 sport 1024-65535", want: "udp/53 sport 1024-65535"},
+		{name: "source ports on icmp", in: "icmp/8 sport 1024", err: true},
+		{name: "icmp code out of range", in: "icmp/3:256", err: true},
+		{name: "ports on protocol number", in: "gre/1", err: true},
+		{name: "invalid protocol", in: "xma/1", err: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			svc, err := ParseService("test", tc.in, "")
+			if err != nil {
+				if tc.err {
+					return
+				}
+				t.Fatalf("got error when not expected: %v", err)
+			}
+			if tc.err {
+				t.Fatalf("expected error, but got none")
+			}
+			if got := svc.String(); got != tc.want {
+				t.Fatalf("want: %s, got: %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestServiceContains(t *testing.T) {
+	parse := func(s string) *Service {
+		svc, err := ParseService(s, s, "")
+		if err != nil {
+			t.Fatalf("failed to parse service %s: %v", s, err)
+		}
+		return svc
+	}
+
+	tests := []struct {
+		name  string
+		outer string
+		inner string
+		want  bool
+	}{
+		{name: "ip contains tcp", outer: "ip", inner: "tcp/443", want: true},
+		{name: "ip contains protocol number", outer: "ip", inner: "gre", want: true},
+		{name: "ip doesn't contain arp", outer: "ip", inner: "arp", want: false},
+		{name: "any contains arp", outer: "any", inner: "arp", want: true},
+		{name: "tcp doesn't contain ip", outer: "tcp", inner: "ip", want: false},
+		{name: "icmp type contains code", outer: "icmp/3", inner: "icmp/3:1", want: true},
+		{name: "icmp code doesn't contain type", outer: "icmp/3:1", inner: "icmp/3", want: false},
+		{name: "icmp isn't icmpv6", outer: "icmp", inner: "icmpv6/128", want: false},
+		{name: "source ports contain narrower", outer: "tcp/22 sport 1024-65535", inner: "tcp/22 sport 2000", want: true},
+		{name: "source ports don't contain any source", outer: "tcp/22 sport 1024-65535", inner: "tcp/22", want: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pg := NewPortGroup("outer", "")
+			if err := pg.Add(parse(tc.outer)); err != nil {
+				t.Fatalf("failed to add service to group: %v", err)
+			}
+			if got := pg.Contains(parse(tc.inner)); got != tc.want {
+				t.Fatalf("want: %t, got: %t", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestServiceSets(t *testing.T) {
+	ip, _ := ParseService("ip", "ip", "")
+	web, _ := ParseService("web", "tcp/443", "")
+
+	set := NewPortSet(ip)
+	if got := set.String(); got != "ip" {
+		t.Fatalf("want: ip, got: %s", got)
+	}
+	if !set.Contains(web) {
+		t.Fatalf("expected ip to contain %s", web)
+	}
+	if got := set.Intersect(NewPortSet(web)).String(); got != "tcp/443" {
+		t.Fatalf("want: tcp/443, got: %s", got)
+	}
+	if got := set.Union(PortSet{{Start: 0, End: maxPort, Protocol: ARP}}).String(); got != "any" {
+		t.Fatalf("want: any, got: %s", got)
+	}
+}
+
+func TestServiceAllows(t *testing.T) {
+	dns, err := ParseService("dns", "udp/53 sport 1024-65535", "")
+	if err != nil {
+		t.Fatalf("failed to parse service: %v", err)
+	}
+	echo, err := NewICMPService("echo", "icmp", 8, -1, "")
+	if err != nil {
+		t.Fatalf("failed to create ICMP service: %v", err)
+	}
+	pg := NewPortGroup("svc", "")
+	for _, svc := range []*Service{dns, echo} {
+		if err := pg.Add(svc); err != nil {
+			t.Fatalf("failed to add service to group: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		protocol int
+		src, dst uint
+		want     bool
+	}{
+		{name: "high source port", protocol: UDP, src: 40000, dst: 53, want: true},
+		{name: "low source port", protocol: UDP, src: 53, dst: 53, want: false},
+		{name: "echo request", protocol: ICMP, dst: ICMPPort(8, 0), want: true},
+		{name: "echo reply", protocol: ICMP, dst: ICMPPort(0, 0), want: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := pg.Allows(tc.protocol, tc.src, tc.dst); got != tc.want {
+				t.Fatalf("want: %t, got: %t", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package core
+
+import (
+	"sort"
+
+	"github.com/Neffats/ip"
+)
+
+// span is a closed interval used to share the set algebra between addresses
+// and ports. Spans passed to the helpers below must already be normalized.
+type span struct {
+	start uint64
+	end   uint64
+}
+
+func unionSpans(a, b []span) []span {
+	all := make([]span, 0, len(a)+len(b))
+	all = append(all, a...)
+	all = append(all, b...)
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].start < all[j].start
+	})
+
+	result := make([]span, 0, len(all))
+	for _, s := range all {
+		if len(result) > 0 && s.start <= result[len(result)-1].end+1 {
+			if s.end > result[len(result)-1].end {
+				result[len(result)-1].end = s.end
+			}
+			continue
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+func intersectSpans(a, b []span) []span {
+	result := make([]span, 0)
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		start := a[i].start
+		if b[j].start > start {
+			start = b[j].start
+		}
+		end := a[i].end
+		if b[j].end < end {
+			end = b[j].end
+		}
+		if start <= end {
+			result = append(result, span{start, end})
+		}
+		// Move on from whichever interval finishes first.
+		if a[i].end < b[j].end {
+			i++
+		} else {
+			j++
+		}
+	}
+	return result
+}
+
+func differenceSpans(a, b []span) []span {
+	result := make([]span, 0)
+	j := 0
+	for _, s := range a {
+		start := s.start
+		// Skip everything in b that finishes before this interval.
+		for j < len(b) && b[j].end < start {
+			j++
+		}
+		k := j
+		for k < len(b) && b[k].start <= s.end {
+			if b[k].start > start {
+				result = append(result, span{start, b[k].start - 1})
+			}
+			start = b[k].end + 1
+			k++
+		}
+		if start <= s.end {
+			result = append(result, span{start, s.end})
+		}
+	}
+	return result
+}
+
+func (s AddressSet) spans() []span {
+	result := make([]span, len(s))
+	for i, o := range s {
+		result[i] = span{uint64(o.Start), uint64(o.End)}
+	}
+	return result
+}
+
+func addressSetFromSpans(spans []span) AddressSet {
+	result := make(AddressSet, len(spans))
+	for i, s := range spans {
+		result[i] = NetworkObject{Start: ip.Address(s.start), End: ip.Address(s.end)}
+	}
+	return result
+}
+
+// Union returns every address that is in either set.
+func (s AddressSet) Union(other AddressSet) AddressSet {
+	return addressSetFromSpans(unionSpans(s.spans(), other.spans()))
+}
+
+// Intersect returns every address that is in both sets.
+func (s AddressSet) Intersect(other AddressSet) AddressSet {
+	return addressSetFromSpans(intersectSpans(s.spans(), other.spans()))
+}
+
+// Difference returns every address in the set that is not in other.
+func (s AddressSet) Difference(other AddressSet) AddressSet {
+	return addressSetFromSpans(differenceSpans(s.spans(), other.spans()))
+}
+
+// Overlaps returns true if the two sets have at least one address in common.
+func (s AddressSet) Overlaps(other AddressSet) bool {
+	return len(intersectSpans(s.spans(), other.spans())) > 0
+}
+
+// Union returns the addresses covered by either a or b.
+func Union(a, b NetworkUnpacker) AddressSet {
+	return NewAddressSet(a).Union(NewAddressSet(b))
+}
+
+// Intersection returns the addresses covered by both a and b.
+func Intersection(a, b NetworkUnpacker) AddressSet {
+	return NewAddressSet(a).Intersect(NewAddressSet(b))
+}
+
+// Difference returns the addresses covered by a that are not covered by b.
+// i.e. "what addresses in group A are not covered by group B".
+func Difference(a, b NetworkUnpacker) AddressSet {
+	return NewAddressSet(a).Difference(NewAddressSet(b))
+}
+
+// Overlap returns true if a and b have any address in common.
+func Overlap(a, b NetworkUnpacker) bool {
+	return NewAddressSet(a).Overlaps(NewAddressSet(b))
+}
+
+// UnpackPorts satisfies the PortUnpacker interface.
+func (s PortSet) UnpackPorts() PortSet {
+	result := make(PortSet, len(s))
+	copy(result, s)
+	return result
+}
+
+// spans returns the intervals of the set for proto. All of the ports are
+// returned if proto is covered by an ip or any service of the set.
+func (s PortSet) spans(proto int) []span {
+	result := make([]span, 0)
+	for _, p := range s {
+		switch {
+		case p.Protocol == proto:
+			result = append(result, span{uint64(p.Start), uint64(p.End)})
+		case protoCovers(p.Protocol, proto):
+			return []span{{0, maxPort}}
+		}
+	}
+	return result
+}
+
+// protocols returns the protocols that either set has services of, besides
+// the ip and any services. ARP is included if either set has an any service.
+func (s PortSet) protocols(other PortSet) []int {
+	seen := make(map[int]bool)
+	result := make([]int, 0)
+	for _, set := range []PortSet{s, other} {
+		for _, p := range set {
+			proto := p.Protocol
+			switch proto {
+			case IP:
+				continue
+			case Any:
+				proto = ARP
+			}
+			if !seen[proto] {
+				seen[proto] = true
+				result = append(result, proto)
+			}
+		}
+	}
+	sort.Ints(result)
+	return result
+}
+
+// combine applies op to each protocol of the two sets in turn. The IP
+// protocols that neither set has services of are all either wholly in a set
+// or not at all, so they are worked out together and only listed one by one
+// when the result doesn't cover every IP protocol.
+func (s PortSet) combine(other PortSet, op func(a, b []span) []span) PortSet {
+	result := make([]PortInterval, 0)
+	listed := make(map[int]bool)
+	// partial is set once a listed IP protocol doesn't end up whole.
+	partial := false
+	for _, proto := range s.protocols(other) {
+		listed[proto] = true
+		spans := op(s.spans(proto), other.spans(proto))
+		if isIPProtocol(proto) && (len(spans) != 1 || spans[0] != span{0, maxPort}) {
+			partial = true
+		}
+		for _, sp := range spans {
+			result = append(result, PortInterval{Start: uint(sp.start), End: uint(sp.end), Protocol: proto})
+		}
+	}
+	if len(op(s.spans(IP), other.spans(IP))) > 0 {
+		if !partial {
+			result = append(result, PortInterval{Start: 0, End: maxPort, Protocol: IP})
+		} else {
+			for _, p := range ipProtocols() {
+				if !listed[p.Protocol] {
+					result = append(result, p)
+				}
+			}
+		}
+	}
+	return normalizePorts(result)
+}
+
+// Union returns every service that is in either set.
+func (s PortSet) Union(other PortSet) PortSet {
+	return s.combine(other, unionSpans)
+}
+
+// Intersect returns every service that is in both sets.
+func (s PortSet) Intersect(other PortSet) PortSet {
+	return s.combine(other, intersectSpans)
+}
+
+// Difference returns every service in the set that is not in other.
+func (s PortSet) Difference(other PortSet) PortSet {
+	return s.combine(other, differenceSpans)
+}
+
+// Overlaps returns true if the two sets have at least one service in common.
+func (s PortSet) Overlaps(other PortSet) bool {
+	return len(s.Intersect(other)) > 0
+}
+
+// UnionPorts returns the services covered by either a or b.
+func UnionPorts(a, b PortUnpacker) PortSet {
+	return a.UnpackPorts().Union(b.UnpackPorts())
+}
+
+// IntersectionPorts returns the services covered by both a and b.
+func IntersectionPorts(a, b PortUnpacker) PortSet {
+	return a.UnpackPorts().Intersect(b.UnpackPorts())
+}
+
+// DifferencePorts returns the services covered by a that are not covered by b.
+func DifferencePorts(a, b PortUnpacker) PortSet {
+	return a.UnpackPorts().Difference(b.UnpackPorts())
+}
+
+// OverlapPorts returns true if a and b have any service in common.
+func OverlapPorts(a, b PortUnpacker) bool {
+	return a.UnpackPorts().Overlaps(b.UnpackPorts())
+}
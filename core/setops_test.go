@@ -0,0 +1,162 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+// testGroup builds a group from a list of CIDR strings i.e. 10.0.0.0/255.255.255.0
+func testGroup(t *testing.T, name string, nets ...string) *Group {
+	t.Helper()
+	grp := NewGroup(name, "")
+	for _, n := range nets {
+		parts := strings.Split(n, "/")
+		net, err := NewNetwork(n, parts[0], parts[1], "")
+		if err != nil {
+			t.Fatalf("failed to create test network %s: %v", n, err)
+		}
+		if err := grp.Add(net); err != nil {
+			t.Fatalf("failed to add %s to group: %v", n, err)
+		}
+	}
+	return grp
+}
+
+func TestAddressSetAlgebra(t *testing.T) {
+	a := testGroup(t, "a", "10.0.0.0/255.255.255.0", "10.0.2.0/255.255.255.0")
+	b := testGroup(t, "b", "10.0.0.128/255.255.255.128", "10.0.1.0/255.255.255.0")
+	c := testGroup(t, "c", "192.168.0.0/255.255.0.0")
+
+	tests := []struct {
+		name string
+		got  AddressSet
+		want string
+	}{
+		{name: "Union", got: Union(a, b), want: "10.0.0.0-10.0.2.255"},
+		{name: "Intersection", got: Intersection(a, b), want: "10.0.0.128/25"},
+		{name: "Difference", got: Difference(a, b), want: "10.0.0.0/25, 10.0.2.0/24"},
+		{name: "Reverse difference", got: Difference(b, a), want: "10.0.1.0/24"},
+		{name: "Disjoint intersection", got: Intersection(a, c), want: ""},
+		{name: "Difference with nothing removed", got: Difference(c, a), want: "192.168.0.0/16"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.got.String() != tc.want {
+				t.Fatalf("want: %s, got: %s", tc.want, tc.got)
+			}
+		})
+	}
+
+	if !Overlap(a, b) {
+		t.Fatalf("expected a and b to overlap")
+	}
+	if Overlap(a, c) {
+		t.Fatalf("expected a and c not to overlap")
+	}
+}
+
+func TestDifferenceSplitsInterval(t *testing.T) {
+	a := testGroup(t, "a", "10.0.0.0/255.255.255.0")
+	host, err := NewHost("host", "10.0.0.10", "")
+	if err != nil {
+		t.Fatalf("failed to create test host: %v", err)
+	}
+	got := Difference(a, host)
+	want := "10.0.0.0-10.0.0.9, 10.0.0.11-10.0.0.255"
+	if got.String() != want {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+}
+
+func TestPortSetAlgebra(t *testing.T) {
+	web := NewPortGroup("web", "")
+	webRange, err := NewPortRange("web", 80, 443, "tcp", "")
+	if err != nil {
+		t.Fatalf("failed to create test port range: %v", err)
+	}
+	if err := web.Add(webRange); err != nil {
+		t.Fatalf("failed to add range to group: %v", err)
+	}
+	dns, err := NewPort("dns", 53, "udp", "")
+	if err != nil {
+		t.Fatalf("failed to create test port: %v", err)
+	}
+	if err := web.Add(dns); err != nil {
+		t.Fatalf("failed to add port to group: %v", err)
+	}
+	https, err := NewPort("https", 443, "tcp", "")
+	if err != nil {
+		t.Fatalf("failed to create test port: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  PortSet
+		want string
+	}{
+		{name: "Union", got: UnionPorts(web, https), want: "tcp/80-443, udp/53"},
+		{name: "Intersection", got: IntersectionPorts(web, https), want: "tcp/443"},
+		{name: "Difference", got: DifferencePorts(web, https), want: "tcp/80-442, udp/53"},
+		{name: "Reverse difference", got: DifferencePorts(https, web), want: ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.got.String() != tc.want {
+				t.Fatalf("want: %s, got: %s", tc.want, tc.got)
+			}
+		})
+	}
+
+	if !OverlapPorts(web, https) {
+		t.Fatalf("expected web and https to overlap")
+	}
+	if OverlapPorts(dns, https) {
+		t.Fatalf("expected udp and tcp ports not to overlap")
+	}
+}
+
+func TestPortSetWildcards(t *testing.T) {
+	ip := NewPortSet(PortInterval{Protocol: IP})
+	every := NewPortSet(PortInterval{Protocol: Any})
+	arp := NewPortSet(PortInterval{Protocol: ARP})
+	https := NewPortSet(PortInterval{Start: 443, End: 443, Protocol: TCP})
+
+	tests := []struct {
+		name string
+		got  PortSet
+		want string
+		// wantLen is the number of intervals the set is made of.
+		wantLen int
+	}{
+		{name: "ip is a single interval", got: ip, want: "ip", wantLen: 1},
+		{name: "any is a single interval", got: every, want: "any", wantLen: 1},
+		{name: "Every IP protocol collapses to ip", got: normalizePorts(ipProtocols()), want: "ip", wantLen: 1},
+		{name: "ip and arp collapse to any", got: ip.Union(arp), want: "any", wantLen: 1},
+		{name: "ip swallows its protocols", got: ip.Union(https), want: "ip", wantLen: 1},
+		{name: "Intersection with a protocol", got: ip.Intersect(https), want: "tcp/443", wantLen: 1},
+		{name: "Difference with a protocol", got: ip.Difference(https), wantLen: 257},
+		{name: "Difference put back", got: ip.Difference(https).Union(https), want: "ip", wantLen: 1},
+		{name: "any without ip", got: every.Difference(ip), want: "arp", wantLen: 1},
+		{name: "ip without any", got: ip.Difference(every), want: "", wantLen: 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if len(tc.got) != tc.wantLen {
+				t.Fatalf("want %d intervals, got: %d", tc.wantLen, len(tc.got))
+			}
+			if tc.want != "" && tc.got.String() != tc.want {
+				t.Fatalf("want: %s, got: %s", tc.want, tc.got)
+			}
+		})
+	}
+
+	if !ip.Contains(PortInterval{Start: 22, End: 22, Protocol: TCP}) {
+		t.Fatalf("expected ip to contain tcp/22")
+	}
+	if ip.Difference(https).Contains(PortInterval{Start: 443, End: 443, Protocol: TCP}) {
+		t.Fatalf("expected tcp/443 to be removed")
+	}
+	if got := every.ByProtocol(); len(got) != 257 {
+		t.Fatalf("want any split into 257 protocols, got: %d", len(got))
+	}
+}
@@ -0,0 +1,190 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Traffic is a block of traffic space: every combination of its source
+// addresses, destination addresses and services.
+type Traffic struct {
+	Source      AddressSet
+	Destination AddressSet
+	Service     PortSet
+}
+
+// Traffic returns the block of traffic space matched by the rule.
+func (r *Rule) Traffic() Traffic {
+	t := Traffic{
+		Source:      AddressSet{},
+		Destination: AddressSet{},
+		Service:     PortSet{},
+	}
+	if r.source != nil {
+		t.Source = r.source.Flatten()
+	}
+	if r.destination != nil {
+		t.Destination = r.destination.Flatten()
+	}
+	if r.port != nil {
+		t.Service = r.port.Flatten()
+	}
+	return t
+}
+
+// Empty returns true if the block doesn't hold any traffic.
+func (t Traffic) Empty() bool {
+	return len(t.Source) == 0 || len(t.Destination) == 0 || len(t.Service) == 0
+}
+
+// Intersect returns the traffic that is in both blocks.
+func (t Traffic) Intersect(other Traffic) Traffic {
+	return Traffic{
+		Source:      t.Source.Intersect(other.Source),
+		Destination: t.Destination.Intersect(other.Destination),
+		Service:     t.Service.Intersect(other.Service),
+	}
+}
+
+// Subtract returns the traffic in the block that is not in other, as a list
+// of non-overlapping blocks.
+func (t Traffic) Subtract(other Traffic) TrafficSet {
+	overlap := t.Intersect(other)
+	if overlap.Empty() {
+		if t.Empty() {
+			return TrafficSet{}
+		}
+		return TrafficSet{t}
+	}
+
+	// Cut away one dimension at a time so that the pieces never overlap.
+	pieces := []Traffic{
+		{
+			Source:      t.Source.Difference(other.Source),
+			Destination: t.Destination,
+			Service:     t.Service,
+		},
+		{
+			Source:      overlap.Source,
+			Destination: t.Destination.Difference(other.Destination),
+			Service:     t.Service,
+		},
+		{
+			Source:      overlap.Source,
+			Destination: overlap.Destination,
+			Service:     t.Service.Difference(other.Service),
+		},
+	}
+	result := TrafficSet{}
+	for _, p := range pieces {
+		if !p.Empty() {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+func (t Traffic) String() string {
+	return fmt.Sprintf("%s from %s to %s", t.Service, t.Source, t.Destination)
+}
+
+// TrafficSet is a list of non-overlapping blocks of traffic.
+type TrafficSet []Traffic
+
+// Subtract returns the traffic in the set that is not in the block.
+func (s TrafficSet) Subtract(other Traffic) TrafficSet {
+	result := TrafficSet{}
+	for _, t := range s {
+		result = append(result, t.Subtract(other)...)
+	}
+	return result
+}
+
+// Difference returns the traffic in the set that is not in other.
+func (s TrafficSet) Difference(other TrafficSet) TrafficSet {
+	result := s
+	for _, o := range other {
+		result = result.Subtract(o)
+	}
+	return result
+}
+
+// Compact merges blocks that differ in a single dimension, so that the set
+// is described with as few blocks as possible.
+func (s TrafficSet) Compact() TrafficSet {
+	result := make(TrafficSet, len(s))
+	copy(result, s)
+	for merged := true; merged; {
+		merged = false
+		for i := 0; i < len(result) && !merged; i++ {
+			for j := i + 1; j < len(result) && !merged; j++ {
+				a, b := result[i], result[j]
+				sameSrc := a.Source.String() == b.Source.String()
+				sameDst := a.Destination.String() == b.Destination.String()
+				sameSvc := a.Service.String() == b.Service.String()
+				switch {
+				case sameDst && sameSvc:
+					result[i].Source = a.Source.Union(b.Source)
+				case sameSrc && sameSvc:
+					result[i].Destination = a.Destination.Union(b.Destination)
+				case sameSrc && sameDst:
+					result[i].Service = a.Service.Union(b.Service)
+				default:
+					continue
+				}
+				result = append(result[:j], result[j+1:]...)
+				merged = true
+			}
+		}
+	}
+	return result
+}
+
+func (s TrafficSet) String() string {
+	parts := make([]string, 0, len(s))
+	for _, t := range s {
+		parts = append(parts, t.String())
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Permitted returns the traffic space allowed by an ordered list of rules.
+// The first matching rule decides what happens to a packet, anything that
+// doesn't match a rule is denied.
+//
+// Traffic only models addresses and services, so scoped rules (see
+// Rule.Scoped) are taken the conservative way: a scoped permit is left out,
+// while a scoped deny blocks its whole block as if it applied everywhere.
+// The result is the traffic that is permitted whatever the zone,
+// application, user or time.
+func Permitted(rules []*Rule) TrafficSet {
+	permitted := TrafficSet{}
+	earlier := make([]Traffic, 0, len(rules))
+	for _, r := range rules {
+		if r.Scoped() && r.action {
+			continue
+		}
+		block := r.Traffic()
+		if block.Empty() {
+			continue
+		}
+		// Only the traffic that no earlier rule matched is decided by this rule.
+		effective := TrafficSet{block}
+		for _, e := range earlier {
+			effective = effective.Subtract(e)
+			if len(effective) == 0 {
+				break
+			}
+		}
+		if r.action {
+			permitted = append(permitted, effective...)
+		}
+		earlier = append(earlier, block)
+	}
+	return permitted
+}
+
+// Contains returns true if every combination of src, dst and svc is in the block.
+func (t Traffic) Contains(src, dst NetworkUnpacker, svc PortObject) bool {
+	return t.Source.Contains(src) && t.Destination.Contains(dst) && t.Service.Contains(svc)
+}
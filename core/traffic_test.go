@@ -0,0 +1,86 @@
+package core
+
+import (
+	"testing"
+)
+
+func testPortGroup(t *testing.T, name string, port uint) *PortGroup {
+	t.Helper()
+	p, err := NewPort(name, port, "tcp", "")
+	if err != nil {
+		t.Fatalf("failed to create test port: %v", err)
+	}
+	pg := NewPortGroup(name, "")
+	if err := pg.Add(p); err != nil {
+		t.Fatalf("failed to add port to group: %v", err)
+	}
+	return pg
+}
+
+func TestTrafficSubtract(t *testing.T) {
+	a := Traffic{
+		Source:      testGroup(t, "src", "10.0.0.0/255.255.255.0").Flatten(),
+		Destination: testGroup(t, "dst", "10.1.0.0/255.255.255.0").Flatten(),
+		Service:     testPortGroup(t, "http", 80).Flatten(),
+	}
+	b := Traffic{
+		Source:      testGroup(t, "src", "10.0.0.0/255.255.255.128").Flatten(),
+		Destination: testGroup(t, "dst", "10.1.0.0/255.255.0.0").Flatten(),
+		Service:     testPortGroup(t, "http", 80).Flatten(),
+	}
+
+	got := a.Subtract(b)
+	want := "tcp/80 from 10.0.0.128/25 to 10.1.0.0/24"
+	if got.String() != want {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+	if left := b.Subtract(b); len(left) != 0 {
+		t.Fatalf("expected nothing left after subtracting itself, got: %s", left)
+	}
+}
+
+func TestPermitted(t *testing.T) {
+	src := testGroup(t, "src", "10.0.0.0/255.255.255.0")
+	dst := testGroup(t, "dst", "10.1.0.0/255.255.255.0")
+	host := testGroup(t, "host", "10.1.0.10/255.255.255.255")
+
+	rules := []*Rule{
+		NewRule(1, src, host, testPortGroup(t, "http", 80), false, ""),
+		NewRule(2, src, dst, testPortGroup(t, "http", 80), true, ""),
+	}
+	got := Permitted(rules).Compact()
+	want := "tcp/80 from 10.0.0.0/24 to 10.1.0.0-10.1.0.9, 10.1.0.11-10.1.0.255"
+	if got.String() != want {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+}
+
+func TestPermittedScoped(t *testing.T) {
+	src := testGroup(t, "src", "10.0.0.0/255.255.255.0")
+	dst := testGroup(t, "dst", "10.1.0.0/255.255.255.0")
+
+	// The zone scoped permit is left out, while the scheduled deny blocks
+	// http as if it always applied, leaving only https permitted.
+	zoned := NewRule(1, src, dst, testPortGroup(t, "ssh", 22), true, "")
+	zoned.AddFromZone(NewZone("trust", ""))
+	scheduled := NewRule(2, src, dst, testPortGroup(t, "http", 80), false, "")
+	schedule, err := NewSchedule("office-hours", "", "")
+	if err != nil {
+		t.Fatalf("failed to create schedule: %v", err)
+	}
+	scheduled.SetSchedule(schedule)
+	rules := []*Rule{
+		zoned,
+		scheduled,
+		NewRule(3, src, dst, testPortGroup(t, "http", 80), true, ""),
+		NewRule(4, src, dst, testPortGroup(t, "https", 443), true, ""),
+	}
+	if !zoned.Scoped() || !scheduled.Scoped() || rules[2].Scoped() {
+		t.Fatalf("expected only the first two rules to be scoped")
+	}
+	got := Permitted(rules).Compact()
+	want := "tcp/443 from 10.0.0.0/24 to 10.1.0.0/24"
+	if got.String() != want {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// User represents a user identity, i.e. a directory account, that next-gen
+// firewalls match traffic on.
+type User struct {
+	uid     string
+	name    string
+	comment string
+}
+
+// NewUser returns a pointer to a new User object.
+func NewUser(name, comment string) *User {
+	uid := uuid.New()
+	return &User{
+		uid:     uid.String(),
+		name:    name,
+		comment: comment,
+	}
+}
+
+func (u *User) UID() string {
+	return u.uid
+}
+
+func (u *User) Name() string {
+	return u.name
+}
+
+func (u *User) Comment() string {
+	return u.comment
+}
+
+// UserGroup groups together users and other user groups, i.e. a directory
+// group.
+type UserGroup struct {
+	uid     string
+	name    string
+	users   []*User
+	groups  []*UserGroup
+	comment string
+}
+
+// NewUserGroup returns a new empty user group.
+func NewUserGroup(name, comment string) *UserGroup {
+	uid := uuid.New()
+	return &UserGroup{
+		uid:     uid.String(),
+		name:    name,
+		users:   make([]*User, 0),
+		groups:  make([]*UserGroup, 0),
+		comment: comment,
+	}
+}
+
+func (g *UserGroup) UID() string {
+	return g.uid
+}
+
+func (g *UserGroup) Name() string {
+	return g.name
+}
+
+func (g *UserGroup) Comment() string {
+	return g.comment
+}
+
+// Add will add the specified object to the group.
+// Supported types: User/User Group
+func (g *UserGroup) Add(obj interface{}) error {
+	switch v := obj.(type) {
+	case *User:
+		if g.hasMember(v.name) {
+			return fmt.Errorf("object is already a member of this group: %s", v.name)
+		}
+		g.users = append(g.users, v)
+	case *UserGroup:
+		if g.hasMember(v.name) {
+			return fmt.Errorf("object is already a member of this group: %s", v.name)
+		}
+		g.groups = append(g.groups, v)
+	default:
+		return errors.New("unsupported data type")
+	}
+	return nil
+}
+
+func (g *UserGroup) hasMember(name string) bool {
+	for _, u := range g.users {
+		if u.name == name {
+			return true
+		}
+	}
+	for _, grp := range g.groups {
+		if grp.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Users returns a copy of the group's user members.
+func (g *UserGroup) Users() []*User {
+	result := make([]*User, len(g.users))
+	copy(result, g.users)
+	return result
+}
+
+// Groups returns a copy of the group's nested user groups.
+func (g *UserGroup) Groups() []*UserGroup {
+	result := make([]*UserGroup, len(g.groups))
+	copy(result, g.groups)
+	return result
+}
+
+// Includes returns true if the group is called name, or name is a user or
+// group nested anywhere inside it.
+func (g *UserGroup) Includes(name string) bool {
+	return g.includes(name, make(map[*UserGroup]bool))
+}
+
+func (g *UserGroup) includes(name string, seen map[*UserGroup]bool) bool {
+	if seen[g] {
+		return false
+	}
+	seen[g] = true
+
+	if g.name == name {
+		return true
+	}
+	for _, u := range g.users {
+		if u.name == name {
+			return true
+		}
+	}
+	for _, grp := range g.groups {
+		if grp.includes(name, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match will return true if both groups have the same name and the same
+// direct members.
+func (g *UserGroup) Match(grp *UserGroup) bool {
+	if g.name != grp.name || len(g.users) != len(grp.users) || len(g.groups) != len(grp.groups) {
+		return false
+	}
+	for _, u := range g.users {
+		if !grp.hasMember(u.name) {
+			return false
+		}
+	}
+	for _, sub := range g.groups {
+		if !grp.hasMember(sub.name) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+
+	"github.com/Neffats/ip"
+	"github.com/google/uuid"
+)
+
+// Max number of intervals a wildcard object can expand to.
+const maxWildcardIntervals = 1 << 16
+
+var (
+	ErrWildcardTooSparse = errors.New("wildcard mask expands to too many intervals")
+)
+
+// Wildcard represents a Cisco style address and wildcard mask, i.e.
+// 10.0.0.0 0.0.255.0. Bits set in the wildcard are ignored when matching, and
+// unlike a subnet mask they don't have to be contiguous.
+type Wildcard struct {
+	uid      string
+	name     string
+	address  *ip.Address
+	wildcard *ip.Address
+	comment  string
+}
+
+// NewWildcard returns a pointer to a new Wildcard object. Address bits
+// covered by the wildcard are cleared. Returns an error if the wildcard
+// would expand to more than 65536 separate intervals.
+func NewWildcard(name, addr, wildcard, comment string) (*Wildcard, error) {
+	address, err := ip.NewAddress(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address: %v", err)
+	}
+	mask, err := ip.NewAddress(wildcard)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wildcard: %v", err)
+	}
+	if wildcardIntervals(*mask) > maxWildcardIntervals {
+		return nil, fmt.Errorf("failed to create wildcard %s %s: %w", addr, wildcard, ErrWildcardTooSparse)
+	}
+	base := ip.Address(uint32(*address) &^ uint32(*mask))
+	uid := uuid.New()
+	return &Wildcard{
+		uid:      uid.String(),
+		name:     name,
+		address:  &base,
+		wildcard: mask,
+		comment:  comment,
+	}, nil
+}
+
+// wildcardIntervals returns the number of intervals the wildcard expands to.
+// The trailing run of ones forms a single block, every other bit doubles the
+// number of blocks.
+func wildcardIntervals(wildcard ip.Address) uint64 {
+	w := uint32(wildcard)
+	trailing := bits.TrailingZeros32(^w)
+	return uint64(1) << uint(bits.OnesCount32(w)-trailing)
+}
+
+func (w *Wildcard) UID() string {
+	return w.uid
+}
+
+func (w *Wildcard) Name() string {
+	return w.name
+}
+
+func (w *Wildcard) Comment() string {
+	return w.comment
+}
+
+// String returns the wildcard in "address wildcard" notation.
+func (w *Wildcard) String() string {
+	return fmt.Sprintf("%s %s", addrString(*w.address), addrString(*w.wildcard))
+}
+
+// Unpack returns every interval matched by the wildcard, in order.
+func (w *Wildcard) Unpack() []NetworkObject {
+	mask := uint32(*w.wildcard)
+	trailing := bits.TrailingZeros32(^mask)
+	block := uint64(1) << uint(trailing)
+	// The bits above the trailing block that are free to vary.
+	sparse := mask &^ uint32(block-1)
+
+	result := make([]NetworkObject, 0, wildcardIntervals(*w.wildcard))
+	base := uint32(*w.address)
+	// Walk every subset of the sparse bits in increasing order.
+	sub := uint32(0)
+	for {
+		start := uint64(base | sub)
+		result = append(result, NetworkObject{
+			Start: ip.Address(start),
+			End:   ip.Address(start + block - 1),
+		})
+		if sub == sparse {
+			break
+		}
+		sub = (sub - sparse) & sparse
+	}
+	return result
+}
+
+// Match will return true if both objects match the same addresses.
+func (w *Wildcard) Match(obj *Wildcard) bool {
+	return *w.address == *obj.address && *w.wildcard == *obj.wildcard
+}
+
+// Address returns the wildcard's address in dotted form.
+func (w *Wildcard) Address() string {
+	return addrString(*w.address)
+}
+
+// Mask returns the wildcard mask in dotted form.
+func (w *Wildcard) Mask() string {
+	return addrString(*w.wildcard)
+}
@@ -0,0 +1,42 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWildcardUnpack(t *testing.T) {
+	tests := []struct {
+		name     string
+		addr     string
+		wildcard string
+		want     string
+		err      error
+	}{
+		{name: "Contiguous", addr: "10.0.0.0", wildcard: "0.0.0.255", want: "10.0.0.0/24"},
+		{name: "Host", addr: "10.0.0.1", wildcard: "0.0.0.0", want: "10.0.0.1"},
+		{name: "Clears ignored bits", addr: "10.0.0.77", wildcard: "0.0.0.255", want: "10.0.0.0/24"},
+		{name: "Non contiguous", addr: "10.0.1.0", wildcard: "0.0.6.255", want: "10.0.1.0/24, 10.0.3.0/24, 10.0.5.0/24, 10.0.7.0/24"},
+		{name: "Non contiguous with block", addr: "10.0.0.0", wildcard: "0.0.0.19", want: "10.0.0.0/30, 10.0.0.16/30"},
+		{name: "Too sparse", addr: "0.0.0.0", wildcard: "255.255.170.170", err: ErrWildcardTooSparse},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w, err := NewWildcard(tc.name, tc.addr, tc.wildcard, "")
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("expected error %v, got: %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error when not expected: %v", err)
+			}
+			got := NewAddressSet(w).String()
+			if got != tc.want {
+				t.Fatalf("want: %s, got: %s", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"github.com/google/uuid"
+)
+
+// Interface represents a network interface of a node i.e. ethernet1/1 or port3.
+type Interface struct {
+	uid     string
+	name    string
+	comment string
+}
+
+// NewInterface returns a pointer to a new Interface object.
+func NewInterface(name, comment string) *Interface {
+	uid := uuid.New()
+	return &Interface{
+		uid:     uid.String(),
+		name:    name,
+		comment: comment,
+	}
+}
+
+func (i *Interface) UID() string {
+	return i.uid
+}
+
+func (i *Interface) Name() string {
+	return i.name
+}
+
+func (i *Interface) Comment() string {
+	return i.comment
+}
+
+// Zone represents a security zone, a named set of interfaces that zone based
+// firewalls scope their rules to.
+type Zone struct {
+	uid        string
+	name       string
+	interfaces []*Interface
+	comment    string
+}
+
+// NewZone returns a new zone without any interfaces.
+func NewZone(name, comment string) *Zone {
+	uid := uuid.New()
+	return &Zone{
+		uid:        uid.String(),
+		name:       name,
+		interfaces: make([]*Interface, 0),
+		comment:    comment,
+	}
+}
+
+func (z *Zone) UID() string {
+	return z.uid
+}
+
+func (z *Zone) Name() string {
+	return z.name
+}
+
+func (z *Zone) Comment() string {
+	return z.comment
+}
+
+// Add binds an interface to the zone.
+func (z *Zone) Add(i *Interface) {
+	if z.HasInterface(i) {
+		return
+	}
+	z.interfaces = append(z.interfaces, i)
+}
+
+// Interfaces returns a copy of the zone's interfaces.
+func (z *Zone) Interfaces() []*Interface {
+	result := make([]*Interface, len(z.interfaces))
+	copy(result, z.interfaces)
+	return result
+}
+
+// HasInterface returns true if the interface is bound to the zone.
+func (z *Zone) HasInterface(i *Interface) bool {
+	for _, existing := range z.interfaces {
+		if existing == i || existing.name == i.name {
+			return true
+		}
+	}
+	return false
+}
+
+// zonesInclude returns true if zones is empty (any zone) or holds a zone
+// called name.
+func zonesInclude(zones []*Zone, name string) bool {
+	if len(zones) == 0 {
+		return true
+	}
+	for _, z := range zones {
+		if z.name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestZone(t *testing.T) {
+	eth1 := NewInterface("ethernet1/1", "")
+	zone := NewZone("untrust", "")
+	zone.Add(eth1)
+	zone.Add(NewInterface("ethernet1/1", "duplicate name"))
+
+	if got := zone.Interfaces(); len(got) != 1 || got[0] != eth1 {
+		t.Fatalf("expected a single interface, got: %v", got)
+	}
+	if zone.HasInterface(NewInterface("ethernet1/2", "")) {
+		t.Fatalf("expected ethernet1/2 not to be in zone")
+	}
+
+	rule := NewRule(1, NewGroup("src", ""), NewGroup("dst", ""), NewPortGroup("svc", ""), true, "")
+	if !rule.MatchFromZone("untrust") || !rule.MatchToZone("trust") {
+		t.Fatalf("expected rule without zones to match any zone")
+	}
+	rule.AddFromZone(zone)
+	if !rule.MatchFromZone("untrust") || rule.MatchFromZone("trust") {
+		t.Fatalf("expected rule to only match from untrust")
+	}
+	if len(rule.FromZones()) != 1 || len(rule.ToZones()) != 0 {
+		t.Fatalf("unexpected zones: %v, %v", rule.FromZones(), rule.ToZones())
+	}
+}
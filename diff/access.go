@@ -0,0 +1,143 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Neffats/wherecp/core"
+)
+
+// Flow is a printable block of traffic space.
+type Flow struct {
+	Source      []string `json:"source"`
+	Destination []string `json:"destination"`
+	Service     []string `json:"service"`
+}
+
+func (f Flow) String() string {
+	return fmt.Sprintf("%s from %s to %s", list(f.Service), list(f.Source), list(f.Destination))
+}
+
+// ScopedRule is a rule limited to zones, applications, users or a schedule,
+// which an access report can't fully model, see core.Permitted. Scoped
+// permits are left out and scoped denies are taken to deny everywhere.
+type ScopedRule struct {
+	// Policy is old or new.
+	Policy string `json:"policy"`
+	Number int    `json:"number"`
+	Name   string `json:"name,omitempty"`
+	Permit bool   `json:"permit"`
+}
+
+func (s ScopedRule) String() string {
+	if s.Name != "" {
+		return fmt.Sprintf("%s rule %d (%s)", s.Policy, s.Number, s.Name)
+	}
+	return fmt.Sprintf("%s rule %d", s.Policy, s.Number)
+}
+
+// AccessReport describes the semantic impact of a policy change: the
+// traffic that the new policy lets through that the old one didn't, and
+// the traffic that the old policy let through that the new one doesn't.
+// Only addresses and services are compared. The scoped rules of either policy
+// are listed in Scoped: their permits are left out, so they aren't reported
+// as opened traffic, and their denies block as if they applied everywhere,
+// so traffic they only deny some of the time isn't reported as opened
+// either.
+type AccessReport struct {
+	Opened []Flow       `json:"opened"`
+	Closed []Flow       `json:"closed"`
+	Scoped []ScopedRule `json:"scoped,omitempty"`
+
+	opened core.TrafficSet
+	closed core.TrafficSet
+}
+
+// Access compares the traffic permitted by two versions of a node's rules.
+func Access(old, new []*core.Rule) *AccessReport {
+	before := core.Permitted(ordered(old))
+	after := core.Permitted(ordered(new))
+
+	report := &AccessReport{
+		opened: after.Difference(before).Compact(),
+		closed: before.Difference(after).Compact(),
+	}
+	report.Opened = flows(report.opened)
+	report.Closed = flows(report.closed)
+	report.Scoped = append(scoped("old", ordered(old)), scoped("new", ordered(new))...)
+	return report
+}
+
+func scoped(policy string, rules []*core.Rule) []ScopedRule {
+	result := make([]ScopedRule, 0)
+	for _, r := range rules {
+		if r.Scoped() {
+			result = append(result, ScopedRule{Policy: policy, Number: r.Number(), Name: r.Name(), Permit: r.Action()})
+		}
+	}
+	return result
+}
+
+// OpenedTraffic returns the newly permitted traffic as normalized blocks.
+func (r *AccessReport) OpenedTraffic() core.TrafficSet {
+	return r.opened
+}
+
+// ClosedTraffic returns the newly denied traffic as normalized blocks.
+func (r *AccessReport) ClosedTraffic() core.TrafficSet {
+	return r.closed
+}
+
+// Empty returns true if both policies permit exactly the same traffic, as
+// far as addresses and services go.
+func (r *AccessReport) Empty() bool {
+	return len(r.Opened) == 0 && len(r.Closed) == 0
+}
+
+// JSON returns the report encoded as indented JSON.
+func (r *AccessReport) JSON() ([]byte, error) {
+	out, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode access report: %v", err)
+	}
+	return out, nil
+}
+
+// String returns a line per block of traffic i.e.
+//
+//	opens tcp/22 from 0.0.0.0/0 to 10.2.0.0/16
+//
+// followed by a line per scoped rule saying how it was taken.
+func (r *AccessReport) String() string {
+	var b strings.Builder
+	if r.Empty() {
+		b.WriteString("no change in permitted traffic\n")
+	}
+	for _, f := range r.Opened {
+		fmt.Fprintf(&b, "opens %s\n", f)
+	}
+	for _, f := range r.Closed {
+		fmt.Fprintf(&b, "closes %s\n", f)
+	}
+	for _, s := range r.Scoped {
+		if s.Permit {
+			fmt.Fprintf(&b, "ignores scoped permit %s\n", s)
+			continue
+		}
+		fmt.Fprintf(&b, "takes scoped deny %s to deny everywhere\n", s)
+	}
+	return b.String()
+}
+
+func flows(set core.TrafficSet) []Flow {
+	result := make([]Flow, 0, len(set))
+	for _, t := range set {
+		result = append(result, Flow{
+			Source:      addressStrings(t.Source),
+			Destination: addressStrings(t.Destination),
+			Service:     portStrings(t.Service),
+		})
+	}
+	return result
+}
@@ -0,0 +1,149 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/Neffats/wherecp/core"
+)
+
+func (s snapshot) network(name, addr, mask string) *core.Group {
+	s.t.Helper()
+	n, err := core.NewNetwork(name, addr, mask, "")
+	if err != nil {
+		s.t.Fatalf("failed to create network: %v", err)
+	}
+	grp := core.NewGroup(name, "")
+	if err := grp.Add(n); err != nil {
+		s.t.Fatalf("failed to add network to group: %v", err)
+	}
+	return grp
+}
+
+func TestAccessOpened(t *testing.T) {
+	s := snapshot{t}
+	any := s.network("any", "0.0.0.0", "0.0.0.0")
+	servers := s.network("servers", "10.2.0.0", "255.255.0.0")
+
+	old := []*core.Rule{
+		core.NewRule(1, any, servers, s.service("https", 443), true, ""),
+		core.NewRule(2, any, any, s.service("ssh", 22), false, ""),
+	}
+	new := []*core.Rule{
+		core.NewRule(1, any, servers, s.service("https", 443), true, ""),
+		core.NewRule(2, any, servers, s.service("ssh", 22), true, ""),
+		core.NewRule(3, any, any, s.service("ssh", 22), false, ""),
+	}
+
+	report := Access(old, new)
+	if len(report.Closed) != 0 {
+		t.Fatalf("expected nothing to be closed, got: %s", report)
+	}
+	want := "opens tcp/22 from 0.0.0.0/0 to 10.2.0.0/16\n"
+	if report.String() != want {
+		t.Fatalf("want: %q, got: %q", want, report.String())
+	}
+}
+
+func TestAccessShadowedChange(t *testing.T) {
+	s := snapshot{t}
+	any := s.network("any", "0.0.0.0", "0.0.0.0")
+	servers := s.network("servers", "10.2.0.0", "255.255.0.0")
+	web := s.network("web", "10.2.1.0", "255.255.255.0")
+
+	// The new rule is shadowed by the deny above it, so nothing changes.
+	old := []*core.Rule{
+		core.NewRule(1, any, servers, s.service("ssh", 22), false, ""),
+	}
+	new := []*core.Rule{
+		core.NewRule(1, any, servers, s.service("ssh", 22), false, ""),
+		core.NewRule(2, any, web, s.service("ssh", 22), true, ""),
+	}
+	if report := Access(old, new); !report.Empty() {
+		t.Fatalf("expected no change, got: %s", report)
+	}
+
+	// Removing the deny opens up the web subnet only.
+	new = []*core.Rule{
+		core.NewRule(1, any, web, s.service("ssh", 22), true, ""),
+	}
+	report := Access(old, new)
+	want := "opens tcp/22 from 0.0.0.0/0 to 10.2.1.0/24\n"
+	if report.String() != want {
+		t.Fatalf("want: %q, got: %q", want, report.String())
+	}
+}
+
+func TestAccessClosed(t *testing.T) {
+	s := snapshot{t}
+	clients := s.network("clients", "192.168.0.0", "255.255.255.0")
+	servers := s.network("servers", "10.2.0.0", "255.255.0.0")
+	admins := s.network("admins", "192.168.0.0", "255.255.255.128")
+
+	old := []*core.Rule{
+		core.NewRule(1, clients, servers, s.service("ssh", 22), true, ""),
+	}
+	new := []*core.Rule{
+		core.NewRule(1, admins, servers, s.service("ssh", 22), true, ""),
+	}
+
+	report := Access(old, new)
+	want := "closes tcp/22 from 192.168.0.128/25 to 10.2.0.0/16\n"
+	if report.String() != want {
+		t.Fatalf("want: %q, got: %q", want, report.String())
+	}
+}
+
+func TestAccessScoped(t *testing.T) {
+	s := snapshot{t}
+	any := s.network("any", "0.0.0.0", "0.0.0.0")
+	servers := s.network("servers", "10.2.0.0", "255.255.0.0")
+
+	// The new permit only applies from the trust zone, so it doesn't open
+	// ssh to the servers everywhere.
+	zoned := core.NewNamedRule("trust-ssh", 1, any, servers, s.service("ssh", 22), true, "")
+	zoned.AddFromZone(core.NewZone("trust", ""))
+	old := []*core.Rule{
+		core.NewRule(1, any, any, s.service("ssh", 22), false, ""),
+	}
+	new := []*core.Rule{
+		zoned,
+		core.NewRule(2, any, any, s.service("ssh", 22), false, ""),
+	}
+
+	report := Access(old, new)
+	if !report.Empty() {
+		t.Fatalf("expected no change, got: %s", report)
+	}
+	want := "no change in permitted traffic\nignores scoped permit new rule 1 (trust-ssh)\n"
+	if report.String() != want {
+		t.Fatalf("want: %q, got: %q", want, report.String())
+	}
+
+	// A deny scoped to a schedule still blocks ssh some of the time, so
+	// moving the permit after it mustn't be reported as opening ssh.
+	schedule, err := core.NewSchedule("office-hours", "", "")
+	if err != nil {
+		t.Fatalf("failed to create schedule: %v", err)
+	}
+	scheduled := core.NewNamedRule("office-ssh", 1, any, servers, s.service("ssh", 22), false, "")
+	scheduled.SetSchedule(schedule)
+	old = []*core.Rule{
+		scheduled,
+		core.NewRule(2, any, any, s.service("ssh", 22), false, ""),
+	}
+	new = []*core.Rule{
+		scheduled,
+		core.NewRule(2, any, servers, s.service("ssh", 22), true, ""),
+	}
+
+	report = Access(old, new)
+	if !report.Empty() {
+		t.Fatalf("expected no change, got: %s", report)
+	}
+	want = "no change in permitted traffic\n" +
+		"takes scoped deny old rule 1 (office-ssh) to deny everywhere\n" +
+		"takes scoped deny new rule 1 (office-ssh) to deny everywhere\n"
+	if report.String() != want {
+		t.Fatalf("want: %q, got: %q", want, report.String())
+	}
+}
@@ -0,0 +1,448 @@
+// Package diff compares two snapshots of a firewall policy and reports what
+// changed between them.
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Neffats/wherecp/core"
+)
+
+// Kind describes how a rule or object changed between two snapshots.
+type Kind string
+
+const (
+	Added    Kind = "added"
+	Removed  Kind = "removed"
+	Moved    Kind = "moved"
+	Modified Kind = "modified"
+)
+
+// Rule is a printable summary of a rule in one of the snapshots.
+type Rule struct {
+	Name         string   `json:"name,omitempty"`
+	Number       int      `json:"number"`
+	Source       []string `json:"source"`
+	Destination  []string `json:"destination"`
+	Service      []string `json:"service"`
+	Action       string   `json:"action"`
+	Comment      string   `json:"comment,omitempty"`
+	FromZones    []string `json:"from_zones,omitempty"`
+	ToZones      []string `json:"to_zones,omitempty"`
+	Applications []string `json:"applications,omitempty"`
+	Users        []string `json:"users,omitempty"`
+	Schedule     string   `json:"schedule,omitempty"`
+}
+
+// FieldChange describes how a single component of a rule changed.
+type FieldChange struct {
+	Field   string   `json:"field"`
+	Removed []string `json:"removed,omitempty"`
+	Added   []string `json:"added,omitempty"`
+}
+
+// RuleChange is a single rule that was added, removed, moved or modified.
+type RuleChange struct {
+	Kind    Kind          `json:"kind"`
+	Old     *Rule         `json:"old,omitempty"`
+	New     *Rule         `json:"new,omitempty"`
+	Changes []FieldChange `json:"changes,omitempty"`
+}
+
+// Report holds every change found between two snapshots.
+type Report struct {
+	Rules   []RuleChange   `json:"rules"`
+	Objects []ObjectChange `json:"objects"`
+}
+
+// Empty returns true if the two snapshots were the same.
+func (r *Report) Empty() bool {
+	return len(r.Rules) == 0 && len(r.Objects) == 0
+}
+
+// pair links a rule in the old snapshot to the same rule in the new one.
+type pair struct {
+	old    *core.Rule
+	new    *core.Rule
+	oldPos int
+	newPos int
+}
+
+// Rules compares two rule sets, for example two pulls of the same node.
+// Rules are matched by their vendor name when they have one, otherwise by
+// their content and finally by their rule number, so the random UIDs given
+// to each pull never affect the result.
+func Rules(old, new []*core.Rule) *Report {
+	old = ordered(old)
+	new = ordered(new)
+
+	pairs, removed, added := match(old, new)
+
+	report := &Report{
+		Rules:   make([]RuleChange, 0),
+		Objects: diffObjects(old, new),
+	}
+	for _, i := range removed {
+		report.Rules = append(report.Rules, RuleChange{Kind: Removed, Old: summarise(old[i])})
+	}
+	for _, i := range added {
+		report.Rules = append(report.Rules, RuleChange{Kind: Added, New: summarise(new[i])})
+	}
+	for _, p := range moved(pairs) {
+		report.Rules = append(report.Rules, RuleChange{
+			Kind: Moved,
+			Old:  summarise(p.old),
+			New:  summarise(p.new),
+		})
+	}
+	for _, p := range pairs {
+		changes := compare(p.old, p.new)
+		if len(changes) == 0 {
+			continue
+		}
+		report.Rules = append(report.Rules, RuleChange{
+			Kind:    Modified,
+			Old:     summarise(p.old),
+			New:     summarise(p.new),
+			Changes: changes,
+		})
+	}
+	return report
+}
+
+// ordered returns a copy of the rules sorted by rule number.
+func ordered(rules []*core.Rule) []*core.Rule {
+	result := make([]*core.Rule, len(rules))
+	copy(result, rules)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Number() < result[j].Number()
+	})
+	return result
+}
+
+func match(old, new []*core.Rule) (pairs []pair, removed, added []int) {
+	oldUsed := make([]bool, len(old))
+	newUsed := make([]bool, len(new))
+	link := func(i, j int) {
+		oldUsed[i] = true
+		newUsed[j] = true
+		pairs = append(pairs, pair{old: old[i], new: new[j], oldPos: i, newPos: j})
+	}
+
+	// Rules with a vendor identifier only ever match by that identifier.
+	byName := make(map[string]int)
+	for j, r := range new {
+		if r.Name() != "" {
+			byName[r.Name()] = j
+		}
+	}
+	for i, r := range old {
+		if r.Name() == "" {
+			continue
+		}
+		if j, ok := byName[r.Name()]; ok && !newUsed[j] {
+			link(i, j)
+		}
+	}
+
+	// Anonymous rules match on identical content, in order of appearance.
+	byContent := make(map[string][]int)
+	for j, r := range new {
+		if r.Name() == "" {
+			sig := signature(r)
+			byContent[sig] = append(byContent[sig], j)
+		}
+	}
+	for i, r := range old {
+		if r.Name() != "" {
+			continue
+		}
+		sig := signature(r)
+		if candidates := byContent[sig]; len(candidates) > 0 {
+			link(i, candidates[0])
+			byContent[sig] = candidates[1:]
+		}
+	}
+
+	// Whatever anonymous rules are left match on rule number, these are the
+	// rules whose content was modified in place.
+	byNumber := make(map[int]int)
+	for j, r := range new {
+		if !newUsed[j] && r.Name() == "" {
+			byNumber[r.Number()] = j
+		}
+	}
+	for i, r := range old {
+		if oldUsed[i] || r.Name() != "" {
+			continue
+		}
+		if j, ok := byNumber[r.Number()]; ok && !newUsed[j] {
+			link(i, j)
+		}
+	}
+
+	for i := range old {
+		if !oldUsed[i] {
+			removed = append(removed, i)
+		}
+	}
+	for j := range new {
+		if !newUsed[j] {
+			added = append(added, j)
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].oldPos < pairs[j].oldPos
+	})
+	return pairs, removed, added
+}
+
+// moved returns the pairs whose position relative to the other matched rules
+// changed. The longest run of pairs that kept their relative order is treated
+// as stationary, everything else was moved.
+func moved(pairs []pair) []pair {
+	if len(pairs) == 0 {
+		return nil
+	}
+	// Longest increasing subsequence of new positions, pairs are already
+	// ordered by their old position.
+	tails := make([]int, 0)
+	prev := make([]int, len(pairs))
+	for i, p := range pairs {
+		k := sort.Search(len(tails), func(k int) bool {
+			return pairs[tails[k]].newPos >= p.newPos
+		})
+		if k > 0 {
+			prev[i] = tails[k-1]
+		} else {
+			prev[i] = -1
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+	stationary := make(map[int]bool)
+	for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+		stationary[i] = true
+	}
+
+	result := make([]pair, 0)
+	for i, p := range pairs {
+		if !stationary[i] {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+func signature(r *core.Rule) string {
+	return fmt.Sprintf("%t|%s|%s|%s|%s|%s|%s|%s|%s", r.Action(), addresses(r.Source()), addresses(r.Destination()), services(r.Port()),
+		strings.Join(zoneNames(r.FromZones()), ","), strings.Join(zoneNames(r.ToZones()), ","),
+		strings.Join(appNames(r), ","), strings.Join(userNames(r), ","), scheduleName(r))
+}
+
+func compare(old, new *core.Rule) []FieldChange {
+	changes := make([]FieldChange, 0)
+
+	src := core.DiffAddresses(addresses(old.Source()), addresses(new.Source()))
+	if !src.Equal() {
+		changes = append(changes, FieldChange{
+			Field:   "source",
+			Removed: addressStrings(src.Removed),
+			Added:   addressStrings(src.Added),
+		})
+	}
+	dst := core.DiffAddresses(addresses(old.Destination()), addresses(new.Destination()))
+	if !dst.Equal() {
+		changes = append(changes, FieldChange{
+			Field:   "destination",
+			Removed: addressStrings(dst.Removed),
+			Added:   addressStrings(dst.Added),
+		})
+	}
+	svc := core.DiffPorts(services(old.Port()), services(new.Port()))
+	if !svc.Equal() {
+		changes = append(changes, FieldChange{
+			Field:   "service",
+			Removed: portStrings(svc.Removed),
+			Added:   portStrings(svc.Added),
+		})
+	}
+	if old.Action() != new.Action() {
+		changes = append(changes, FieldChange{
+			Field:   "action",
+			Removed: []string{action(old)},
+			Added:   []string{action(new)},
+		})
+	}
+	if removed, added := diffStrings(zoneNames(old.FromZones()), zoneNames(new.FromZones())); len(removed)+len(added) > 0 {
+		changes = append(changes, FieldChange{Field: "from zone", Removed: removed, Added: added})
+	}
+	if removed, added := diffStrings(zoneNames(old.ToZones()), zoneNames(new.ToZones())); len(removed)+len(added) > 0 {
+		changes = append(changes, FieldChange{Field: "to zone", Removed: removed, Added: added})
+	}
+	if removed, added := diffStrings(appNames(old), appNames(new)); len(removed)+len(added) > 0 {
+		changes = append(changes, FieldChange{Field: "application", Removed: removed, Added: added})
+	}
+	if removed, added := diffStrings(userNames(old), userNames(new)); len(removed)+len(added) > 0 {
+		changes = append(changes, FieldChange{Field: "user", Removed: removed, Added: added})
+	}
+	if scheduleName(old) != scheduleName(new) {
+		changes = append(changes, FieldChange{
+			Field:   "schedule",
+			Removed: nonEmpty(scheduleName(old)),
+			Added:   nonEmpty(scheduleName(new)),
+		})
+	}
+	if old.Comment() != new.Comment() {
+		changes = append(changes, FieldChange{
+			Field:   "comment",
+			Removed: nonEmpty(old.Comment()),
+			Added:   nonEmpty(new.Comment()),
+		})
+	}
+	return changes
+}
+
+func summarise(r *core.Rule) *Rule {
+	return &Rule{
+		Name:         r.Name(),
+		Number:       r.Number(),
+		Source:       addressStrings(addresses(r.Source())),
+		Destination:  addressStrings(addresses(r.Destination())),
+		Service:      portStrings(services(r.Port())),
+		Action:       action(r),
+		Comment:      r.Comment(),
+		FromZones:    zoneNames(r.FromZones()),
+		ToZones:      zoneNames(r.ToZones()),
+		Applications: appNames(r),
+		Users:        userNames(r),
+		Schedule:     scheduleName(r),
+	}
+}
+
+// zoneNames returns the sorted names of zones.
+func zoneNames(zones []*core.Zone) []string {
+	result := make([]string, 0, len(zones))
+	for _, z := range zones {
+		result = append(result, z.Name())
+	}
+	sort.Strings(result)
+	return result
+}
+
+// appNames returns the sorted names of the rule's applications.
+func appNames(r *core.Rule) []string {
+	result := make([]string, 0)
+	for _, a := range r.Applications() {
+		result = append(result, a.Name())
+	}
+	sort.Strings(result)
+	return result
+}
+
+// userNames returns the sorted names of the rule's users and user groups.
+func userNames(r *core.Rule) []string {
+	result := make([]string, 0)
+	for _, u := range r.Users() {
+		result = append(result, u.Name())
+	}
+	for _, g := range r.UserGroups() {
+		result = append(result, g.Name())
+	}
+	sort.Strings(result)
+	return result
+}
+
+// scheduleName returns the name of the rule's schedule, empty if it has none.
+func scheduleName(r *core.Rule) string {
+	if r.Schedule() == nil {
+		return ""
+	}
+	return r.Schedule().Name()
+}
+
+// diffStrings returns the values only in old and only in new.
+func diffStrings(old, new []string) (removed, added []string) {
+	inOld := make(map[string]bool)
+	for _, o := range old {
+		inOld[o] = true
+	}
+	inNew := make(map[string]bool)
+	for _, n := range new {
+		inNew[n] = true
+		if !inOld[n] {
+			added = append(added, n)
+		}
+	}
+	for _, o := range old {
+		if !inNew[o] {
+			removed = append(removed, o)
+		}
+	}
+	return removed, added
+}
+
+func addresses(g *core.Group) core.AddressSet {
+	if g == nil {
+		return core.AddressSet{}
+	}
+	return g.Flatten()
+}
+
+func services(pg *core.PortGroup) core.PortSet {
+	if pg == nil {
+		return core.PortSet{}
+	}
+	return pg.Flatten()
+}
+
+func addressStrings(s core.AddressSet) []string {
+	result := make([]string, 0, len(s))
+	for _, o := range s {
+		result = append(result, o.String())
+	}
+	return result
+}
+
+func portStrings(s core.PortSet) []string {
+	result := make([]string, 0, len(s))
+	for _, p := range s {
+		result = append(result, p.String())
+	}
+	return result
+}
+
+func nonEmpty(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return []string{s}
+}
+
+func action(r *core.Rule) string {
+	if r.Action() {
+		return "permit"
+	}
+	return "deny"
+}
+
+func (r *Rule) String() string {
+	id := fmt.Sprintf("rule %d", r.Number)
+	if r.Name != "" {
+		id = fmt.Sprintf("%s %q", id, r.Name)
+	}
+	return fmt.Sprintf("%s: %s -> %s [%s] %s", id,
+		list(r.Source), list(r.Destination), list(r.Service), r.Action)
+}
+
+func list(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, ", ")
+}
@@ -0,0 +1,185 @@
+package diff
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Neffats/wherecp/core"
+)
+
+// snapshot builds the objects needed for a rule set. Each call returns
+// brand new objects, just like a fresh pull from a firewall would.
+type snapshot struct {
+	t *testing.T
+}
+
+func (s snapshot) group(name string, addrs ...string) *core.Group {
+	s.t.Helper()
+	grp := core.NewGroup(name, "")
+	for _, a := range addrs {
+		host, err := core.NewHost(a, a, "")
+		if err != nil {
+			s.t.Fatalf("failed to create host %s: %v", a, err)
+		}
+		if err := grp.Add(host); err != nil {
+			s.t.Fatalf("failed to add %s to %s: %v", a, name, err)
+		}
+	}
+	return grp
+}
+
+func (s snapshot) service(name string, port uint) *core.PortGroup {
+	s.t.Helper()
+	p, err := core.NewPort(name, port, "tcp", "")
+	if err != nil {
+		s.t.Fatalf("failed to create port: %v", err)
+	}
+	pg := core.NewPortGroup(name, "")
+	if err := pg.Add(p); err != nil {
+		s.t.Fatalf("failed to add port to group: %v", err)
+	}
+	return pg
+}
+
+func kinds(r *Report) map[Kind][]string {
+	result := make(map[Kind][]string)
+	for _, c := range r.Rules {
+		rule := c.New
+		if rule == nil {
+			rule = c.Old
+		}
+		result[c.Kind] = append(result[c.Kind], rule.Name)
+	}
+	return result
+}
+
+func TestRulesByName(t *testing.T) {
+	s := snapshot{t}
+	old := []*core.Rule{
+		core.NewNamedRule("allow-web", 1, s.group("clients", "10.0.0.1"), s.group("web", "10.1.0.1"), s.service("http", 80), true, ""),
+		core.NewNamedRule("allow-ssh", 2, s.group("admins", "10.0.0.9"), s.group("web", "10.1.0.1"), s.service("ssh", 22), true, ""),
+		core.NewNamedRule("legacy", 3, s.group("clients", "10.0.0.1"), s.group("old", "10.9.0.1"), s.service("telnet", 23), true, ""),
+		core.NewNamedRule("deny-all", 4, s.group("any", "0.0.0.0"), s.group("any", "0.0.0.0"), s.service("http", 80), false, ""),
+	}
+	s2 := snapshot{t}
+	new := []*core.Rule{
+		core.NewNamedRule("allow-ssh", 1, s2.group("admins", "10.0.0.9"), s2.group("web", "10.1.0.1"), s2.service("ssh", 22), true, ""),
+		core.NewNamedRule("allow-web", 2, s2.group("clients", "10.0.0.1", "10.0.0.2"), s2.group("web", "10.1.0.1"), s2.service("http", 80), true, ""),
+		core.NewNamedRule("allow-dns", 3, s2.group("clients", "10.0.0.1", "10.0.0.2"), s2.group("dns", "10.1.0.53"), s2.service("dns", 53), true, ""),
+		core.NewNamedRule("deny-all", 4, s2.group("any", "0.0.0.0"), s2.group("any", "0.0.0.0"), s2.service("http", 80), false, ""),
+	}
+
+	report := Rules(old, new)
+	got := kinds(report)
+
+	tests := []struct {
+		kind Kind
+		want []string
+	}{
+		{kind: Added, want: []string{"allow-dns"}},
+		{kind: Removed, want: []string{"legacy"}},
+		{kind: Moved, want: []string{"allow-web"}},
+		{kind: Modified, want: []string{"allow-web"}},
+	}
+	for _, tc := range tests {
+		t.Run(string(tc.kind), func(t *testing.T) {
+			if strings.Join(got[tc.kind], ",") != strings.Join(tc.want, ",") {
+				t.Fatalf("want: %v, got: %v", tc.want, got[tc.kind])
+			}
+		})
+	}
+
+	// The modified rule should explain exactly which source address was added.
+	for _, c := range report.Rules {
+		if c.Kind != Modified {
+			continue
+		}
+		if len(c.Changes) != 1 || c.Changes[0].Field != "source" {
+			t.Fatalf("expected a single source change, got: %+v", c.Changes)
+		}
+		if strings.Join(c.Changes[0].Added, ",") != "10.0.0.2" {
+			t.Fatalf("expected 10.0.0.2 to be added, got: %v", c.Changes[0].Added)
+		}
+	}
+
+	// The clients group gained a member, the old group disappeared with the legacy rule.
+	objects := make(map[string]ObjectChange)
+	for _, o := range report.Objects {
+		objects[o.Type+"/"+o.Name] = o
+	}
+	if o, ok := objects["group/clients"]; !ok || o.Kind != Modified || strings.Join(o.AddedMembers, ",") != "host/10.0.0.2" {
+		t.Fatalf("expected clients group to gain host/10.0.0.2, got: %+v", o)
+	}
+	if o, ok := objects["group/old"]; !ok || o.Kind != Removed {
+		t.Fatalf("expected old group to be removed, got: %+v", o)
+	}
+}
+
+func TestRulesByContent(t *testing.T) {
+	s := snapshot{t}
+	old := []*core.Rule{
+		core.NewRule(1, s.group("a", "10.0.0.1"), s.group("b", "10.0.0.2"), s.service("http", 80), true, ""),
+		core.NewRule(2, s.group("a", "10.0.0.1"), s.group("c", "10.0.0.3"), s.service("http", 80), true, ""),
+	}
+	s2 := snapshot{t}
+	new := []*core.Rule{
+		core.NewRule(1, s2.group("a", "10.0.0.1"), s2.group("b", "10.0.0.2"), s2.service("http", 80), true, ""),
+		core.NewRule(2, s2.group("a", "10.0.0.1"), s2.group("c", "10.0.0.3"), s2.service("https", 443), true, ""),
+	}
+
+	report := Rules(old, new)
+	if len(report.Rules) != 1 || report.Rules[0].Kind != Modified {
+		t.Fatalf("expected a single modified rule, got: %s", report)
+	}
+	change := report.Rules[0].Changes[0]
+	if change.Field != "service" || strings.Join(change.Removed, ",") != "tcp/80" || strings.Join(change.Added, ",") != "tcp/443" {
+		t.Fatalf("unexpected service change: %+v", change)
+	}
+}
+
+func TestRulesUnchanged(t *testing.T) {
+	s := snapshot{t}
+	s2 := snapshot{t}
+	old := []*core.Rule{core.NewRule(1, s.group("a", "10.0.0.1"), s.group("b", "10.0.0.2"), s.service("http", 80), true, "")}
+	new := []*core.Rule{core.NewRule(1, s2.group("a", "10.0.0.1"), s2.group("b", "10.0.0.2"), s2.service("http", 80), true, "")}
+
+	report := Rules(old, new)
+	if !report.Empty() {
+		t.Fatalf("expected no changes, got: %s", report)
+	}
+}
+
+func TestRulesZones(t *testing.T) {
+	s := snapshot{t}
+	old := core.NewNamedRule("web", 1, s.group("a", "10.0.0.1"), s.group("b", "10.0.0.2"), s.service("http", 80), true, "")
+	old.AddFromZone(core.NewZone("trust", ""))
+	new := core.NewNamedRule("web", 1, s.group("a", "10.0.0.1"), s.group("b", "10.0.0.2"), s.service("http", 80), true, "")
+	new.AddFromZone(core.NewZone("untrust", ""))
+
+	report := Rules([]*core.Rule{old}, []*core.Rule{new})
+	if len(report.Rules) != 1 || len(report.Rules[0].Changes) != 1 {
+		t.Fatalf("expected a single zone change, got: %s", report)
+	}
+	c := report.Rules[0].Changes[0]
+	if c.Field != "from zone" || strings.Join(c.Removed, ",") != "trust" || strings.Join(c.Added, ",") != "untrust" {
+		t.Fatalf("unexpected zone change: %+v", c)
+	}
+}
+
+func TestReportJSON(t *testing.T) {
+	s := snapshot{t}
+	new := []*core.Rule{core.NewNamedRule("web", 1, s.group("a", "10.0.0.1"), s.group("b", "10.0.0.2"), s.service("http", 80), true, "")}
+
+	out, err := Rules(nil, new).JSON()
+	if err != nil {
+		t.Fatalf("failed to encode report: %v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(out, &decoded); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if len(decoded.Rules) != 1 || decoded.Rules[0].Kind != Added || decoded.Rules[0].New.Name != "web" {
+		t.Fatalf("unexpected decoded report: %+v", decoded)
+	}
+}
@@ -0,0 +1,188 @@
+package diff
+
+import (
+	"sort"
+
+	"github.com/Neffats/wherecp/core"
+)
+
+// ObjectChange is a named object referenced by the rules that was added,
+// removed or modified between the two snapshots. For groups the membership
+// changes are listed, for everything else the old and new values.
+type ObjectChange struct {
+	Kind           Kind     `json:"kind"`
+	Type           string   `json:"type"`
+	Name           string   `json:"name"`
+	Old            string   `json:"old,omitempty"`
+	New            string   `json:"new,omitempty"`
+	AddedMembers   []string `json:"added_members,omitempty"`
+	RemovedMembers []string `json:"removed_members,omitempty"`
+}
+
+// object is the comparable state of a named object.
+type object struct {
+	typ     string
+	name    string
+	value   string
+	members []string
+	group   bool
+}
+
+func (o *object) key() string {
+	return o.typ + "/" + o.name
+}
+
+// objects indexes every named object reachable from the rules by type and name.
+type objects map[string]*object
+
+func collect(rules []*core.Rule) objects {
+	objs := make(objects)
+	for _, r := range rules {
+		if r.Source() != nil {
+			objs.addGroup(r.Source())
+		}
+		if r.Destination() != nil {
+			objs.addGroup(r.Destination())
+		}
+		if r.Port() != nil {
+			objs.addPortGroup(r.Port())
+		}
+	}
+	return objs
+}
+
+func (objs objects) add(o *object) string {
+	key := o.key()
+	// The first definition seen wins, names are expected to be unique per type.
+	if _, ok := objs[key]; !ok {
+		objs[key] = o
+	}
+	return key
+}
+
+func (objs objects) addGroup(g *core.Group) string {
+	o := &object{typ: "group", name: g.Name(), group: true}
+	key := o.key()
+	if _, ok := objs[key]; ok {
+		return key
+	}
+	objs[key] = o
+
+	for _, h := range g.Hosts() {
+		o.members = append(o.members, objs.add(&object{typ: "host", name: h.Name(), value: h.String()}))
+	}
+	for _, n := range g.Networks() {
+		o.members = append(o.members, objs.add(&object{typ: "network", name: n.Name(), value: n.String()}))
+	}
+	for _, r := range g.Ranges() {
+		o.members = append(o.members, objs.add(&object{typ: "range", name: r.Name(), value: r.String()}))
+	}
+	for _, grp := range g.Groups() {
+		o.members = append(o.members, objs.addGroup(grp))
+	}
+	for _, f := range g.FQDNs() {
+		o.members = append(o.members, objs.add(&object{typ: "fqdn", name: f.Name(), value: f.FQDN()}))
+	}
+	for _, w := range g.Wildcards() {
+		o.members = append(o.members, objs.add(&object{typ: "wildcard", name: w.Name(), value: w.String()}))
+	}
+	for _, r := range g.Regions() {
+		o.members = append(o.members, objs.add(&object{typ: "region", name: r.Name(), value: r.Code()}))
+	}
+	// Exclusions and negation are listed as pseudo members so that changing
+	// them shows up as a membership change.
+	for _, ex := range g.Excluded() {
+		o.members = append(o.members, "!"+objs.addGroup(ex))
+	}
+	if g.Negated() {
+		o.members = append(o.members, "(negated)")
+	}
+	sort.Strings(o.members)
+	return key
+}
+
+func (objs objects) addPortGroup(pg *core.PortGroup) string {
+	o := &object{typ: "service-group", name: pg.Name(), group: true}
+	key := o.key()
+	if _, ok := objs[key]; ok {
+		return key
+	}
+	objs[key] = o
+
+	for _, p := range pg.Ports() {
+		o.members = append(o.members, objs.add(&object{typ: "service", name: p.Name(), value: p.String()}))
+	}
+	for _, r := range pg.Ranges() {
+		o.members = append(o.members, objs.add(&object{typ: "service", name: r.Name(), value: r.String()}))
+	}
+	for _, svc := range pg.Services() {
+		o.members = append(o.members, objs.add(&object{typ: "service", name: svc.Name(), value: svc.String()}))
+	}
+	for _, grp := range pg.Groups() {
+		o.members = append(o.members, objs.addPortGroup(grp))
+	}
+	sort.Strings(o.members)
+	return key
+}
+
+func diffObjects(old, new []*core.Rule) []ObjectChange {
+	before := collect(old)
+	after := collect(new)
+
+	keys := make([]string, 0, len(before)+len(after))
+	for k := range before {
+		keys = append(keys, k)
+	}
+	for k := range after {
+		if _, ok := before[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := make([]ObjectChange, 0)
+	for _, k := range keys {
+		o, inOld := before[k]
+		n, inNew := after[k]
+		switch {
+		case !inNew:
+			changes = append(changes, ObjectChange{Kind: Removed, Type: o.typ, Name: o.name, Old: o.value})
+		case !inOld:
+			changes = append(changes, ObjectChange{Kind: Added, Type: n.typ, Name: n.name, New: n.value})
+		case o.group:
+			removed, added := membership(o.members, n.members)
+			if len(removed) == 0 && len(added) == 0 {
+				continue
+			}
+			changes = append(changes, ObjectChange{
+				Kind:           Modified,
+				Type:           o.typ,
+				Name:           o.name,
+				AddedMembers:   added,
+				RemovedMembers: removed,
+			})
+		case o.value != n.value:
+			changes = append(changes, ObjectChange{Kind: Modified, Type: o.typ, Name: o.name, Old: o.value, New: n.value})
+		}
+	}
+	return changes
+}
+
+// membership compares two sorted member lists.
+func membership(old, new []string) (removed, added []string) {
+	i, j := 0, 0
+	for i < len(old) || j < len(new) {
+		switch {
+		case j >= len(new) || (i < len(old) && old[i] < new[j]):
+			removed = append(removed, old[i])
+			i++
+		case i >= len(old) || new[j] < old[i]:
+			added = append(added, new[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	return removed, added
+}
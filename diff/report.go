@@ -0,0 +1,95 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+var symbols = map[Kind]string{
+	Added:    "+",
+	Removed:  "-",
+	Moved:    ">",
+	Modified: "~",
+}
+
+// JSON returns the report encoded as indented JSON.
+func (r *Report) JSON() ([]byte, error) {
+	out, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode diff report: %v", err)
+	}
+	return out, nil
+}
+
+// String returns a human readable version of the report.
+func (r *Report) String() string {
+	if r.Empty() {
+		return "no changes\n"
+	}
+	var b strings.Builder
+	if len(r.Rules) > 0 {
+		b.WriteString("Rules:\n")
+		for _, c := range r.Rules {
+			b.WriteString(c.String())
+		}
+	}
+	if len(r.Objects) > 0 {
+		b.WriteString("Objects:\n")
+		for _, c := range r.Objects {
+			b.WriteString(c.String())
+		}
+	}
+	return b.String()
+}
+
+func (c RuleChange) String() string {
+	var b strings.Builder
+	switch c.Kind {
+	case Added:
+		fmt.Fprintf(&b, "  %s %s\n", symbols[c.Kind], c.New)
+	case Removed:
+		fmt.Fprintf(&b, "  %s %s\n", symbols[c.Kind], c.Old)
+	case Moved:
+		fmt.Fprintf(&b, "  %s %s (moved from %d to %d)\n", symbols[c.Kind], c.New, c.Old.Number, c.New.Number)
+	case Modified:
+		fmt.Fprintf(&b, "  %s %s\n", symbols[c.Kind], c.New)
+		for _, f := range c.Changes {
+			if len(f.Removed) > 0 {
+				fmt.Fprintf(&b, "      %s: - %s\n", f.Field, strings.Join(f.Removed, ", "))
+			}
+			if len(f.Added) > 0 {
+				fmt.Fprintf(&b, "      %s: + %s\n", f.Field, strings.Join(f.Added, ", "))
+			}
+		}
+	}
+	return b.String()
+}
+
+func (c ObjectChange) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "  %s %s %q", symbols[c.Kind], c.Type, c.Name)
+	switch {
+	case c.Kind == Added:
+		if c.New != "" {
+			fmt.Fprintf(&b, " (%s)", c.New)
+		}
+	case c.Kind == Removed:
+		if c.Old != "" {
+			fmt.Fprintf(&b, " (%s)", c.Old)
+		}
+	case len(c.AddedMembers) > 0 || len(c.RemovedMembers) > 0:
+		members := make([]string, 0)
+		for _, m := range c.RemovedMembers {
+			members = append(members, "-"+m)
+		}
+		for _, m := range c.AddedMembers {
+			members = append(members, "+"+m)
+		}
+		fmt.Fprintf(&b, " members: %s", strings.Join(members, ", "))
+	default:
+		fmt.Fprintf(&b, " %s -> %s", c.Old, c.New)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
@@ -0,0 +1,324 @@
+// Package eval answers what a node does with a given packet by walking its
+// rules in order until one matches.
+package eval
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Neffats/ip"
+	"github.com/Neffats/wherecp/core"
+	"github.com/Neffats/wherecp/node"
+)
+
+// Packet is the 5-tuple of a single flow. SourcePort only matters for rules
+// whose services are restricted to source ports. ICMP packets leave the ports
+// empty and set ICMPType and ICMPCode instead.
+//
+// FromZone and ToZone are the ingress and egress zones. When they are left
+// empty, an evaluator created by ForNode works them out from the node's
+// interfaces. Rules scoped to zones never match a packet whose zone is unknown.
+//
+// Application and User are the application and user the firewall identified
+// the flow as. Likewise, rules scoped to applications or users never match a
+// packet that leaves them empty.
+type Packet struct {
+	Source          string `json:"source"`
+	Destination     string `json:"destination"`
+	Protocol        string `json:"protocol"`
+	SourcePort      uint   `json:"source_port,omitempty"`
+	DestinationPort uint   `json:"destination_port"`
+	ICMPType        uint8  `json:"icmp_type,omitempty"`
+	ICMPCode        uint8  `json:"icmp_code,omitempty"`
+	FromZone        string `json:"from_zone,omitempty"`
+	ToZone          string `json:"to_zone,omitempty"`
+	Application     string `json:"application,omitempty"`
+	User            string `json:"user,omitempty"`
+}
+
+func (p Packet) String() string {
+	if p.icmp() {
+		return fmt.Sprintf("%s -> %s %s/%d:%d", p.Source, p.Destination, p.Protocol, p.ICMPType, p.ICMPCode)
+	}
+	return fmt.Sprintf("%s -> %s %s/%d", p.Source, p.Destination, p.Protocol, p.DestinationPort)
+}
+
+func (p Packet) icmp() bool {
+	proto := core.String2Proto(p.Protocol)
+	return proto == core.ICMP || proto == core.ICMPv6
+}
+
+// Component is a part of a rule that a packet has to match.
+type Component int
+
+const (
+	Source Component = iota
+	Destination
+	Service
+	FromZone
+	ToZone
+	Application
+	User
+	Schedule
+)
+
+var components = [8]string{"source", "destination", "service", "from zone", "to zone", "application", "user", "schedule"}
+
+func (c Component) String() string {
+	if c < 0 || int(c) > len(components)-1 {
+		return ""
+	}
+	return components[c]
+}
+
+// MarshalText satisfies the encoding.TextMarshaler interface so components
+// are encoded by name.
+func (c Component) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// Step is a single rule looked at while evaluating a packet.
+// Failed lists the components that didn't match, empty if the rule matched.
+type Step struct {
+	Rule *core.Rule `json:"-"`
+	// Number is the rule's configured number.
+	Number int `json:"number"`
+	// Position is where the rule is in evaluation order, starting at 1. It
+	// differs from Number when the rule numbers aren't contiguous.
+	Position int         `json:"position"`
+	Failed   []Component `json:"failed,omitempty"`
+}
+
+// Matched returns true if the rule matched the packet.
+func (s Step) Matched() bool {
+	return len(s.Failed) == 0
+}
+
+func (s Step) String() string {
+	label := fmt.Sprintf("rule %d", s.Number)
+	if s.Rule.Name() != "" {
+		label = fmt.Sprintf("%s (%s)", label, s.Rule.Name())
+	}
+	if s.Matched() {
+		return fmt.Sprintf("%s: matched", label)
+	}
+	failed := make([]string, 0, len(s.Failed))
+	for _, c := range s.Failed {
+		failed = append(failed, c.String())
+	}
+	return fmt.Sprintf("%s: skipped, %s didn't match", label, strings.Join(failed, ", "))
+}
+
+// Result is what the node does with a packet. Rule is nil when no rule
+// matched and the default action applied.
+type Result struct {
+	Packet Packet `json:"packet"`
+	// NAT is the NAT rule that matched the packet, nil if there was none.
+	NAT *core.NATRule `json:"-"`
+	// Translated is the packet after NAT, nil if NAT didn't apply.
+	Translated *Packet    `json:"translated,omitempty"`
+	Rule       *core.Rule `json:"-"`
+	// Number and Position are the matching rule's configured number and
+	// its place in evaluation order, see Step. Both are zero if no rule
+	// matched.
+	Number   int  `json:"number,omitempty"`
+	Position int  `json:"position,omitempty"`
+	Permit   bool `json:"permit"`
+	// Trace lists every rule up to and including the matching one.
+	// Only filled in by Explain.
+	Trace []Step `json:"trace,omitempty"`
+}
+
+// Default returns true if no rule matched the packet.
+func (r *Result) Default() bool {
+	return r.Rule == nil
+}
+
+func (r *Result) String() string {
+	action := "deny"
+	if r.Permit {
+		action = "permit"
+	}
+	var b strings.Builder
+	if r.Translated != nil {
+		fmt.Fprintf(&b, "nat %s: %s\n", r.NAT.Name(), r.Translated)
+	}
+	for _, s := range r.Trace {
+		fmt.Fprintf(&b, "%s\n", s)
+	}
+	if r.Default() {
+		fmt.Fprintf(&b, "%s: %s (default)\n", r.Packet, action)
+	} else {
+		fmt.Fprintf(&b, "%s: %s (rule %d)\n", r.Packet, action, r.Number)
+	}
+	return b.String()
+}
+
+// Evaluator matches packets against an ordered list of rules.
+type Evaluator struct {
+	// DefaultPermit is the action taken when no rule matches.
+	// Firewalls deny by default.
+	DefaultPermit bool
+	// NAT holds the NAT rules applied before the security rules, in policy order.
+	// Security rules are matched against the real addresses: the original
+	// source and the translated destination and port.
+	NAT []*core.NATRule
+	// Time is when the packet is evaluated, rules whose schedules don't apply
+	// at that time are skipped. The current time is used if it is zero.
+	Time time.Time
+
+	rules   []*core.Rule
+	traffic []core.Traffic
+	// node is used to work out the zones of a packet, nil if unknown.
+	node *node.Node
+}
+
+// New returns an evaluator over rules, which must be in policy order.
+func New(rules []*core.Rule) *Evaluator {
+	e := &Evaluator{
+		rules:   rules,
+		traffic: make([]core.Traffic, len(rules)),
+	}
+	for i, r := range rules {
+		e.traffic[i] = r.Traffic()
+	}
+	return e
+}
+
+// ForNode returns an evaluator over the node's rules and NAT rules, ordered
+// by rule number.
+func ForNode(n *node.Node) *Evaluator {
+	rules := n.Rules.All()
+	ordered := make([]*core.Rule, len(rules))
+	copy(ordered, rules)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Number() < ordered[j].Number()
+	})
+	e := New(ordered)
+	e.NAT = n.NATRules()
+	e.node = n
+	return e
+}
+
+// Evaluate returns the first rule matching the packet.
+func (e *Evaluator) Evaluate(p Packet) (*Result, error) {
+	return e.evaluate(p, false)
+}
+
+// Explain works like Evaluate but also records why every rule before the
+// matching one was skipped.
+func (e *Evaluator) Explain(p Packet) (*Result, error) {
+	return e.evaluate(p, true)
+}
+
+func (e *Evaluator) evaluate(p Packet, explain bool) (*Result, error) {
+	src, err := ip.NewAddress(p.Source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source: %v", err)
+	}
+	dst, err := ip.NewAddress(p.Destination)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination: %v", err)
+	}
+	proto := core.String2Proto(p.Protocol)
+	if proto == -1 {
+		return nil, fmt.Errorf("invalid protocol: %s", p.Protocol)
+	}
+
+	result := &Result{Packet: p, Permit: e.DefaultPermit}
+	port := p.DestinationPort
+	if p.icmp() {
+		port = core.ICMPPort(p.ICMPType, p.ICMPCode)
+	}
+
+	flow := core.Flow{Source: *src, Destination: *dst, Protocol: proto, Port: port}
+	translated, nat := core.ApplyNAT(e.NAT, flow)
+	if nat != nil {
+		result.NAT = nat
+		result.Translated = &Packet{
+			Source:          core.FormatAddress(translated.Source),
+			Destination:     core.FormatAddress(translated.Destination),
+			Protocol:        p.Protocol,
+			SourcePort:      p.SourcePort,
+			DestinationPort: p.DestinationPort,
+			ICMPType:        p.ICMPType,
+			ICMPCode:        p.ICMPCode,
+		}
+		if !p.icmp() {
+			result.Translated.DestinationPort = translated.Port
+		}
+	}
+
+	if p.FromZone == "" {
+		p.FromZone = e.zone(flow.Source)
+	}
+	if p.ToZone == "" {
+		p.ToZone = e.zone(translated.Destination)
+	}
+	result.Packet = p
+
+	srcSet := core.AddressSet{{Start: flow.Source, End: flow.Source}}
+	dstSet := core.AddressSet{{Start: translated.Destination, End: translated.Destination}}
+
+	at := e.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	if explain {
+		result.Trace = make([]Step, 0)
+	}
+	for i, t := range e.traffic {
+		failed := make([]Component, 0)
+		if !t.Source.Contains(srcSet) {
+			failed = append(failed, Source)
+		}
+		if !t.Destination.Contains(dstSet) {
+			failed = append(failed, Destination)
+		}
+		if !e.rules[i].Port().Allows(proto, p.SourcePort, translated.Port) {
+			failed = append(failed, Service)
+		}
+		if !e.rules[i].MatchFromZone(p.FromZone) {
+			failed = append(failed, FromZone)
+		}
+		if !e.rules[i].MatchToZone(p.ToZone) {
+			failed = append(failed, ToZone)
+		}
+		if !e.rules[i].MatchApplication(p.Application) {
+			failed = append(failed, Application)
+		}
+		if !e.rules[i].MatchUser(p.User) {
+			failed = append(failed, User)
+		}
+		if !e.rules[i].ActiveAt(at) {
+			failed = append(failed, Schedule)
+		}
+
+		if explain {
+			result.Trace = append(result.Trace, Step{Rule: e.rules[i], Number: e.rules[i].Number(), Position: i + 1, Failed: failed})
+		}
+		if len(failed) == 0 {
+			result.Rule = e.rules[i]
+			result.Number = e.rules[i].Number()
+			result.Position = i + 1
+			result.Permit = e.rules[i].Action()
+			return result, nil
+		}
+	}
+	return result, nil
+}
+
+// zone returns the name of the zone the node uses for addr, empty if unknown.
+func (e *Evaluator) zone(addr ip.Address) string {
+	if e.node == nil {
+		return ""
+	}
+	z := e.node.Zone(&addr)
+	if z == nil {
+		return ""
+	}
+	return z.Name()
+}
@@ -0,0 +1,316 @@
+package eval
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Neffats/ip"
+	"github.com/Neffats/wherecp/core"
+	"github.com/Neffats/wherecp/node"
+	natstore "github.com/Neffats/wherecp/store/nat"
+	rulestore "github.com/Neffats/wherecp/store/rule"
+)
+
+type testPuller struct{}
+
+func (tp *testPuller) PullRules() ([]*core.Rule, error) {
+	return make([]*core.Rule, 0), nil
+}
+
+func network(t *testing.T, name, addr, mask string) *core.Group {
+	t.Helper()
+	n, err := core.NewNetwork(name, addr, mask, "")
+	if err != nil {
+		t.Fatalf("failed to create network: %v", err)
+	}
+	grp := core.NewGroup(name, "")
+	if err := grp.Add(n); err != nil {
+		t.Fatalf("failed to add network to group: %v", err)
+	}
+	return grp
+}
+
+func service(t *testing.T, name string, port uint) *core.PortGroup {
+	t.Helper()
+	p, err := core.NewPort(name, port, "tcp", "")
+	if err != nil {
+		t.Fatalf("failed to create port: %v", err)
+	}
+	pg := core.NewPortGroup(name, "")
+	if err := pg.Add(p); err != nil {
+		t.Fatalf("failed to add port to group: %v", err)
+	}
+	return pg
+}
+
+func TestEvaluate(t *testing.T) {
+	any := network(t, "any", "0.0.0.0", "0.0.0.0")
+	clients := network(t, "clients", "10.0.0.0", "255.255.255.0")
+	web := network(t, "web", "10.1.0.0", "255.255.255.0")
+
+	store := rulestore.New(&testPuller{})
+	store.Rules = []*core.Rule{
+		core.NewNamedRule("deny-ssh", 20, any, any, service(t, "ssh", 22), false, ""),
+		core.NewNamedRule("allow-web", 10, clients, web, service(t, "http", 80), true, ""),
+		core.NewNamedRule("allow-ssh", 30, clients, web, service(t, "ssh", 22), true, ""),
+	}
+	e := ForNode(&node.Node{Rules: store})
+
+	tests := []struct {
+		name     string
+		packet   Packet
+		permit   bool
+		position int
+		failed   [][]Component
+		err      bool
+	}{
+		{
+			name:     "First rule",
+			packet:   Packet{Source: "10.0.0.1", Destination: "10.1.0.1", Protocol: "tcp", DestinationPort: 80},
+			permit:   true,
+			position: 1,
+			failed:   [][]Component{{}},
+		},
+		{
+			name:     "Shadowed by deny",
+			packet:   Packet{Source: "10.0.0.1", Destination: "10.1.0.1", Protocol: "tcp", DestinationPort: 22},
+			permit:   false,
+			position: 2,
+			failed:   [][]Component{{Service}, {}},
+		},
+		{
+			name:     "Default",
+			packet:   Packet{Source: "192.168.0.1", Destination: "10.2.0.1", Protocol: "tcp", DestinationPort: 80},
+			permit:   false,
+			position: 0,
+			failed:   [][]Component{{Source, Destination}, {Service}, {Source, Destination, Service}},
+		},
+		{
+			name:   "Invalid source",
+			packet: Packet{Source: "10.0.0", Destination: "10.1.0.1", Protocol: "tcp", DestinationPort: 80},
+			err:    true,
+		},
+		{
+			name:   "Invalid protocol",
+			packet: Packet{Source: "10.0.0.1", Destination: "10.1.0.1", Protocol: "xma", DestinationPort: 80},
+			err:    true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := e.Explain(tc.packet)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error when not expected: %v", err)
+			}
+			if got.Permit != tc.permit || got.Position != tc.position || got.Default() != (tc.position == 0) {
+				t.Fatalf("expected permit %t at position %d, got: %+v", tc.permit, tc.position, got)
+			}
+			// The rules are numbered in tens.
+			if got.Number != tc.position*10 {
+				t.Fatalf("expected rule number %d, got: %+v", tc.position*10, got)
+			}
+			if len(got.Trace) != len(tc.failed) {
+				t.Fatalf("expected %d steps, got: %+v", len(tc.failed), got.Trace)
+			}
+			for i, s := range got.Trace {
+				if s.Position != i+1 || s.Number != (i+1)*10 {
+					t.Fatalf("step %d: unexpected position or number: %+v", i+1, s)
+				}
+				if len(s.Failed) != len(tc.failed[i]) {
+					t.Fatalf("step %d: expected %v to fail, got: %v", i+1, tc.failed[i], s.Failed)
+				}
+				for j := range s.Failed {
+					if s.Failed[j] != tc.failed[i][j] {
+						t.Fatalf("step %d: expected %v to fail, got: %v", i+1, tc.failed[i], s.Failed)
+					}
+				}
+			}
+
+			plain, err := e.Evaluate(tc.packet)
+			if err != nil {
+				t.Fatalf("got error when not expected: %v", err)
+			}
+			if plain.Trace != nil || plain.Permit != got.Permit || plain.Position != got.Position {
+				t.Fatalf("expected Evaluate to match Explain without a trace, got: %+v", plain)
+			}
+		})
+	}
+}
+
+func TestDefaultPermit(t *testing.T) {
+	e := New(nil)
+	e.DefaultPermit = true
+	got, err := e.Evaluate(Packet{Source: "10.0.0.1", Destination: "10.1.0.1", Protocol: "udp", DestinationPort: 53})
+	if err != nil {
+		t.Fatalf("got error when not expected: %v", err)
+	}
+	if !got.Permit || !got.Default() {
+		t.Fatalf("expected default permit, got: %+v", got)
+	}
+}
+
+func TestEvaluateNAT(t *testing.T) {
+	any := network(t, "any", "0.0.0.0", "0.0.0.0")
+	web := network(t, "web", "10.1.0.10", "255.255.255.255")
+	public := network(t, "public", "203.0.113.10", "255.255.255.255")
+
+	static, err := core.NewStaticNAT("web", 1, web, public, "")
+	if err != nil {
+		t.Fatalf("failed to create static nat: %v", err)
+	}
+	nat := natstore.New(nil)
+	if err := nat.Insert(static); err != nil {
+		t.Fatalf("failed to insert nat rule: %v", err)
+	}
+	store := rulestore.New(&testPuller{})
+	store.Rules = []*core.Rule{
+		core.NewNamedRule("allow-web", 1, any, web, service(t, "https", 443), true, ""),
+	}
+	e := ForNode(&node.Node{Rules: store, NAT: nat})
+
+	got, err := e.Explain(Packet{Source: "8.8.8.8", Destination: "203.0.113.10", Protocol: "tcp", DestinationPort: 443})
+	if err != nil {
+		t.Fatalf("got error when not expected: %v", err)
+	}
+	if got.NAT != static || got.Translated == nil || got.Translated.Destination != "10.1.0.10" {
+		t.Fatalf("expected destination to be translated to the web server, got: %+v", got)
+	}
+	if !got.Permit || got.Position != 1 {
+		t.Fatalf("expected allow-web to match the real address, got: %+v", got)
+	}
+
+	got, err = e.Evaluate(Packet{Source: "8.8.8.8", Destination: "10.1.0.11", Protocol: "tcp", DestinationPort: 443})
+	if err != nil {
+		t.Fatalf("got error when not expected: %v", err)
+	}
+	if got.NAT != nil || got.Translated != nil || !got.Default() {
+		t.Fatalf("expected no translation and the default action, got: %+v", got)
+	}
+}
+
+func TestEvaluateZones(t *testing.T) {
+	any := network(t, "any", "0.0.0.0", "0.0.0.0")
+	outside, inside := core.NewInterface("ethernet1/1", ""), core.NewInterface("ethernet1/2", "")
+	untrust, trust := core.NewZone("untrust", ""), core.NewZone("trust", "")
+	untrust.Add(outside)
+	trust.Add(inside)
+
+	fromUntrust := core.NewNamedRule("from-untrust", 1, any, any, service(t, "https", 443), true, "")
+	fromUntrust.AddFromZone(untrust)
+	fromUntrust.AddToZone(trust)
+
+	addr := func(a string) *ip.Address {
+		t.Helper()
+		out, err := ip.NewAddress(a)
+		if err != nil {
+			t.Fatalf("failed to create address: %v", err)
+		}
+		return out
+	}
+	store := rulestore.New(&testPuller{})
+	store.Rules = []*core.Rule{fromUntrust}
+	n := &node.Node{
+		ConnectedNetworks: []node.Subnet{
+			{Address: addr("10.0.0.0"), Mask: addr("255.255.255.0"), Interface: inside},
+			{Address: addr("198.51.100.0"), Mask: addr("255.255.255.252"), Interface: outside},
+		},
+		Routes: []node.Route{
+			{Destination: node.Subnet{Address: addr("0.0.0.0"), Mask: addr("0.0.0.0")}, NextHop: addr("198.51.100.1")},
+		},
+		Rules: store,
+		Zones: []*core.Zone{untrust, trust},
+	}
+	e := ForNode(n)
+
+	tests := []struct {
+		name   string
+		packet Packet
+		permit bool
+		failed []Component
+	}{
+		{
+			name:   "Inbound",
+			packet: Packet{Source: "8.8.8.8", Destination: "10.0.0.5", Protocol: "tcp", DestinationPort: 443},
+			permit: true,
+			failed: []Component{},
+		},
+		{
+			name:   "Outbound",
+			packet: Packet{Source: "10.0.0.5", Destination: "8.8.8.8", Protocol: "tcp", DestinationPort: 443},
+			permit: false,
+			failed: []Component{FromZone, ToZone},
+		},
+		{
+			name:   "Given zones",
+			packet: Packet{Source: "10.0.0.5", Destination: "8.8.8.8", Protocol: "tcp", DestinationPort: 443, FromZone: "untrust", ToZone: "trust"},
+			permit: true,
+			failed: []Component{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := e.Explain(tc.packet)
+			if err != nil {
+				t.Fatalf("got error when not expected: %v", err)
+			}
+			if got.Permit != tc.permit || len(got.Trace) != 1 {
+				t.Fatalf("expected permit %t, got: %+v", tc.permit, got)
+			}
+			failed := got.Trace[0].Failed
+			if len(failed) != len(tc.failed) {
+				t.Fatalf("expected %v to fail, got: %v", tc.failed, failed)
+			}
+			for i := range failed {
+				if failed[i] != tc.failed[i] {
+					t.Fatalf("expected %v to fail, got: %v", tc.failed, failed)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateSchedule(t *testing.T) {
+	any := network(t, "any", "0.0.0.0", "0.0.0.0")
+	window, err := core.NewSchedule("weekend", "UTC", "")
+	if err != nil {
+		t.Fatalf("failed to create schedule: %v", err)
+	}
+	if err := window.AddWindow([]time.Weekday{time.Saturday, time.Sunday}, "00:00", "24:00"); err != nil {
+		t.Fatalf("failed to add window: %v", err)
+	}
+	weekend := core.NewNamedRule("weekend", 1, any, any, service(t, "ssh", 22), true, "")
+	weekend.SetSchedule(window)
+	e := New([]*core.Rule{weekend})
+
+	tests := []struct {
+		name   string
+		at     time.Time
+		permit bool
+	}{
+		{name: "Saturday", at: time.Date(2024, time.March, 2, 12, 0, 0, 0, time.UTC), permit: true},
+		{name: "Monday", at: time.Date(2024, time.March, 4, 12, 0, 0, 0, time.UTC), permit: false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			e.Time = tc.at
+			got, err := e.Explain(Packet{Source: "10.0.0.1", Destination: "10.1.0.1", Protocol: "tcp", DestinationPort: 22})
+			if err != nil {
+				t.Fatalf("got error when not expected: %v", err)
+			}
+			if got.Permit != tc.permit {
+				t.Fatalf("expected permit %t, got: %s", tc.permit, got)
+			}
+			if !tc.permit && (len(got.Trace) != 1 || len(got.Trace[0].Failed) != 1 || got.Trace[0].Failed[0] != Schedule) {
+				t.Fatalf("expected the schedule to fail, got: %+v", got.Trace)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+// Package event lets integrations react to changes made to the stores. Stores
+// publish an Event for every object inserted, updated or deleted, which can be
+// received from a Subscription, streamed over HTTP as server-sent events or
+// posted to a webhook.
+package event
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Op is the kind of change an event describes.
+type Op string
+
+const (
+	Insert Op = "insert"
+	Update Op = "update"
+	Delete Op = "delete"
+)
+
+// Event describes a change to a single object of a store.
+type Event struct {
+	Op Op
+	// Kind of object changed, i.e. rule, host, network or nat-rule.
+	Kind string
+	// Node is the node of the store, empty if the store's Node isn't set.
+	Node string
+	UID  string
+	Time time.Time
+	// Object is the object after the change, or before it for a delete.
+	// It mustn't be modified.
+	Object interface{}
+}
+
+// New returns an event for a change made now.
+func New(op Op, kind, node, uid string, obj interface{}) Event {
+	return Event{Op: op, Kind: kind, Node: node, UID: uid, Time: time.Now(), Object: obj}
+}
+
+type eventJSON struct {
+	Op     Op              `json:"op"`
+	Kind   string          `json:"kind"`
+	Node   string          `json:"node,omitempty"`
+	UID    string          `json:"uid"`
+	Time   time.Time       `json:"time"`
+	Object json.RawMessage `json:"object,omitempty"`
+}
+
+// MarshalJSON encodes the event. The object is only included if it has a JSON
+// encoding of its own.
+func (e Event) MarshalJSON() ([]byte, error) {
+	out := eventJSON{Op: e.Op, Kind: e.Kind, Node: e.Node, UID: e.UID, Time: e.Time}
+	if m, ok := e.Object.(json.Marshaler); ok {
+		obj, err := m.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		out.Object = obj
+	}
+	return json.Marshal(out)
+}
+
+// Subscription receives the events published by a Broker after it subscribed.
+type Subscription struct {
+	// C receives the events, it is closed by Close.
+	C <-chan Event
+
+	c       chan Event
+	broker  *Broker
+	dropped int64
+	once    sync.Once
+}
+
+// Close stops the subscription and closes C.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.broker.mux.Lock()
+		defer s.broker.mux.Unlock()
+		delete(s.broker.subs, s)
+		close(s.c)
+	})
+}
+
+// Dropped returns the number of events that were dropped because C was full.
+func (s *Subscription) Dropped() int {
+	return int(atomic.LoadInt64(&s.dropped))
+}
+
+// Broker hands out events to every subscriber. The zero value is ready to use.
+type Broker struct {
+	subs map[*Subscription]bool
+
+	mux sync.Mutex
+}
+
+// Subscribe returns a subscription to every event published from now on.
+// Publishers never wait for subscribers, so events that arrive while C holds
+// buffer events already are dropped.
+func (b *Broker) Subscribe(buffer int) *Subscription {
+	c := make(chan Event, buffer)
+	s := &Subscription{C: c, c: c, broker: b}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.subs == nil {
+		b.subs = make(map[*Subscription]bool)
+	}
+	b.subs[s] = true
+	return s
+}
+
+// Publish sends the events, in order, to every subscriber.
+func (b *Broker) Publish(events ...Event) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	for s := range b.subs {
+		for _, e := range events {
+			select {
+			case s.c <- e:
+			default:
+				atomic.AddInt64(&s.dropped, 1)
+			}
+		}
+	}
+}
+
+// Source is satisfied by stores that publish events.
+type Source interface {
+	Subscribe(buffer int) *Subscription
+}
@@ -0,0 +1,49 @@
+package event
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Neffats/wherecp/core"
+)
+
+func TestBroker(t *testing.T) {
+	var b Broker
+	sub := b.Subscribe(2)
+	other := b.Subscribe(1)
+
+	host, err := core.NewHost("web", "10.0.0.1", "")
+	if err != nil {
+		t.Fatalf("failed to create host: %v", err)
+	}
+	b.Publish(New(Insert, "host", "fw01", host.UID(), host), New(Delete, "host", "fw01", host.UID(), host))
+
+	if got := (<-sub.C).Op; got != Insert {
+		t.Fatalf("want: %s, got: %s", Insert, got)
+	}
+	if got := (<-sub.C).Op; got != Delete {
+		t.Fatalf("want: %s, got: %s", Delete, got)
+	}
+	if other.Dropped() != 1 {
+		t.Fatalf("expected 1 dropped event, got: %d", other.Dropped())
+	}
+
+	sub.Close()
+	sub.Close()
+	if _, ok := <-sub.C; ok {
+		t.Fatalf("expected a closed channel")
+	}
+	// Publishing after a subscriber has gone mustn't panic.
+	b.Publish(New(Update, "host", "fw01", host.UID(), host))
+
+	data, err := json.Marshal(New(Update, "host", "fw01", host.UID(), host))
+	if err != nil {
+		t.Fatalf("failed to marshal event: %v", err)
+	}
+	for _, want := range []string{`"op":"update"`, `"kind":"host"`, `"node":"fw01"`, `"address":"10.0.0.1"`} {
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("expected %s in %s", want, data)
+		}
+	}
+}
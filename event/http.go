@@ -0,0 +1,149 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// streamBuffer is the number of events a stream holds for a slow client
+// before dropping them.
+const streamBuffer = 256
+
+// Stream returns a handler that streams the events of sources to the client as
+// server-sent events, until the client disconnects. Each event is sent with
+// its op as the event type and its JSON encoding as the data. The kind query
+// parameter, i.e. ?kind=rule, restricts the stream to one kind of object.
+func Stream(sources ...Source) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+		kind := r.URL.Query().Get("kind")
+
+		// Fan the subscriptions into a single channel.
+		events := make(chan Event, streamBuffer)
+		for _, src := range sources {
+			sub := src.Subscribe(streamBuffer)
+			defer sub.Close()
+			go func(sub *Subscription) {
+				for e := range sub.C {
+					select {
+					case events <- e:
+					case <-r.Context().Done():
+						return
+					}
+				}
+			}(sub)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case e := <-events:
+				if kind != "" && e.Kind != kind {
+					continue
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Op, data); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	})
+}
+
+// Webhook posts events as JSON to a URL, retrying failed posts.
+type Webhook struct {
+	URL string
+	// Client used to post events, http.DefaultClient if nil.
+	Client *http.Client
+	// Retries is the number of times a failed post is retried, waiting
+	// Backoff before the first retry and doubling it for every retry after.
+	Retries int
+	Backoff time.Duration
+}
+
+// Run posts every event of sub until ctx is done or sub is closed. Events that
+// still fail after every retry are passed to failed, which may be nil.
+func (wh *Webhook) Run(ctx context.Context, sub *Subscription, failed func(Event, error)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if err := wh.Send(ctx, e); err != nil && failed != nil {
+				failed(e, err)
+			}
+		}
+	}
+}
+
+// Send posts a single event, retrying if the post fails or gets a 5xx or 429
+// response. Other responses outside of 2xx aren't retried.
+func (wh *Webhook) Send(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %v", err)
+	}
+	client := wh.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	backoff := wh.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := wh.post(ctx, client, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= wh.Retries {
+			return fmt.Errorf("failed to post event %s %s after %d attempts: %v", e.Op, e.UID, attempt+1, err)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to post event %s %s: %w", e.Op, e.UID, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post posts body once, returning whether a failure is worth retrying.
+func (wh *Webhook) post(ctx context.Context, client *http.Client, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("got status %s", resp.Status)
+	default:
+		return false, fmt.Errorf("got status %s", resp.Status)
+	}
+}
@@ -0,0 +1,105 @@
+package event
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+	var b Broker
+	server := httptest.NewServer(Stream(&b))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?kind=rule")
+	if err != nil {
+		t.Fatalf("failed to connect to stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("want: text/event-stream, got: %s", ct)
+	}
+
+	// The handler subscribes before sending the headers, so the events
+	// are received.
+	b.Publish(New(Insert, "host", "fw01", "h1", nil), New(Delete, "rule", "fw01", "r1", nil))
+
+	lines := bufio.NewScanner(resp.Body)
+	got := make([]string, 0)
+	for len(got) < 2 && lines.Scan() {
+		if lines.Text() != "" {
+			got = append(got, lines.Text())
+		}
+	}
+	if len(got) != 2 || got[0] != "event: delete" || !strings.Contains(got[1], `"uid":"r1"`) {
+		t.Fatalf("unexpected stream: %q", got)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var mux sync.Mutex
+	attempts := 0
+	received := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+		attempts++
+		var e map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch e["uid"] {
+		case "flaky":
+			if attempts < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		case "rejected":
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = append(received, e["uid"].(string))
+	}))
+	defer server.Close()
+
+	wh := &Webhook{URL: server.URL, Retries: 3, Backoff: time.Millisecond}
+	ctx := context.Background()
+	if err := wh.Send(ctx, New(Insert, "rule", "fw01", "flaky", nil)); err != nil {
+		t.Fatalf("failed to send event: %v", err)
+	}
+	mux.Lock()
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got: %d", attempts)
+	}
+	attempts = 0
+	mux.Unlock()
+
+	if err := wh.Send(ctx, New(Insert, "rule", "fw01", "rejected", nil)); err == nil {
+		t.Fatalf("expected rejected event to fail")
+	}
+	mux.Lock()
+	if attempts != 1 {
+		t.Fatalf("expected a rejected event not to be retried, got %d attempts", attempts)
+	}
+	mux.Unlock()
+
+	var b Broker
+	sub := b.Subscribe(4)
+	b.Publish(New(Update, "rule", "fw01", "r1", nil), New(Delete, "rule", "fw01", "r2", nil))
+	sub.Close()
+	wh.Run(ctx, sub, func(e Event, err error) {
+		t.Errorf("failed to post %s: %v", e.UID, err)
+	})
+	mux.Lock()
+	defer mux.Unlock()
+	if strings.Join(received, ",") != "flaky,r1,r2" {
+		t.Fatalf("unexpected events received: %v", received)
+	}
+}
@@ -0,0 +1,220 @@
+// Package exposure scores permit rules by how much traffic they let through
+// and flags rules that open internal addresses to the internet.
+package exposure
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/Neffats/wherecp/core"
+	"github.com/Neffats/wherecp/node"
+)
+
+const (
+	// Number of ports of a single protocol, 0-65535.
+	portsPerProtocol = 65536
+	// Default width above which a port range is reported as broad.
+	defaultBroadPorts = 1024
+	// Added to the score of rules that expose internal addresses to the internet.
+	exposurePenalty = 25
+)
+
+// Private address space as defined in RFC 1918.
+var rfc1918 = [][2]string{
+	{"10.0.0.0", "255.0.0.0"},
+	{"172.16.0.0", "255.240.0.0"},
+	{"192.168.0.0", "255.255.0.0"},
+}
+
+// Analyzer scores the permit rules of a policy.
+type Analyzer struct {
+	// Internal is the address space considered internal. Any other address
+	// is considered part of the internet.
+	Internal core.AddressSet
+	// BroadPorts is the width above which a port range is flagged as broad.
+	BroadPorts uint
+}
+
+// NewAnalyzer returns an analyzer that treats the RFC 1918 ranges as internal.
+func NewAnalyzer() (*Analyzer, error) {
+	nets := make([]core.NetworkUnpacker, 0, len(rfc1918))
+	for _, n := range rfc1918 {
+		net, err := core.NewNetwork(n[0], n[0], n[1], "RFC 1918")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create internal network: %v", err)
+		}
+		nets = append(nets, net)
+	}
+	return &Analyzer{
+		Internal:   core.NewAddressSet(nets...),
+		BroadPorts: defaultBroadPorts,
+	}, nil
+}
+
+// Finding is the exposure of a single permit rule.
+type Finding struct {
+	UID    string `json:"uid"`
+	Name   string `json:"name,omitempty"`
+	Number int    `json:"number"`
+	// Sources and Destinations are the number of addresses the rule matches.
+	Sources      uint64 `json:"sources"`
+	Destinations uint64 `json:"destinations"`
+	// Ports is the number of ports the rule matches, across every protocol.
+	// A protocol without ports, i.e. gre, counts as one.
+	Ports uint64 `json:"ports"`
+	// AnyService is true if the rule matches every port of a protocol.
+	AnyService bool `json:"any_service"`
+	// BroadRanges lists the port ranges wider than the analyzer's limit.
+	BroadRanges []string `json:"broad_ranges,omitempty"`
+	// Exposed lists the internal destinations reachable from the internet.
+	Exposed string `json:"exposed,omitempty"`
+	// Score goes from 0 (a single flow) to 100.
+	Score float64 `json:"score"`
+}
+
+// Internet returns true if the rule exposes internal addresses to the internet.
+func (f Finding) Internet() bool {
+	return f.Exposed != ""
+}
+
+// NodeReport holds the findings of a node, most permissive rule first.
+type NodeReport struct {
+	Node     string    `json:"node"`
+	Findings []Finding `json:"findings"`
+}
+
+// Report holds the findings of every node.
+type Report struct {
+	Nodes []NodeReport `json:"nodes"`
+}
+
+// Analyze scores the permit rules of every node.
+func (a *Analyzer) Analyze(nodes map[string]*node.Node) *Report {
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	report := &Report{Nodes: make([]NodeReport, 0, len(names))}
+	for _, name := range names {
+		n := nodes[name]
+		if n == nil || n.Rules == nil {
+			continue
+		}
+		report.Nodes = append(report.Nodes, NodeReport{
+			Node:     name,
+			Findings: a.Rules(n.Rules.All()),
+		})
+	}
+	return report
+}
+
+// Rules scores every permit rule and returns the findings ranked by score.
+// Deny rules are skipped.
+func (a *Analyzer) Rules(rules []*core.Rule) []Finding {
+	result := make([]Finding, 0, len(rules))
+	for _, r := range rules {
+		if !r.Action() {
+			continue
+		}
+		result = append(result, a.Rule(r))
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Score != result[j].Score {
+			return result[i].Score > result[j].Score
+		}
+		return result[i].Number < result[j].Number
+	})
+	return result
+}
+
+// Rule scores a single rule.
+//
+// Source, destination and port space each contribute to the score by the
+// log of their size, so a /16 scores halfway between a single host and any.
+// Rules exposing internal addresses to the internet get an extra penalty.
+func (a *Analyzer) Rule(r *core.Rule) Finding {
+	t := r.Traffic()
+	f := Finding{
+		UID:          r.UID(),
+		Name:         r.Name(),
+		Number:       r.Number(),
+		Sources:      t.Source.Size(),
+		Destinations: t.Destination.Size(),
+		BroadRanges:  make([]string, 0),
+	}
+
+	for proto, ports := range t.Service.ByProtocol() {
+		// Protocols without ports count as a single service.
+		if !core.HasPorts(proto) {
+			f.Ports++
+			continue
+		}
+		var count uint64
+		for _, p := range ports {
+			width := p.End - p.Start + 1
+			count += uint64(width)
+			if width > a.BroadPorts {
+				f.BroadRanges = append(f.BroadRanges, p.String())
+			}
+		}
+		if count >= portsPerProtocol {
+			f.AnyService = true
+		}
+		f.Ports += count
+	}
+	sort.Strings(f.BroadRanges)
+
+	// Anything outside the internal ranges is the internet.
+	public := t.Source.Difference(a.Internal)
+	if len(public) > 0 {
+		if exposed := t.Destination.Intersect(a.Internal); len(exposed) > 0 {
+			f.Exposed = exposed.String()
+		}
+	}
+
+	score := 35*scale(f.Sources, 1<<32) +
+		35*scale(f.Destinations, 1<<32) +
+		30*scale(f.Ports, 2*portsPerProtocol)
+	if f.Internet() {
+		score += exposurePenalty
+	}
+	f.Score = math.Round(math.Min(score, 100)*10) / 10
+	return f
+}
+
+// scale maps size onto 0-1 on a log scale, 1 meaning max or more.
+func scale(size, max uint64) float64 {
+	if size <= 1 {
+		return 0
+	}
+	return math.Min(math.Log2(float64(size))/math.Log2(float64(max)), 1)
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	for _, n := range r.Nodes {
+		fmt.Fprintf(&b, "%s:\n", n.Node)
+		for _, f := range n.Findings {
+			label := fmt.Sprintf("rule %d", f.Number)
+			if f.Name != "" {
+				label = fmt.Sprintf("%s (%s)", label, f.Name)
+			}
+			fmt.Fprintf(&b, "  %5.1f %s", f.Score, label)
+			if f.AnyService {
+				b.WriteString(", any service")
+			}
+			if len(f.BroadRanges) > 0 {
+				fmt.Fprintf(&b, ", broad ports %s", strings.Join(f.BroadRanges, ", "))
+			}
+			if f.Internet() {
+				fmt.Fprintf(&b, ", exposes %s to the internet", f.Exposed)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,125 @@
+package exposure
+
+import (
+	"testing"
+
+	"github.com/Neffats/wherecp/core"
+	"github.com/Neffats/wherecp/node"
+	rulestore "github.com/Neffats/wherecp/store/rule"
+)
+
+type testPuller struct{}
+
+func (tp *testPuller) PullRules() ([]*core.Rule, error) {
+	return make([]*core.Rule, 0), nil
+}
+
+func network(t *testing.T, name, addr, mask string) *core.Group {
+	t.Helper()
+	n, err := core.NewNetwork(name, addr, mask, "")
+	if err != nil {
+		t.Fatalf("failed to create network: %v", err)
+	}
+	grp := core.NewGroup(name, "")
+	if err := grp.Add(n); err != nil {
+		t.Fatalf("failed to add network to group: %v", err)
+	}
+	return grp
+}
+
+func ports(t *testing.T, name string, start, end uint) *core.PortGroup {
+	t.Helper()
+	pg := core.NewPortGroup(name, "")
+	if start == end {
+		p, err := core.NewPort(name, start, "tcp", "")
+		if err != nil {
+			t.Fatalf("failed to create port: %v", err)
+		}
+		if err := pg.Add(p); err != nil {
+			t.Fatalf("failed to add port to group: %v", err)
+		}
+		return pg
+	}
+	r, err := core.NewPortRange(name, start, end, "tcp", "")
+	if err != nil {
+		t.Fatalf("failed to create port range: %v", err)
+	}
+	if err := pg.Add(r); err != nil {
+		t.Fatalf("failed to add port range to group: %v", err)
+	}
+	return pg
+}
+
+func TestAnalyze(t *testing.T) {
+	any := network(t, "any", "0.0.0.0", "0.0.0.0")
+	public := network(t, "partner", "203.0.113.0", "255.255.255.0")
+	clients := network(t, "clients", "192.168.1.0", "255.255.255.0")
+	web := network(t, "web", "10.1.0.1", "255.255.255.255")
+	servers := network(t, "servers", "10.1.0.0", "255.255.0.0")
+
+	https := core.NewNamedRule("https", 1, any, web, ports(t, "https", 443, 443), true, "")
+	partner := core.NewNamedRule("partner", 2, public, servers, ports(t, "high", 1024, 65535), true, "")
+	internal := core.NewNamedRule("internal", 3, clients, servers, ports(t, "all", 0, 65535), true, "")
+	deny := core.NewNamedRule("deny", 4, any, any, ports(t, "all", 1, 65535), false, "")
+
+	store := rulestore.New(&testPuller{})
+	store.Rules = []*core.Rule{https, partner, internal, deny}
+
+	a, err := NewAnalyzer()
+	if err != nil {
+		t.Fatalf("failed to create analyzer: %v", err)
+	}
+	report := a.Analyze(map[string]*node.Node{"edge": {Rules: store}})
+	if len(report.Nodes) != 1 || report.Nodes[0].Node != "edge" {
+		t.Fatalf("expected a single node report, got: %+v", report.Nodes)
+	}
+
+	findings := report.Nodes[0].Findings
+	if len(findings) != 3 {
+		t.Fatalf("expected deny rule to be skipped, got: %+v", findings)
+	}
+	byName := make(map[string]Finding)
+	for _, f := range findings {
+		byName[f.Name] = f
+	}
+
+	if f := byName["https"]; f.Exposed != "10.1.0.1" || f.Sources != 1<<32 || f.Ports != 1 || f.AnyService {
+		t.Fatalf("expected https to expose the web server, got: %+v", f)
+	}
+	if f := byName["partner"]; f.Exposed != "10.1.0.0/16" || len(f.BroadRanges) != 1 || f.BroadRanges[0] != "tcp/1024-65535" {
+		t.Fatalf("expected partner to expose servers on a broad range, got: %+v", f)
+	}
+	if f := byName["internal"]; f.Internet() || !f.AnyService || f.Ports != 65536 {
+		t.Fatalf("expected internal to use any service without internet exposure, got: %+v", f)
+	}
+
+	for i := 1; i < len(findings); i++ {
+		if findings[i-1].Score < findings[i].Score {
+			t.Fatalf("findings not ranked by score: %+v", findings)
+		}
+	}
+	if findings[0].Name != "partner" {
+		t.Fatalf("expected partner to be the most permissive rule, got: %s", findings[0].Name)
+	}
+}
+
+func TestScale(t *testing.T) {
+	tests := []struct {
+		name string
+		size uint64
+		want float64
+	}{
+		{name: "Single", size: 1, want: 0},
+		{name: "Half", size: 1 << 16, want: 0.5},
+		{name: "Max", size: 1 << 32, want: 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := scale(tc.size, 1<<32)
+			if got != tc.want {
+				t.Fatalf("expected %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,366 @@
+package rulehandler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Neffats/wherecp/core"
+)
+
+// explainFn is a filterFn that also returns the reasons a rule matched.
+type explainFn func(*core.Rule) ([]Reason, bool, error)
+
+// Reason is one of the things that made a rule match a filter, i.e. a member
+// object along with the groups it is nested in.
+type Reason struct {
+	// Component of the rule the object is in, src, dst or svc. Empty for
+	// reasons that aren't about a member, i.e. the rule's action.
+	Component string
+	// Path holds the groups from the rule's component down to the object.
+	Path []string
+	// Object is what matched, i.e. network 10.1.2.0/24.
+	Object string
+}
+
+// String returns the reason as a path, i.e.
+// src group DMZ → group WebFarm → network 10.1.2.0/24.
+func (r Reason) String() string {
+	parts := make([]string, 0, len(r.Path)+1)
+	parts = append(parts, r.Path...)
+	parts = append(parts, r.Object)
+	if r.Component != "" {
+		parts[0] = r.Component + " " + parts[0]
+	}
+	return strings.Join(parts, " → ")
+}
+
+// Explanation is a rule that matched a filter and the reasons it did.
+type Explanation struct {
+	Rule    *core.Rule
+	Reasons []Reason
+}
+
+// String returns a line for each reason, i.e.
+// rule 12 → src group DMZ → group WebFarm → network 10.1.2.0/24.
+func (e Explanation) String() string {
+	lines := make([]string, 0, len(e.Reasons))
+	for _, r := range e.Reasons {
+		lines = append(lines, fmt.Sprintf("rule %d → %s", e.Rule.Number(), r))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Explain parses a filter expression like Parse, but the returned function
+// also says why each rule matched: which member objects of the rule matched
+// and the groups they are nested in. As with Parse, use ParseQuery and
+// Query.Explanations to apply the time of an asof filter.
+func Explain(input string) (explainFn, error) {
+	q, err := ParseQuery(input)
+	if err != nil {
+		return nil, err
+	}
+	return q.Explain, nil
+}
+
+// ExplainRules returns an explanation for every rule that matches, in order.
+func ExplainRules(rules []*core.Rule, explain explainFn) ([]Explanation, error) {
+	result := make([]Explanation, 0)
+	for _, r := range rules {
+		reasons, ok, err := explain(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to explain rule %d: %v", r.Number(), err)
+		}
+		if ok {
+			result = append(result, Explanation{Rule: r, Reasons: reasons})
+		}
+	}
+	return result, nil
+}
+
+func (b *boolOp) explain() explainFn {
+	args := make([]explainFn, 0, len(b.args))
+	for _, a := range b.args {
+		args = append(args, a.explain())
+	}
+	return func(r *core.Rule) ([]Reason, bool, error) {
+		reasons := make([]Reason, 0)
+		matched := b.all
+		for _, arg := range args {
+			argReasons, ok, err := arg(r)
+			if err != nil {
+				return nil, false, err
+			}
+			if !ok && b.all {
+				return nil, false, nil
+			}
+			if ok {
+				matched = true
+				reasons = append(reasons, argReasons...)
+			}
+		}
+		if !matched {
+			return nil, false, nil
+		}
+		return reasons, true, nil
+	}
+}
+
+func (n *notOp) explain() explainFn {
+	arg := n.arg.explain()
+	return func(r *core.Rule) ([]Reason, bool, error) {
+		_, ok, err := arg(r)
+		if err != nil || ok {
+			return nil, false, err
+		}
+		return []Reason{{Object: "negated filter didn't match"}}, true, nil
+	}
+}
+
+func (f *fnOp) explain() explainFn {
+	return func(r *core.Rule) ([]Reason, bool, error) {
+		ok, err := f.fn(r)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		return []Reason{{Object: f.desc}}, true, nil
+	}
+}
+
+func (h *hasOp) explain() explainFn {
+	filter := h.construct()
+	return func(r *core.Rule) ([]Reason, bool, error) {
+		ok, err := filter(r)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		reasons := make([]Reason, 0)
+		if !isService(h.objArg) {
+			match := func(member interface{}) bool {
+				return hasMember(member, h.objArg)
+			}
+			for _, c := range addressComponents(r, h.comp) {
+				reasons = append(reasons, explainGroup(c.name, c.group, false, match)...)
+			}
+			return reasons, true, nil
+		}
+		match := func(member interface{}) bool {
+			tmp := core.NewPortGroup("", "")
+			if err := tmp.Add(member); err != nil {
+				return false
+			}
+			has, err := tmp.HasObject(h.objArg)
+			return err == nil && has
+		}
+		return explainPortGroup(r.Port(), match), true, nil
+	}
+}
+
+func (c *containsOp) explain() explainFn {
+	filter := c.construct()
+	return func(r *core.Rule) ([]Reason, bool, error) {
+		ok, err := filter(r)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		switch obj := c.objArg.(type) {
+		case core.PortObject:
+			want := core.NewPortSet(obj)
+			match := func(member interface{}) bool {
+				p, ok := member.(core.PortObject)
+				return ok && len(core.NewPortSet(p).Intersect(want)) > 0
+			}
+			return explainPortGroup(r.Port(), match), true, nil
+		case core.NetworkUnpacker:
+			match := func(member interface{}) bool {
+				n, ok := member.(core.NetworkUnpacker)
+				_, isGroup := member.(*core.Group)
+				return ok && !isGroup && core.Overlap(n, obj)
+			}
+			reasons := make([]Reason, 0)
+			for _, comp := range addressComponents(r, c.comp) {
+				// With both components, only explain the ones that
+				// cover the object.
+				if comp.group == nil || (!c.overlap && !comp.group.Contains(obj)) || (c.overlap && !comp.group.Overlaps(obj)) {
+					continue
+				}
+				reasons = append(reasons, explainGroup(comp.name, comp.group, true, match)...)
+			}
+			return reasons, true, nil
+		}
+		return nil, true, nil
+	}
+}
+
+func isService(obj interface{}) bool {
+	switch obj.(type) {
+	case *core.Port, *core.PortRange, *core.Service, *core.PortGroup:
+		return true
+	}
+	return false
+}
+
+// hasMember returns true if member is obj as Has sees it. Groups are matched
+// by name.
+func hasMember(member, obj interface{}) bool {
+	if grp, ok := obj.(*core.Group); ok {
+		m, ok := member.(*core.Group)
+		return ok && m.Name() == grp.Name()
+	}
+	if _, ok := member.(*core.Group); ok {
+		return false
+	}
+	tmp := core.NewGroup("", "")
+	if err := tmp.Add(member); err != nil {
+		return false
+	}
+	has, err := tmp.HasObject(obj)
+	return err == nil && has
+}
+
+type component struct {
+	name  string
+	group *core.Group
+}
+
+// addressComponents returns the rule's address components named by comp,
+// both src and dst if it's empty.
+func addressComponents(r *core.Rule, comp string) []component {
+	switch comp {
+	case "src":
+		return []component{{"src", r.Source()}}
+	case "dst":
+		return []component{{"dst", r.Destination()}}
+	}
+	return []component{{"src", r.Source()}, {"dst", r.Destination()}}
+}
+
+// explainGroup returns a reason for every object nested in g that match
+// picks out, including g itself. If negation is set, negated groups are
+// reasons in themselves and their members aren't looked at.
+func explainGroup(comp string, g *core.Group, negation bool, match func(interface{}) bool) []Reason {
+	reasons := make([]Reason, 0)
+	var walk func(g *core.Group, path []string, seen map[*core.Group]bool)
+	walk = func(g *core.Group, path []string, seen map[*core.Group]bool) {
+		if g == nil || seen[g] {
+			return
+		}
+		seen[g] = true
+		if match(g) {
+			reasons = append(reasons, Reason{Component: comp, Path: path, Object: describe(g)})
+		}
+		inner := make([]string, len(path), len(path)+1)
+		copy(inner, path)
+		inner = append(inner, describe(g))
+		if negation && g.Negated() {
+			reasons = append(reasons, Reason{Component: comp, Path: inner, Object: "negated, everything except its members"})
+			return
+		}
+
+		members := make([]interface{}, 0)
+		for _, h := range g.Hosts() {
+			members = append(members, h)
+		}
+		for _, n := range g.Networks() {
+			members = append(members, n)
+		}
+		for _, rng := range g.Ranges() {
+			members = append(members, rng)
+		}
+		for _, f := range g.FQDNs() {
+			members = append(members, f)
+		}
+		for _, w := range g.Wildcards() {
+			members = append(members, w)
+		}
+		for _, rgn := range g.Regions() {
+			members = append(members, rgn)
+		}
+		for _, m := range members {
+			if match(m) {
+				reasons = append(reasons, Reason{Component: comp, Path: inner, Object: describe(m)})
+			}
+		}
+		for _, sub := range g.Groups() {
+			walk(sub, inner, seen)
+		}
+	}
+	walk(g, make([]string, 0), make(map[*core.Group]bool))
+	return reasons
+}
+
+// explainPortGroup returns a reason for every service nested in pg that
+// match picks out, including pg itself.
+func explainPortGroup(pg *core.PortGroup, match func(interface{}) bool) []Reason {
+	reasons := make([]Reason, 0)
+	var walk func(pg *core.PortGroup, path []string, seen map[*core.PortGroup]bool)
+	walk = func(pg *core.PortGroup, path []string, seen map[*core.PortGroup]bool) {
+		if pg == nil || seen[pg] {
+			return
+		}
+		seen[pg] = true
+		if match(pg) {
+			reasons = append(reasons, Reason{Component: "svc", Path: path, Object: describe(pg)})
+		}
+		inner := make([]string, len(path), len(path)+1)
+		copy(inner, path)
+		inner = append(inner, describe(pg))
+
+		members := make([]interface{}, 0)
+		for _, p := range pg.Ports() {
+			members = append(members, p)
+		}
+		for _, rng := range pg.Ranges() {
+			members = append(members, rng)
+		}
+		for _, s := range pg.Services() {
+			members = append(members, s)
+		}
+		for _, m := range members {
+			if match(m) {
+				reasons = append(reasons, Reason{Component: "svc", Path: inner, Object: describe(m)})
+			}
+		}
+		for _, sub := range pg.Groups() {
+			walk(sub, inner, seen)
+		}
+	}
+	walk(pg, make([]string, 0), make(map[*core.PortGroup]bool))
+	return reasons
+}
+
+// describe returns the kind of object and its value, followed by its name if
+// that's different, i.e. host 10.0.0.1 (web).
+func describe(obj interface{}) string {
+	var kind string
+	switch v := obj.(type) {
+	case *core.Group:
+		return "group " + v.Name()
+	case *core.PortGroup:
+		return "service group " + v.Name()
+	case *core.Host:
+		kind = "host"
+	case *core.Network:
+		kind = "network"
+	case *core.Range:
+		kind = "range"
+	case *core.FQDN:
+		kind = "fqdn"
+	case *core.Wildcard:
+		kind = "wildcard"
+	case *core.Region:
+		kind = "region"
+	case *core.Port:
+		kind = "port"
+	case *core.PortRange:
+		kind = "port range"
+	case *core.Service:
+		kind = "service"
+	default:
+		return fmt.Sprintf("%v", obj)
+	}
+	desc := fmt.Sprintf("%s %v", kind, obj)
+	if named, ok := obj.(interface{ Name() string }); ok && named.Name() != "" && named.Name() != fmt.Sprintf("%v", obj) {
+		desc += fmt.Sprintf(" (%s)", named.Name())
+	}
+	return desc
+}
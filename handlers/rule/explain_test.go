@@ -0,0 +1,74 @@
+package rulehandler
+
+import (
+	"testing"
+
+	"github.com/Neffats/wherecp/core"
+)
+
+func TestExplain(t *testing.T) {
+	web, err := core.NewNetwork("web-net", "10.1.2.0", "255.255.255.0", "")
+	if err != nil {
+		t.Fatalf("failed to create network: %v", err)
+	}
+	jump, err := core.NewHost("jump", "192.168.0.10", "")
+	if err != nil {
+		t.Fatalf("failed to create host: %v", err)
+	}
+	webFarm := core.NewGroup("WebFarm", "")
+	if err := webFarm.Add(web); err != nil {
+		t.Fatalf("failed to add network: %v", err)
+	}
+	dmz := core.NewGroup("DMZ", "")
+	if err := dmz.Add(webFarm); err != nil {
+		t.Fatalf("failed to add group: %v", err)
+	}
+	if err := dmz.Add(jump); err != nil {
+		t.Fatalf("failed to add host: %v", err)
+	}
+	https, err := core.NewPort("https", 443, "tcp", "")
+	if err != nil {
+		t.Fatalf("failed to create port: %v", err)
+	}
+	svc := core.NewPortGroup("web", "")
+	if err := svc.Add(https); err != nil {
+		t.Fatalf("failed to add port: %v", err)
+	}
+	rule := core.NewRule(12, dmz, core.NewGroup("dst", ""), svc, true, "")
+	other := core.NewRule(13, core.NewGroup("src", ""), core.NewGroup("dst", ""), core.NewPortGroup("none", ""), false, "")
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "Has", input: `(has "10.1.2.0/24" in src)`,
+			want: "rule 12 → src group DMZ → group WebFarm → network 10.1.2.0/24 (web-net)"},
+		{name: "Has group", input: `(has "WebFarm")`,
+			want: "rule 12 → src group DMZ → group WebFarm"},
+		{name: "Contains", input: `(contains "10.1.2.128/25" in src)`,
+			want: "rule 12 → src group DMZ → group WebFarm → network 10.1.2.0/24 (web-net)"},
+		{name: "Service", input: `(has "tcp/443")`,
+			want: "rule 12 → svc service group web → port tcp/443 (https)"},
+		{name: "And", input: `(and (action "permit") (has "192.168.0.10" in src))`,
+			want: "rule 12 → action permit\nrule 12 → src group DMZ → host 192.168.0.10 (jump)"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			explain, err := Explain(tc.input)
+			if err != nil {
+				t.Fatalf("failed to parse filter: %v", err)
+			}
+			got, err := ExplainRules([]*core.Rule{rule, other}, explain)
+			if err != nil {
+				t.Fatalf("failed to explain rules: %v", err)
+			}
+			if len(got) != 1 {
+				t.Fatalf("expected only rule 12 to match, got: %d rules", len(got))
+			}
+			if got[0].String() != tc.want {
+				t.Fatalf("want:\n%s\ngot:\n%s", tc.want, got[0])
+			}
+		})
+	}
+}
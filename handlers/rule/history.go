@@ -0,0 +1,101 @@
+package rulehandler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Neffats/wherecp/core"
+	rulestore "github.com/Neffats/wherecp/store/rule"
+)
+
+// Query is a parsed filter along with the point in time it applies to.
+type Query struct {
+	Filter filterFn
+	// Explain is the same filter, but also says why each rule matched.
+	Explain explainFn
+	// AsOf is the time the rules are taken from, zero for the current rules.
+	AsOf time.Time
+}
+
+// History is satisfied by rule stores that keep a snapshot of every pull,
+// i.e. rulestore.RuleStore.
+type History interface {
+	All() []*core.Rule
+	AsOf(t time.Time) ([]*core.Rule, error)
+	Snapshots() []*rulestore.Snapshot
+}
+
+// Run returns every rule of the store that matches the query, in order.
+func (q *Query) Run(store History) ([]*core.Rule, error) {
+	rules, err := q.Rules(store)
+	if err != nil {
+		return nil, err
+	}
+	return matching(rules, q.Filter)
+}
+
+// Explanations returns an explanation for every rule of the store that
+// matches the query, in order.
+func (q *Query) Explanations(store History) ([]Explanation, error) {
+	rules, err := q.Rules(store)
+	if err != nil {
+		return nil, err
+	}
+	return ExplainRules(rules, q.Explain)
+}
+
+// Rules returns the rules of the store the query applies to: the current
+// ones, or those of the snapshot at the query's time.
+func (q *Query) Rules(store History) ([]*core.Rule, error) {
+	if q.AsOf.IsZero() {
+		return store.All(), nil
+	}
+	rules, err := store.AsOf(q.AsOf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rules as of %s: %v", q.AsOf.Format(time.RFC3339), err)
+	}
+	return rules, nil
+}
+
+func matching(rules []*core.Rule, filter filterFn) ([]*core.Rule, error) {
+	result := make([]*core.Rule, 0)
+	for _, r := range rules {
+		ok, err := filter(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to filter rule %d: %v", r.Number(), err)
+		}
+		if ok {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+// Since scans the store's history and returns the time of the snapshot from
+// which filter has matched a rule in every snapshot up to the latest, i.e.
+// when rule 45 started allowing 10.0.0.0/8:
+//
+//	filter, _ := Parse(`(and (number "45") (action "permit") (contains "10.0.0.0/8" in src))`)
+//	since, ok, err := Since(store, filter)
+//
+// ok is false if the filter doesn't match any rule of the latest snapshot.
+// If the filter stopped and started matching again, the later start is
+// returned.
+func Since(store History, filter filterFn) (since time.Time, ok bool, err error) {
+	for _, s := range store.Snapshots() {
+		matched, err := matching(s.Rules(), filter)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("failed to check snapshot of %s: %v", s.Time().Format(time.RFC3339), err)
+		}
+		switch {
+		case len(matched) == 0:
+			ok = false
+		case !ok:
+			since, ok = s.Time(), true
+		}
+	}
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	return since, true, nil
+}
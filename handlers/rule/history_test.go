@@ -0,0 +1,87 @@
+package rulehandler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Neffats/wherecp/core"
+	rulestore "github.com/Neffats/wherecp/store/rule"
+)
+
+type testPuller struct{}
+
+func (tp *testPuller) PullRules() ([]*core.Rule, error) {
+	return make([]*core.Rule, 0), nil
+}
+
+func TestSince(t *testing.T) {
+	// rule returns rule 45 with the given source network.
+	rule := func(src string) *core.Rule {
+		network, err := core.NewNetwork("src", src, "255.0.0.0", "")
+		if err != nil {
+			t.Fatalf("failed to create network: %v", err)
+		}
+		grp := core.NewGroup("src", "")
+		if err := grp.Add(network); err != nil {
+			t.Fatalf("failed to add network: %v", err)
+		}
+		r := core.NewNamedRule("edge", 45, grp, core.NewGroup("dst", ""), core.NewPortGroup("svc", ""), true, "")
+		r.Identify("fw-edge-01")
+		return r
+	}
+
+	start := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	store := rulestore.New(&testPuller{})
+	for i, src := range []string{"10.0.0.0", "11.0.0.0", "10.0.0.0", "10.0.0.0"} {
+		if _, err := store.Record(start.AddDate(0, 0, i), []*core.Rule{rule(src)}); err != nil {
+			t.Fatalf("failed to record snapshot: %v", err)
+		}
+	}
+
+	filter, err := Parse(`(and (number "45") (action "permit") (contains "10.0.0.0/8" in src))`)
+	if err != nil {
+		t.Fatalf("failed to parse filter: %v", err)
+	}
+	since, ok, err := Since(store, filter)
+	if err != nil {
+		t.Fatalf("failed to scan history: %v", err)
+	}
+	if want := start.AddDate(0, 0, 2); !ok || !since.Equal(want) {
+		t.Fatalf("want: %s, got: %s (%t)", want, since, ok)
+	}
+
+	q, err := ParseQuery(`(asof "2024-03-02T12:00:00Z" (contains "10.0.0.0/8" in src))`)
+	if err != nil {
+		t.Fatalf("failed to parse query: %v", err)
+	}
+	matched, err := q.Run(store)
+	if err != nil {
+		t.Fatalf("failed to run query: %v", err)
+	}
+	if len(matched) != 0 {
+		t.Fatalf("expected no rules on 2024-03-02, got: %d", len(matched))
+	}
+
+	explained, err := q.Explanations(store)
+	if err != nil || len(explained) != 0 {
+		t.Fatalf("expected no explanations on 2024-03-02, got: %d, %v", len(explained), err)
+	}
+
+	// Parse accepts asof too, the filter itself matches the rule it's given.
+	filter, err = Parse(`(asof "2024-03-02T12:00:00Z" (action "permit"))`)
+	if err != nil {
+		t.Fatalf("failed to parse asof filter: %v", err)
+	}
+	if ok, err := filter(rule("10.0.0.0")); err != nil || !ok {
+		t.Fatalf("expected asof filter to match, got: %t, %v", ok, err)
+	}
+
+	for _, input := range []string{
+		`(and (asof "2024-03-02T12:00:00Z" (action "permit")))`,
+		`(asof "yesterday" (action "permit"))`,
+	} {
+		if _, err := Parse(input); err == nil {
+			t.Fatalf("expected error parsing %s", input)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Neffats/wherecp/core"
 )
@@ -12,23 +13,32 @@ import (
 const ()
 
 var (
-	hostPattern    = regexp.MustCompile("([1-2]?[0-9]?[0-9]\\.){3}([1-2]?[0-9]?[0-9])")
-	networkPattern = regexp.MustCompile("([1-2]?[0-9]?[0-9]\\.){3}([1-2]?[0-9]?[0-9])\\/([1-3]?[0-9])")
-	rangePattern   = regexp.MustCompile("([1-2]?[0-9]?[0-9]\\.){3}([1-2]?[0-9]?[0-9])\\-([1-2]?[0-9]?[0-9]\\.){3}([1-2]?[0-9]?[0-9])")
-	servicePattern = regexp.MustCompile("\\w*\\/\\d*")
+	hostPattern    = regexp.MustCompile("^([0-9]{1,3}\\.){3}([0-9]{1,3})$")
+	networkPattern = regexp.MustCompile("^([0-9]{1,3}\\.){3}([0-9]{1,3})\\/([0-9]{1,2})$")
+	rangePattern   = regexp.MustCompile("^([0-9]{1,3}\\.){3}([0-9]{1,3})\\-([0-9]{1,3}\\.){3}([0-9]{1,3})$")
+	servicePattern = regexp.MustCompile("^\\w*\\/\\d*$")
+	// ICMP messages, port ranges and IP protocol numbers, i.e. icmp/8:0, tcp/8000-8080, proto-47.
+	serviceObjectPattern = regexp.MustCompile("^(icmp(v6)?(\\/[0-9:]+)?|\\w+\\/\\d+\\-\\d+|proto-\\d+)$")
 )
 
 type constructer interface {
 	construct() filterFn
+	explain() explainFn
 }
 
 type Parser struct {
 	s *Scanner
+	// Depth of the keyword being parsed, 1 being the outermost.
+	depth int
+	// Time set by an asof keyword, zero if there wasn't one.
+	asOf time.Time
 }
 
 type boolOp struct {
 	fn   func(...filterFn) filterFn
 	args []constructer
+	// all is true for and, false for or.
+	all bool
 }
 
 func (b *boolOp) construct() filterFn {
@@ -39,49 +49,147 @@ func (b *boolOp) construct() filterFn {
 	return b.fn(constructedArgs...)
 }
 
+type notOp struct {
+	arg constructer
+}
+
+func (n *notOp) construct() filterFn {
+	return Not(n.arg.construct())
+}
+
 type hasOp struct {
 	fn      func(interface{}, func(*core.Rule) core.Haser) filterFn
 	objArg  interface{}
 	compArg func() func(*core.Rule) core.Haser
+	// comp is the component searched, empty for both src and dst.
+	comp string
 }
 
 func (h *hasOp) construct() filterFn {
 	return h.fn(h.objArg, h.compArg())
 }
 
+// containsOp matches rules whose source, destination or service covers the
+// whole of the object, not just rules that have the object as a member.
+type containsOp struct {
+	objArg interface{}
+	comp   string
+	// overlap matches rules that share any of the object instead.
+	overlap bool
+}
+
+func (c *containsOp) construct() filterFn {
+	switch obj := c.objArg.(type) {
+	case core.PortObject:
+		if c.overlap {
+			return OverlapsPort(obj)
+		}
+		return ContainsPort(obj)
+	case core.NetworkUnpacker:
+		src, dst := ContainsNet(obj, core.ContainsInSource()), ContainsNet(obj, core.ContainsInDestination())
+		if c.overlap {
+			src, dst = OverlapsNet(obj, core.OverlapsInSource()), OverlapsNet(obj, core.OverlapsInDestination())
+		}
+		switch c.comp {
+		case "src":
+			return src
+		case "dst":
+			return dst
+		}
+		return Or(src, dst)
+	}
+	return func(*core.Rule) (bool, error) {
+		return false, fmt.Errorf("unsupported object for contains: %T", c.objArg)
+	}
+}
+
+// fnOp wraps a filter that doesn't need constructing. desc says what it
+// matches for explanations, i.e. action permit.
+type fnOp struct {
+	fn   filterFn
+	desc string
+}
+
+func (f *fnOp) construct() filterFn {
+	return f.fn
+}
+
 func NewParser(s *Scanner) *Parser {
 	return &Parser{s: s}
 }
 
+// Parse turns a filter expression into a filterFn.
+//
+// Supported keywords:
+//
+//	(and <filter>...)                 every filter matches
+//	(or <filter>...)                  any filter matches
+//	(not <filter>)                    the filter doesn't match
+//	(has "<object>" [in src|dst])     the rule has the object as a member
+//	(contains "<object>" [in src|dst]) the rule covers the whole object
+//	(overlaps "<object>" [in src|dst]) the rule covers any of the object, i.e.
+//	                                  a rule to 10.1.0.0/16 overlaps 10.0.0.0/8
+//	(action "permit"|"deny")          the rule's action
+//	(comment "<text>")                the comment contains text, "" matches no comment
+//	(zone "<name>" [in src|dst])      the rule applies to the zone, src being the
+//	                                  ingress and dst the egress zone
+//	(app "<name>")                    the rule applies to the application
+//	(user "<name>")                   the rule applies to the user or user group
+//	(expires "<days>")                the rule's schedule has expired or expires
+//	                                  within days
+//	(number "<n>")                    the rule's number is n
+//	(asof "<time>" <filter>)          run the filter against the rules as they
+//	                                  were at time (RFC3339), only allowed around
+//	                                  the whole filter
+//
+// Objects are hosts, networks (10.0.0.0/8), ranges (10.0.0.1-10.0.0.9),
+// services (tcp/443, tcp/8000-8080, icmp/8:0, proto-47) or group names.
+//
+// A filterFn only sees the rule it is given, so the time of an asof filter
+// is left to whoever picks the rules. Callers that search a store should use
+// ParseQuery and Query.Run, which take the rules from the store's history.
 func Parse(input string) (filterFn, error) {
+	q, err := ParseQuery(input)
+	if err != nil {
+		return nil, err
+	}
+	return q.Filter, nil
+}
+
+// ParseQuery turns a filter expression, optionally wrapped in an asof
+// keyword, into a Query. See Parse for the supported keywords.
+func ParseQuery(input string) (*Query, error) {
 	s := NewScanner("Filter Scanner", input)
 	p := NewParser(s)
 
-	var filter constructer
-	var err error
-
 	tok := s.Next()
 	if tok.Type == EOF {
 		return nil, fmt.Errorf("EOF")
 	}
+	if tok.Type != LeftParen {
+		return nil, fmt.Errorf("expected an opening parenthesis but got: %s", tok.Value)
+	}
 
-	switch tok.Type {
-	case LeftParen:
-		filter, err = p.parseKeyword()
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse keyword: %v", err)
-		}
+	filter, err := p.parseKeyword()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse keyword: %v", err)
 	}
 	if filter == nil {
 		return nil, fmt.Errorf("parsed filter is nil")
 	}
-	finalFilter := filter.construct()
-	return finalFilter, nil
+	if tok := s.Next(); tok.Type != EOF {
+		return nil, fmt.Errorf("unexpected input after filter: %s", tok.Value)
+	}
+	return &Query{Filter: filter.construct(), Explain: filter.explain(), AsOf: p.asOf}, nil
 }
 
+// parseKeyword parses everything after an opening parenthesis up to and
+// including the matching closing parenthesis.
 func (p *Parser) parseKeyword() (constructer, error) {
 	var out constructer
 	var err error
+	p.depth++
+	defer func() { p.depth-- }()
 
 	tok := p.s.Next()
 	if tok.Type != Keyword {
@@ -90,27 +198,83 @@ func (p *Parser) parseKeyword() (constructer, error) {
 	keyword := tok.Value
 	switch keyword {
 	case "or":
-		out, err = p.parseOr()
+		out, err = p.parseBool(Or, false)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse OR: %v", err)
 		}
 	case "and":
-		/*out, err = p.parseAnd()
+		out, err = p.parseBool(And, true)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse AND: %v", err)
-		}*/
+		}
+	case "not":
+		out, err = p.parseNot()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse NOT: %v", err)
+		}
 	case "has":
 		out, err = p.parseHas()
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse HAS: %v", err)
 		}
+	case "contains":
+		out, err = p.parseContains(false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CONTAINS: %v", err)
+		}
+	case "overlaps":
+		out, err = p.parseContains(true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse OVERLAPS: %v", err)
+		}
+	case "action":
+		out, err = p.parseAction()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ACTION: %v", err)
+		}
+	case "comment":
+		out, err = p.parseComment()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse COMMENT: %v", err)
+		}
+	case "zone":
+		out, err = p.parseZone()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ZONE: %v", err)
+		}
+	case "app", "application":
+		out, err = p.parseName("app", App)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse APP: %v", err)
+		}
+	case "user":
+		out, err = p.parseName("user", User)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse USER: %v", err)
+		}
+	case "expires":
+		out, err = p.parseExpires()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse EXPIRES: %v", err)
+		}
+	case "number":
+		out, err = p.parseNumber()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse NUMBER: %v", err)
+		}
+	case "asof":
+		out, err = p.parseAsOf()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ASOF: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown keyword: %s", keyword)
 	}
 	return out, nil
 }
 
-func (p *Parser) parseOr() (constructer, error) {
-	var out *boolOp
-	out.fn = Or
+func (p *Parser) parseBool(fn func(...filterFn) filterFn, all bool) (constructer, error) {
+	out := &boolOp{fn: fn, all: all}
 	for {
 		tok := p.s.Next()
 		switch tok.Type {
@@ -121,12 +285,29 @@ func (p *Parser) parseOr() (constructer, error) {
 			}
 			out.args = append(out.args, arg)
 		case RightParen:
-			break
+			if len(out.args) == 0 {
+				return nil, fmt.Errorf("expected at least one parameter")
+			}
+			return out, nil
 		default:
 			return nil, fmt.Errorf("expected a parameter but got: %s", tok.Value)
 		}
 	}
-	return out, nil
+}
+
+func (p *Parser) parseNot() (constructer, error) {
+	tok := p.s.Next()
+	if tok.Type != LeftParen {
+		return nil, fmt.Errorf("expected a parameter but got: %s", tok.Value)
+	}
+	arg, err := p.parseKeyword()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse parameter: %v", err)
+	}
+	if err := p.expectClose(); err != nil {
+		return nil, err
+	}
+	return &notOp{arg: arg}, nil
 }
 
 func (p *Parser) parseHas() (constructer, error) {
@@ -138,87 +319,290 @@ func (p *Parser) parseHas() (constructer, error) {
 	}
 	out.objArg = arg
 
+	comp, err := p.parseIn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HAS parameter: %v", err)
+	}
+	out.comp = comp
 	switch arg.(type) {
 	case *core.Host, *core.Network, *core.Range, *core.Group:
-		comp, err := p.parseHasNetwork()
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse HAS parameter: %v", err)
+		if _, ok := arg.(*core.Group); ok {
+			// Groups are searched for by name.
+			out.fn = func(obj interface{}, comp func(*core.Rule) core.Haser) filterFn {
+				return HasGroup(obj.(*core.Group).Name(), comp)
+			}
+		}
+		switch comp {
+		case "src":
+			out.compArg = core.HasInSource
+		case "dst":
+			out.compArg = core.HasInDestination
+		case "":
+			out.compArg = core.HasInAny
+		default:
+			return nil, fmt.Errorf("can't search for an address in: %s", comp)
+		}
+	case *core.Port, *core.PortRange, *core.Service, *core.PortGroup:
+		if comp != "" && comp != "svc" {
+			return nil, fmt.Errorf("can't search for a service in: %s", comp)
 		}
-		out.compArg = comp
-	case *core.Port, *core.PortRange, *core.PortGroup:
 		out.compArg = core.HasInService
 	}
 	return &out, nil
+}
 
+// parseContains parses the parameters of contains, or of overlaps if overlap
+// is set.
+func (p *Parser) parseContains(overlap bool) (constructer, error) {
+	arg, err := p.parseHasParam()
+	if err != nil {
+		return nil, fmt.Errorf("error parsing parameter for CONTAINS: %v", err)
+	}
+	comp, err := p.parseIn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CONTAINS parameter: %v", err)
+	}
+	if _, ok := arg.(*core.Group); ok {
+		return nil, fmt.Errorf("CONTAINS needs an address or service, not a group name")
+	}
+	if _, ok := arg.(core.PortObject); ok && comp != "" && comp != "svc" {
+		return nil, fmt.Errorf("can't search for a service in: %s", comp)
+	}
+	return &containsOp{objArg: arg, comp: comp, overlap: overlap}, nil
+}
+
+func (p *Parser) parseAction() (constructer, error) {
+	value, err := p.parseQuoted()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectClose(); err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(value) {
+	case "permit", "allow", "accept":
+		return &fnOp{fn: Action(true), desc: "action permit"}, nil
+	case "deny", "drop", "reject":
+		return &fnOp{fn: Action(false), desc: "action deny"}, nil
+	}
+	return nil, fmt.Errorf("unknown action: %s", value)
 }
 
-func (p *Parser) parseHasNetwork() (func() func(*core.Rule) core.Haser, error) {
+func (p *Parser) parseComment() (constructer, error) {
+	value, err := p.parseQuoted()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectClose(); err != nil {
+		return nil, err
+	}
+	return &fnOp{fn: Comment(value), desc: fmt.Sprintf("comment %q", value)}, nil
+}
+
+func (p *Parser) parseZone() (constructer, error) {
+	name, err := p.parseQuoted()
+	if err != nil {
+		return nil, err
+	}
+	comp, err := p.parseIn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ZONE parameter: %v", err)
+	}
+	switch comp {
+	case "src":
+		return &fnOp{fn: Zone(name, true, false), desc: "from zone " + name}, nil
+	case "dst":
+		return &fnOp{fn: Zone(name, false, true), desc: "to zone " + name}, nil
+	case "":
+		return &fnOp{fn: Zone(name, true, true), desc: "zone " + name}, nil
+	}
+	return nil, fmt.Errorf("can't search for a zone in: %s", comp)
+}
+
+// parseName parses a keyword that takes a single quoted name.
+func (p *Parser) parseName(keyword string, fn func(name string) filterFn) (constructer, error) {
+	name, err := p.parseQuoted()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectClose(); err != nil {
+		return nil, err
+	}
+	return &fnOp{fn: fn(name), desc: fmt.Sprintf("%s %s", keyword, name)}, nil
+}
+
+func (p *Parser) parseExpires() (constructer, error) {
+	value, err := p.parseQuoted()
+	if err != nil {
+		return nil, err
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		return nil, fmt.Errorf("invalid number of days: %s", value)
+	}
+	if err := p.expectClose(); err != nil {
+		return nil, err
+	}
+	return &fnOp{fn: Expires(days, time.Now), desc: fmt.Sprintf("expires within %d days", days)}, nil
+}
+
+func (p *Parser) parseNumber() (constructer, error) {
+	value, err := p.parseQuoted()
+	if err != nil {
+		return nil, err
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule number: %s", value)
+	}
+	if err := p.expectClose(); err != nil {
+		return nil, err
+	}
+	return &fnOp{fn: Number(number), desc: fmt.Sprintf("number %d", number)}, nil
+}
+
+// parseAsOf parses the time of an asof keyword and the filter it wraps.
+func (p *Parser) parseAsOf() (constructer, error) {
+	if p.depth != 1 {
+		return nil, fmt.Errorf("asof must wrap the whole filter")
+	}
+	value, err := p.parseQuoted()
+	if err != nil {
+		return nil, err
+	}
+	asOf, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time, expected RFC3339: %s", value)
+	}
+	if tok := p.s.Next(); tok.Type != LeftParen {
+		return nil, fmt.Errorf("expected an opening parenthesis but got: %s", tok.Value)
+	}
+	filter, err := p.parseKeyword()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectClose(); err != nil {
+		return nil, err
+	}
+	p.asOf = asOf
+	return filter, nil
+}
+
+// parseIn parses the optional component a search is restricted to, along
+// with the closing parenthesis. Both "in src)" and "(in src))" are accepted.
+// Returns an empty string if no component was given.
+func (p *Parser) parseIn() (string, error) {
 	tok := p.s.Next()
+	nested := false
 	switch tok.Type {
+	case RightParen:
+		return "", nil
+	case LeftParen:
+		nested = true
+		tok = p.s.Next()
+		if tok.Type != Keyword || tok.Value != "in" {
+			return "", fmt.Errorf("expected IN keyword but got: %s", tok.Value)
+		}
 	case Parameter:
-		if tok.Value == "in" {
-			tok := p.s.Next()
-			if tok.Type != Parameter {
-				return nil, fmt.Errorf("expected parameter but got: %s", tok.Value)
-			}
-			switch tok.Value {
-			case "src", "source":
-				return core.HasInSource, nil
-			case "dst", "destintation":
-				return core.HasInDestination, nil
-			}
+		if tok.Value != "in" {
+			return "", fmt.Errorf("expected IN keyword or closing parameter but got: %s", tok.Value)
 		}
-	case RightParen:
-		return core.HasInAny, nil
+	default:
+		return "", fmt.Errorf("expected IN keyword or closing parameter but got: %s", tok.Value)
 	}
-	return nil, fmt.Errorf("expected IN keyword or closing parameter but got: %s",
-		tok.Value)
+
+	tok = p.s.Next()
+	if tok.Type != Parameter {
+		return "", fmt.Errorf("expected parameter but got: %s", tok.Value)
+	}
+	var comp string
+	switch tok.Value {
+	case "src", "source":
+		comp = "src"
+	case "dst", "destintation", "destination":
+		comp = "dst"
+	case "svc", "service":
+		comp = "svc"
+	default:
+		return "", fmt.Errorf("unknown rule component: %s", tok.Value)
+	}
+
+	if nested {
+		if err := p.expectClose(); err != nil {
+			return "", err
+		}
+	}
+	if err := p.expectClose(); err != nil {
+		return "", err
+	}
+	return comp, nil
 }
 
-func (p *Parser) parseHasParam() (interface{}, error) {
+func (p *Parser) expectClose() error {
 	tok := p.s.Next()
-	if tok.Type != Quote {
-		return nil, fmt.Errorf("expected an open quote but got: %s", tok.Value)
+	if tok.Type != RightParen {
+		return fmt.Errorf("expected closing parenthesis but got: %s", tok.Value)
 	}
+	return nil
+}
 
-	var obj interface{}
-	var err error
-
+// parseQuoted returns the value between a pair of quotes.
+func (p *Parser) parseQuoted() (string, error) {
+	tok := p.s.Next()
+	if tok.Type != Quote {
+		return "", fmt.Errorf("expected an open quote but got: %s", tok.Value)
+	}
 	tok = p.s.Next()
 	if tok.Type != Parameter {
-		return nil, fmt.Errorf("expected a parameter but got: %s", tok.Value)
+		return "", fmt.Errorf("expected a parameter but got: %s", tok.Value)
 	}
+	value := tok.Value
+	tok = p.s.Next()
+	if tok.Type != Quote {
+		return "", fmt.Errorf("missing closing quote after parameter")
+	}
+	return value, nil
+}
+
+func (p *Parser) parseHasParam() (interface{}, error) {
+	value, err := p.parseQuoted()
+	if err != nil {
+		return nil, err
+	}
+
+	var obj interface{}
 	switch {
-	case hostPattern.MatchString(tok.Value):
-		obj, err = p.parseHost(tok.Value)
+	case hostPattern.MatchString(value):
+		obj, err = p.parseHost(value)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse host: %v", err)
 		}
-	case networkPattern.MatchString(tok.Value):
-		obj, err = p.parseNetwork(tok.Value)
+	case networkPattern.MatchString(value):
+		obj, err = p.parseNetwork(value)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse network: %v", err)
 		}
-	case rangePattern.MatchString(tok.Value):
-		obj, err = p.parseRange(tok.Value)
+	case rangePattern.MatchString(value):
+		obj, err = p.parseRange(value)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse range: %v", err)
 		}
-	case servicePattern.MatchString(tok.Value):
-		obj, err = p.parseService(tok.Value)
+	case serviceObjectPattern.MatchString(value):
+		obj, err = core.ParseService("filter service", value, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse service: %v", err)
+		}
+	case servicePattern.MatchString(value):
+		obj, err = p.parseService(value)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse service: %v", err)
 		}
 	default:
-		obj, err = p.parseGroup(tok.Value)
+		obj, err = p.parseGroup(value)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse group: %v", err)
 		}
 	}
-	tok = p.s.Next()
-	if tok.Type != Quote {
-		return nil, fmt.Errorf("missing closing quote after parameter")
-	}
 	return obj, nil
 }
 
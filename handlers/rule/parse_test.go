@@ -2,6 +2,7 @@ package rulehandler
 
 import (
 	"testing"
+	"time"
 
 	"github.com/Neffats/wherecp/core"
 )
@@ -51,7 +52,7 @@ func TestParseHas(t *testing.T) {
 			want:  true,
 			err:   false},
 		{name: "Rule has without in",
-			input: "(has \"192.168.1.1\"))",
+			input: "(has \"192.168.1.1\")",
 			want:  true,
 			err:   false},
 		{name: "Object not in rule",
@@ -95,3 +96,294 @@ func TestParseHas(t *testing.T) {
 		})
 	}
 }
+
+func TestParseFilters(t *testing.T) {
+	// Setup the test data.
+	lower, err := core.NewNetwork("lower", "10.0.0.0", "255.255.255.128", "")
+	if err != nil {
+		t.Fatalf("failed to create lower network: %v", err)
+	}
+	upper, err := core.NewNetwork("upper", "10.0.0.128", "255.255.255.128", "")
+	if err != nil {
+		t.Fatalf("failed to create upper network: %v", err)
+	}
+	host2, err := core.NewHost("host2", "192.168.2.1", "host2")
+	if err != nil {
+		t.Fatalf("failed to create host2: %v", err)
+	}
+	rdp, err := core.NewPortRange("rdp", 3000, 4000, "tcp", "")
+	if err != nil {
+		t.Fatalf("failed to create rdp service: %v", err)
+	}
+
+	web := core.NewGroup("web", "web servers")
+	err = web.Add(upper)
+	if err != nil {
+		t.Fatalf("failed to add upper to web: %v", err)
+	}
+	src := core.NewGroup("src", "src")
+	err = src.Add(lower)
+	if err != nil {
+		t.Fatalf("failed to add lower to src: %v", err)
+	}
+	err = src.Add(web)
+	if err != nil {
+		t.Fatalf("failed to add web to src: %v", err)
+	}
+
+	dst := core.NewGroup("dst", "dst")
+	err = dst.Add(host2)
+	if err != nil {
+		t.Fatalf("failed to add host2 to dst: %v", err)
+	}
+
+	svc := core.NewPortGroup("svc", "svc")
+	err = svc.Add(rdp)
+	if err != nil {
+		t.Fatalf("failed to add rdp to svc: %v", err)
+	}
+
+	rule := core.NewRule(1, src, dst, svc, true, "Change 1234")
+
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+		err   bool
+	}{
+		{name: "Contains network in nested member",
+			input: "(contains \"10.0.0.192/26\" in src)",
+			want:  true},
+		{name: "Contains network split across members",
+			input: "(contains \"10.0.0.0/24\" in src)",
+			want:  false},
+		{name: "Has network split across members",
+			input: "(has \"10.0.0.0/24\" in src)",
+			want:  false},
+		{name: "Overlaps network split across members",
+			input: "(overlaps \"10.0.0.0/8\" in src)",
+			want:  true},
+		{name: "Overlaps network in other component",
+			input: "(overlaps \"10.0.0.0/8\" in dst)",
+			want:  false},
+		{name: "Overlaps service wider than range",
+			input: "(overlaps \"tcp/3389-5000\")",
+			want:  true},
+		{name: "Overlaps group name",
+			input: "(overlaps \"web\" in src)",
+			err:   true},
+		{name: "Contains service in range",
+			input: "(contains \"tcp/3389\")",
+			want:  true},
+		{name: "Contains in nested in",
+			input: "(contains \"192.168.2.1\" (in dst))",
+			want:  true},
+		{name: "Has nested group by name",
+			input: "(has \"web\" in src)",
+			want:  true},
+		{name: "And",
+			input: "(and (action \"permit\") (contains \"tcp/3389\") (contains \"10.0.0.0/25\" in src))",
+			want:  true},
+		{name: "And with false member",
+			input: "(and (action \"deny\") (contains \"tcp/3389\"))",
+			want:  false},
+		{name: "Or",
+			input: "(or (action \"deny\") (comment \"1234\"))",
+			want:  true},
+		{name: "Not",
+			input: "(not (comment \"\"))",
+			want:  true},
+		{name: "Unknown action",
+			input: "(action \"maybe\")",
+			err:   true},
+		{name: "Unclosed and",
+			input: "(and (action \"permit\")",
+			err:   true},
+		{name: "Empty or",
+			input: "(or)",
+			err:   true},
+		{name: "Trailing filter",
+			input: "(action \"permit\") (comment \"1234\")",
+			err:   true},
+		{name: "Trailing parenthesis",
+			input: "(action \"permit\"))",
+			err:   true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := Parse(tc.input)
+			if err != nil {
+				if tc.err {
+					return
+				}
+				t.Fatalf("got parse error when not expected: %v", err)
+			}
+			if tc.err {
+				t.Fatalf("expected error, but didn't get one")
+			}
+			got, err := filter(rule)
+			if err != nil {
+				t.Fatalf("got error from returned filterFn: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("got: %t\nwant: %t", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseZone(t *testing.T) {
+	any := core.NewGroup("any", "")
+	svc := core.NewPortGroup("svc", "")
+	zoned := core.NewRule(1, any, any, svc, true, "")
+	zoned.AddFromZone(core.NewZone("untrust", ""))
+	zoned.AddToZone(core.NewZone("dmz", ""))
+	unzoned := core.NewRule(2, any, any, svc, true, "")
+
+	tests := []struct {
+		name    string
+		input   string
+		zoned   bool
+		unzoned bool
+		err     bool
+	}{
+		{name: "From zone", input: "(zone \"untrust\" in src)", zoned: true, unzoned: true},
+		{name: "Wrong direction", input: "(zone \"untrust\" in dst)", zoned: false, unzoned: true},
+		{name: "Either direction", input: "(zone \"dmz\")", zoned: true, unzoned: true},
+		{name: "Other zone", input: "(zone \"trust\")", zoned: false, unzoned: true},
+		{name: "Service", input: "(zone \"dmz\" in svc)", err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := Parse(tc.input)
+			if err != nil {
+				if tc.err {
+					return
+				}
+				t.Fatalf("got parse error when not expected: %v", err)
+			}
+			if tc.err {
+				t.Fatalf("expected error, but didn't get one")
+			}
+			for _, c := range []struct {
+				rule *core.Rule
+				want bool
+			}{{zoned, tc.zoned}, {unzoned, tc.unzoned}} {
+				got, err := filter(c.rule)
+				if err != nil {
+					t.Fatalf("got error from returned filterFn: %v", err)
+				}
+				if got != c.want {
+					t.Fatalf("rule %d got: %t\nwant: %t", c.rule.Number(), got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseAppUser(t *testing.T) {
+	any := core.NewGroup("any", "")
+	svc := core.NewPortGroup("svc", "")
+	scoped := core.NewRule(1, any, any, svc, true, "")
+	scoped.AddApplication(core.NewApplication("ssh", ""))
+	contractors := core.NewUserGroup("contractors", "")
+	if err := contractors.Add(core.NewUser("jsmith", "")); err != nil {
+		t.Fatalf("failed to add user to group: %v", err)
+	}
+	scoped.AddUserGroup(contractors)
+	unscoped := core.NewRule(2, any, any, svc, true, "")
+
+	tests := []struct {
+		name     string
+		input    string
+		scoped   bool
+		unscoped bool
+		err      bool
+	}{
+		{name: "Application", input: "(app \"ssh\")", scoped: true, unscoped: true},
+		{name: "Other application", input: "(application \"ssl\")", scoped: false, unscoped: true},
+		{name: "User group", input: "(user \"contractors\")", scoped: true, unscoped: true},
+		{name: "Member of user group", input: "(user \"jsmith\")", scoped: true, unscoped: true},
+		{name: "Other user", input: "(user \"admin\")", scoped: false, unscoped: true},
+		{name: "Missing name", input: "(user)", err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := Parse(tc.input)
+			if err != nil {
+				if tc.err {
+					return
+				}
+				t.Fatalf("got parse error when not expected: %v", err)
+			}
+			if tc.err {
+				t.Fatalf("expected error, but didn't get one")
+			}
+			for _, c := range []struct {
+				rule *core.Rule
+				want bool
+			}{{scoped, tc.scoped}, {unscoped, tc.unscoped}} {
+				got, err := filter(c.rule)
+				if err != nil {
+					t.Fatalf("got error from returned filterFn: %v", err)
+				}
+				if got != c.want {
+					t.Fatalf("rule %d got: %t\nwant: %t", c.rule.Number(), got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestExpires(t *testing.T) {
+	any := core.NewGroup("any", "")
+	svc := core.NewPortGroup("svc", "")
+	temporary := core.NewRule(1, any, any, svc, true, "")
+	schedule, err := core.NewSchedule("until-june", "", "")
+	if err != nil {
+		t.Fatalf("failed to create schedule: %v", err)
+	}
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	if err := schedule.AddRange(start, end); err != nil {
+		t.Fatalf("failed to add range: %v", err)
+	}
+	temporary.SetSchedule(schedule)
+	permanent := core.NewRule(2, any, any, svc, true, "")
+
+	// The clock is read every time the filter runs, not when it is made.
+	now := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	filter := Expires(30, func() time.Time { return now })
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{name: "Expires later", now: time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC), want: false},
+		{name: "Expires within days", now: time.Date(2024, time.May, 15, 0, 0, 0, 0, time.UTC), want: true},
+		{name: "Expired", now: time.Date(2024, time.July, 1, 0, 0, 0, 0, time.UTC), want: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			now = tc.now
+			got, err := filter(temporary)
+			if err != nil {
+				t.Fatalf("got error from filterFn: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("got: %t\nwant: %t", got, tc.want)
+			}
+			if got, _ := filter(permanent); got {
+				t.Fatalf("expected rule without schedule not to match")
+			}
+		})
+	}
+
+	if _, err := Parse("(expires \"30\")"); err != nil {
+		t.Fatalf("failed to parse expires: %v", err)
+	}
+}
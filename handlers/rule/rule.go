@@ -2,6 +2,8 @@ package rulehandler
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/Neffats/wherecp/core"
 )
@@ -77,7 +79,110 @@ func Has(obj interface{}, comp func(*core.Rule) core.Haser) filterFn {
 	}
 }
 
-func ContainsNet(obj core.NetworkObject, comp func(*core.Rule) core.NetContainser) filterFn {
+// HasGroup returns a filterFn that is true if the specified component
+// is, or has nested anywhere inside it, a group called name.
+func HasGroup(name string, comp func(*core.Rule) core.Haser) filterFn {
+	return func(r *core.Rule) (bool, error) {
+		grp, ok := comp(r).(*core.Group)
+		if !ok {
+			return false, fmt.Errorf("rule component is not an address group")
+		}
+		return hasGroupNamed(grp, name, make(map[*core.Group]bool)), nil
+	}
+}
+
+func hasGroupNamed(grp *core.Group, name string, seen map[*core.Group]bool) bool {
+	if grp == nil || seen[grp] {
+		return false
+	}
+	seen[grp] = true
+	if grp.Name() == name {
+		return true
+	}
+	for _, g := range grp.Groups() {
+		if hasGroupNamed(g, name, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// Action returns a filterFn that is true if the rule's action matches,
+// true being permit and false deny.
+func Action(permit bool) filterFn {
+	return func(r *core.Rule) (bool, error) {
+		return r.Action() == permit, nil
+	}
+}
+
+// Comment returns a filterFn that is true if the rule's comment contains
+// text, ignoring case. An empty text matches rules without a comment.
+func Comment(text string) filterFn {
+	return func(r *core.Rule) (bool, error) {
+		if text == "" {
+			return strings.TrimSpace(r.Comment()) == "", nil
+		}
+		return strings.Contains(strings.ToLower(r.Comment()), strings.ToLower(text)), nil
+	}
+}
+
+// Zone returns a filterFn that is true if the rule applies to traffic
+// entering (from) or leaving (to) through the named zone. Rules that aren't
+// scoped to any zone apply to every zone.
+func Zone(name string, from, to bool) filterFn {
+	return func(r *core.Rule) (bool, error) {
+		if from && r.MatchFromZone(name) {
+			return true, nil
+		}
+		if to && r.MatchToZone(name) {
+			return true, nil
+		}
+		return false, nil
+	}
+}
+
+// App returns a filterFn that is true if the rule applies to the named
+// application. Rules that aren't scoped to any application apply to every
+// application.
+func App(name string) filterFn {
+	return func(r *core.Rule) (bool, error) {
+		return r.MatchApplication(name), nil
+	}
+}
+
+// User returns a filterFn that is true if the rule applies to the named user
+// or user group, directly or through one of its user groups. Rules that
+// aren't scoped to any users apply to every user.
+func User(name string) filterFn {
+	return func(r *core.Rule) (bool, error) {
+		return r.MatchUser(name), nil
+	}
+}
+
+// Expires returns a filterFn that is true if the rule's schedule has expired
+// or will expire within the given number of days. The time is read from now
+// every time the filter runs, so a filter that is kept around doesn't judge
+// expiry against the time it was created. Rules without an expiring schedule
+// never match.
+func Expires(days int, now func() time.Time) filterFn {
+	return func(r *core.Rule) (bool, error) {
+		if r.Schedule() == nil {
+			return false, nil
+		}
+		return r.Schedule().Expired(now().AddDate(0, 0, days)), nil
+	}
+}
+
+// Number returns a filterFn that is true if the rule's number is n.
+func Number(n int) filterFn {
+	return func(r *core.Rule) (bool, error) {
+		return r.Number() == n, nil
+	}
+}
+
+// ContainsNet takes an object and a comp function. The returned filterFn
+// returns true if the specified component covers every address of the object.
+func ContainsNet(obj core.NetworkUnpacker, comp func(*core.Rule) core.NetContainser) filterFn {
 	return func(r *core.Rule) (bool, error) {
 		component := comp(r)
 		contains := component.Contains(obj)
@@ -92,6 +197,20 @@ func ContainsPort(obj core.PortObject) filterFn {
 	}
 }
 
+// OverlapsNet matches rules whose component shares any address with obj.
+func OverlapsNet(obj core.NetworkUnpacker, comp func(*core.Rule) core.NetOverlapper) filterFn {
+	return func(r *core.Rule) (bool, error) {
+		return comp(r).Overlaps(obj), nil
+	}
+}
+
+// OverlapsPort matches rules whose service shares any port with obj.
+func OverlapsPort(obj core.PortObject) filterFn {
+	return func(r *core.Rule) (bool, error) {
+		return r.Port().Flatten().Overlaps(core.NewPortSet(obj)), nil
+	}
+}
+
 // (and (has "192.168.1.1" (in dest)) (has "8.8.8.8" (in src)) (contains "tcp/80" (in svc)))
 /*
 func CreateFilter(source string) filterFn {
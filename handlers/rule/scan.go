@@ -83,8 +83,10 @@ func (s *Scanner) emit(t TokenType) {
 	s.start = s.pos
 }
 
+// next returns the next rune of the input and moves past it, or eof once the
+// whole input, including its last rune, has been read.
 func (s *Scanner) next() rune {
-	if s.pos >= len(s.input)-1 {
+	if s.pos >= len(s.input) {
 		s.width = 0
 		return eof
 	}
@@ -143,8 +145,10 @@ func lexAny(s *Scanner) stateFn {
 	}
 }
 
+// lexKeyword reads a keyword, which ends at a space or at a parenthesis as
+// in "(or)".
 func lexKeyword(s *Scanner) stateFn {
-	for !isSpace(s.peek()) {
+	for !isSpace(s.peek()) && !isParen(s.peek()) {
 		if s.peek() == eof {
 			return nil
 		}
@@ -173,11 +177,11 @@ func lexParam(s *Scanner) stateFn {
 		s.emit(Parameter)
 		return lexAny
 	case r == ')':
+		s.emit(RightParen)
 		return lexAny
 	default:
 		return s.errorf("expected parameter but got: %U", r)
 	}
-	return s.errorf("reached unreachable space")
 }
 
 func lexInsideQuote(s *Scanner) stateFn {
@@ -37,7 +37,7 @@ func TestScanner(t *testing.T) {
 	for {
 		tok := s.Next()
 		if tok.Type == EOF {
-			if pos != len(expected)-1 {
+			if pos != len(expected) {
 				t.Fatalf("got EOF before end of test")
 			}
 			return
@@ -78,7 +78,7 @@ func TestScannerOther(t *testing.T) {
 	for {
 		tok := s.Next()
 		if tok.Type == EOF {
-			if pos != len(expected)-1 {
+			if pos != len(expected) {
 				t.Fatalf("got EOF before end of test")
 			}
 			return
@@ -105,7 +105,7 @@ func TestScanner3(t *testing.T) {
 	for {
 		tok := s.Next()
 		if tok.Type == EOF {
-			if pos != len(expected)-1 {
+			if pos != len(expected) {
 				t.Fatalf("got EOF before end of test")
 			}
 			return
@@ -116,3 +116,41 @@ func TestScanner3(t *testing.T) {
 		pos++
 	}
 }
+
+func TestScannerLastToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []Token
+	}{
+		{name: "Closing paren at end of input",
+			input: "(action \"permit\")",
+			want: []Token{
+				{LeftParen, "("},
+				{Keyword, "action"},
+				{Quote, "\""},
+				{Parameter, "permit"},
+				{Quote, "\""},
+				{RightParen, ")"},
+			}},
+		{name: "Keyword followed by paren",
+			input: "(or)",
+			want: []Token{
+				{LeftParen, "("},
+				{Keyword, "or"},
+				{RightParen, ")"},
+			}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewScanner(tc.name, tc.input)
+			got := make([]Token, 0)
+			for tok := s.Next(); tok.Type != EOF; tok = s.Next() {
+				got = append(got, tok)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("\nexpected: %v\ngot: %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+// Package inventory keeps the registry of every node wherecp knows about,
+// loaded from an inventory file, and lets queries be scoped to some of them.
+package inventory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Neffats/wherecp/network"
+	"github.com/Neffats/wherecp/node"
+)
+
+var (
+	ErrUnknownNode   = errors.New("unknown node")
+	ErrDuplicateNode = errors.New("node is already in the registry")
+	ErrUnknownVendor = errors.New("no puller for vendor")
+)
+
+// Entry describes a node in the inventory file.
+type Entry struct {
+	Name       string `json:"name"`
+	Vendor     string `json:"vendor"`
+	Management string `json:"management"`
+	// Credentials is a reference to the credentials, i.e. env:FW01_TOKEN,
+	// which the vendor's Factory resolves.
+	Credentials string            `json:"credentials,omitempty"`
+	Site        string            `json:"site,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// File is the layout of an inventory file:
+//
+//	{"nodes": [
+//		{"name": "fw-edge-01", "vendor": "panos", "management": "10.0.0.1",
+//		 "credentials": "env:FW_EDGE_01", "site": "datacenter-A", "tags": ["edge"]}
+//	]}
+type File struct {
+	Nodes []Entry `json:"nodes"`
+}
+
+// Factory returns a node with its stores set up to pull from the firewall an
+// entry describes, which should also set each store's Node to the entry's
+// name. The registry fills in the node's description from the entry
+// afterwards.
+type Factory func(e Entry) (*node.Node, error)
+
+// Registry holds every node by name.
+type Registry struct {
+	nodes   map[string]*node.Node
+	vendors map[string]Factory
+
+	mux sync.RWMutex
+}
+
+// New returns an empty registry.
+func New() *Registry {
+	return &Registry{
+		nodes:   make(map[string]*node.Node),
+		vendors: make(map[string]Factory),
+	}
+}
+
+// RegisterVendor sets the factory used for nodes of the vendor.
+func (r *Registry) RegisterVendor(vendor string, f Factory) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.vendors[vendor] = f
+}
+
+// Load adds every node of the inventory file at path. Nothing is added if any
+// of the nodes can't be.
+func (r *Registry) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read inventory: %v", err)
+	}
+	var f File
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("failed to parse inventory %s: %v", path, err)
+	}
+	return r.AddEntries(f.Nodes...)
+}
+
+// AddEntries builds a node for every entry with its vendor's factory and adds
+// them. Nothing is added if any of the entries can't be. The factories are
+// called without holding the registry's lock, so a factory that pulls from a
+// slow firewall doesn't hold up readers.
+func (r *Registry) AddEntries(entries ...Entry) error {
+	r.mux.RLock()
+	factories := make([]Factory, 0, len(entries))
+	err := r.check(entries, func(e Entry) error {
+		factory, ok := r.vendors[e.Vendor]
+		if !ok {
+			return fmt.Errorf("failed to add node %s: %w: %s", e.Name, ErrUnknownVendor, e.Vendor)
+		}
+		factories = append(factories, factory)
+		return nil
+	})
+	r.mux.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	nodes := make([]*node.Node, 0, len(entries))
+	for i, e := range entries {
+		n, err := factories[i](e)
+		if err != nil {
+			return fmt.Errorf("failed to set up node %s: %v", e.Name, err)
+		}
+		describe(n, e)
+		nodes = append(nodes, n)
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	// Nodes may have been added while the factories ran.
+	if err := r.check(entries, nil); err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		r.nodes[n.Name] = n
+	}
+	return nil
+}
+
+// check returns an error if any of the entries has no name or names a node
+// that's already in the registry or in another entry, calling each for every
+// entry otherwise. The registry's lock must be held.
+func (r *Registry) check(entries []Entry, each func(Entry) error) error {
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if e.Name == "" {
+			return fmt.Errorf("failed to add node: missing name")
+		}
+		if _, ok := r.nodes[e.Name]; ok || seen[e.Name] {
+			return fmt.Errorf("failed to add node %s: %w", e.Name, ErrDuplicateNode)
+		}
+		seen[e.Name] = true
+		if each == nil {
+			continue
+		}
+		if err := each(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// describe copies the description of the node from the entry.
+func describe(n *node.Node, e Entry) {
+	n.Name = e.Name
+	n.Vendor = e.Vendor
+	n.Management = e.Management
+	n.Credentials = e.Credentials
+	n.Site = e.Site
+	n.Tags = make([]string, len(e.Tags))
+	copy(n.Tags, e.Tags)
+	n.Metadata = make(map[string]string, len(e.Metadata))
+	for k, v := range e.Metadata {
+		n.Metadata[k] = v
+	}
+}
+
+// Add adds a node that has already been set up. It must have a name.
+func (r *Registry) Add(n *node.Node) error {
+	if n.Name == "" {
+		return fmt.Errorf("failed to add node: missing name")
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if _, ok := r.nodes[n.Name]; ok {
+		return fmt.Errorf("failed to add node %s: %w", n.Name, ErrDuplicateNode)
+	}
+	r.nodes[n.Name] = n
+	return nil
+}
+
+// Remove removes the named node from the registry.
+func (r *Registry) Remove(name string) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if _, ok := r.nodes[name]; !ok {
+		return fmt.Errorf("failed to remove node %s: %w", name, ErrUnknownNode)
+	}
+	delete(r.nodes, name)
+	return nil
+}
+
+// Node returns the node with the given name.
+func (r *Registry) Node(name string) (*node.Node, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	n, ok := r.nodes[name]
+	if !ok {
+		return nil, fmt.Errorf("failed to get node %s: %w", name, ErrUnknownNode)
+	}
+	return n, nil
+}
+
+// Nodes returns every node matched by sel, ordered by name.
+func (r *Registry) Nodes(sel Selector) []*node.Node {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	result := make([]*node.Node, 0, len(r.nodes))
+	for _, n := range r.nodes {
+		if sel.Match(n) {
+			result = append(result, n)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Topology returns the topology of every node matched by sel.
+func (r *Registry) Topology(sel Selector) *network.Topology {
+	nodes := make(map[string]*node.Node)
+	for _, n := range r.Nodes(sel) {
+		nodes[n.Name] = n
+	}
+	return network.NewTopology(nodes)
+}
+
+// Selector picks out nodes. Each of its fields that isn't empty must match,
+// which it does if the node has any of the values listed. The zero Selector
+// matches every node.
+type Selector struct {
+	Names   []string
+	Vendors []string
+	Sites   []string
+	Tags    []string
+}
+
+// ParseSelector parses a selector from a comma separated list of key=value
+// pairs, where the key is one of name, vendor, site or tag, i.e.
+// "site=datacenter-A,tag=edge". Repeated keys match any of their values.
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	if strings.TrimSpace(s) == "" {
+		return sel, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return Selector{}, fmt.Errorf("invalid selector, expected key=value: %s", pair)
+		}
+		switch kv[0] {
+		case "name":
+			sel.Names = append(sel.Names, kv[1])
+		case "vendor":
+			sel.Vendors = append(sel.Vendors, kv[1])
+		case "site":
+			sel.Sites = append(sel.Sites, kv[1])
+		case "tag":
+			sel.Tags = append(sel.Tags, kv[1])
+		default:
+			return Selector{}, fmt.Errorf("unknown selector key: %s", kv[0])
+		}
+	}
+	return sel, nil
+}
+
+// Match returns true if the selector picks out n.
+func (s Selector) Match(n *node.Node) bool {
+	if len(s.Names) > 0 && !anyOf(s.Names, n.Name) {
+		return false
+	}
+	if len(s.Vendors) > 0 && !anyOf(s.Vendors, n.Vendor) {
+		return false
+	}
+	if len(s.Sites) > 0 && !anyOf(s.Sites, n.Site) {
+		return false
+	}
+	if len(s.Tags) > 0 {
+		tagged := false
+		for _, t := range s.Tags {
+			if n.HasTag(t) {
+				tagged = true
+				break
+			}
+		}
+		if !tagged {
+			return false
+		}
+	}
+	return true
+}
+
+func anyOf(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package inventory
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Neffats/wherecp/core"
+	"github.com/Neffats/wherecp/node"
+	rulestore "github.com/Neffats/wherecp/store/rule"
+)
+
+// testPuller returns a permit and a deny rule.
+type testPuller struct{}
+
+func (tp *testPuller) PullRules() ([]*core.Rule, error) {
+	return []*core.Rule{
+		core.NewNamedRule("allow", 1, core.NewGroup("src", ""), core.NewGroup("dst", ""), core.NewPortGroup("svc", ""), true, ""),
+		core.NewNamedRule("deny", 2, core.NewGroup("src", ""), core.NewGroup("dst", ""), core.NewPortGroup("svc", ""), false, ""),
+	}, nil
+}
+
+func testFactory(e Entry) (*node.Node, error) {
+	rules := rulestore.New(&testPuller{})
+	rules.Node = e.Name
+	if err := rules.Init(); err != nil {
+		return nil, err
+	}
+	return &node.Node{Rules: rules}, nil
+}
+
+func TestRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	inventory := `{"nodes": [
+		{"name": "fw-edge-01", "vendor": "test", "management": "10.0.0.1", "credentials": "env:FW_EDGE_01", "site": "datacenter-A", "tags": ["edge"]},
+		{"name": "fw-core-01", "vendor": "test", "management": "10.0.0.2", "site": "datacenter-A", "tags": ["core"]},
+		{"name": "fw-edge-02", "vendor": "test", "management": "10.1.0.1", "site": "datacenter-B", "tags": ["edge"], "metadata": {"model": "PA-3220"}}
+	]}`
+	if err := os.WriteFile(path, []byte(inventory), 0o600); err != nil {
+		t.Fatalf("failed to write inventory: %v", err)
+	}
+
+	r := New()
+	if err := r.Load(path); !errors.Is(err, ErrUnknownVendor) {
+		t.Fatalf("Expected error: %v\nError received: %v", ErrUnknownVendor, err)
+	}
+	if len(r.Nodes(Selector{})) != 0 {
+		t.Fatalf("failed load added nodes")
+	}
+	r.RegisterVendor("test", testFactory)
+	if err := r.Load(path); err != nil {
+		t.Fatalf("failed to load inventory: %v", err)
+	}
+	if err := r.Load(path); !errors.Is(err, ErrDuplicateNode) {
+		t.Fatalf("Expected error: %v\nError received: %v", ErrDuplicateNode, err)
+	}
+
+	n, err := r.Node("fw-edge-02")
+	if err != nil {
+		t.Fatalf("failed to get node: %v", err)
+	}
+	if n.Site != "datacenter-B" || n.Management != "10.1.0.1" || n.Metadata["model"] != "PA-3220" {
+		t.Fatalf("node wasn't described from its entry: %+v", n)
+	}
+
+	tests := []struct {
+		name     string
+		selector string
+		want     []string
+	}{
+		{name: "Everything", selector: "", want: []string{"fw-core-01", "fw-edge-01", "fw-edge-02"}},
+		{name: "Site", selector: "site=datacenter-A", want: []string{"fw-core-01", "fw-edge-01"}},
+		{name: "Site and tag", selector: "site=datacenter-A,tag=edge", want: []string{"fw-edge-01"}},
+		{name: "Either tag", selector: "tag=edge,tag=core", want: []string{"fw-core-01", "fw-edge-01", "fw-edge-02"}},
+		{name: "No match", selector: "vendor=fortigate", want: []string{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sel, err := ParseSelector(tc.selector)
+			if err != nil {
+				t.Fatalf("failed to parse selector: %v", err)
+			}
+			got := make([]string, 0)
+			for _, n := range r.Nodes(sel) {
+				got = append(got, n.Name)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("want: %v, got: %v", tc.want, got)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("want: %v, got: %v", tc.want, got)
+				}
+			}
+		})
+	}
+	if _, err := ParseSelector("rack=12"); err == nil {
+		t.Fatalf("expected error for unknown selector key")
+	}
+
+	edge01, err := r.Node("fw-edge-01")
+	if err != nil {
+		t.Fatalf("failed to get node: %v", err)
+	}
+	if edge01.Rules.All()[0].UID() == n.Rules.All()[0].UID() {
+		t.Fatalf("rules on different nodes got the same UID")
+	}
+}
+
+func TestAddEntriesSlowFactory(t *testing.T) {
+	r := New()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	r.RegisterVendor("slow", func(e Entry) (*node.Node, error) {
+		close(started)
+		<-release
+		return testFactory(e)
+	})
+	r.RegisterVendor("test", testFactory)
+	if err := r.AddEntries(Entry{Name: "fw-core-01", Vendor: "test"}); err != nil {
+		t.Fatalf("failed to add node: %v", err)
+	}
+
+	added := make(chan error, 1)
+	go func() {
+		added <- r.AddEntries(Entry{Name: "fw-slow-01", Vendor: "slow"}, Entry{Name: "fw-slow-02", Vendor: "test"})
+	}()
+	<-started
+
+	listed := make(chan int, 1)
+	go func() {
+		listed <- len(r.Nodes(Selector{}))
+	}()
+	select {
+	case got := <-listed:
+		if got != 1 {
+			t.Fatalf("expected only the node added before, got: %d", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("listing nodes was blocked by a slow factory")
+	}
+	// A node added while the factory runs is still caught as a duplicate.
+	if err := r.AddEntries(Entry{Name: "fw-slow-02", Vendor: "test"}); err != nil {
+		t.Fatalf("failed to add node: %v", err)
+	}
+
+	close(release)
+	if err := <-added; !errors.Is(err, ErrDuplicateNode) {
+		t.Fatalf("Expected error: %v\nError received: %v", ErrDuplicateNode, err)
+	}
+	if _, err := r.Node("fw-slow-01"); !errors.Is(err, ErrUnknownNode) {
+		t.Fatalf("failed add left a node behind: %v", err)
+	}
+}
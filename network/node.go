@@ -1,6 +1,33 @@
+// Package network models how nodes are connected to each other and the path
+// traffic takes through them.
 package network
 
+import (
+	"github.com/Neffats/wherecp/node"
+)
+
+// Node is a node in the topology graph.
 type Node struct {
-	Type int
-	
+	*node.Node
+	// Links holds every node that shares a subnet with this one.
+	Links []Link
+}
+
+// Link is a connection to a neighbouring node over a shared subnet.
+type Link struct {
+	Node   *Node
+	Subnet node.Subnet
+}
+
+// Neighbours returns the names of the nodes directly connected to this one.
+func (n *Node) Neighbours() []string {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(n.Links))
+	for _, l := range n.Links {
+		if !seen[l.Node.Name] {
+			seen[l.Node.Name] = true
+			result = append(result, l.Node.Name)
+		}
+	}
+	return result
 }
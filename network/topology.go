@@ -0,0 +1,163 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Neffats/ip"
+	"github.com/Neffats/wherecp/core"
+	"github.com/Neffats/wherecp/node"
+)
+
+var (
+	ErrUnknownNode  = errors.New("unknown node")
+	ErrNoSourceNode = errors.New("no node is connected to the source")
+	ErrNoRoute      = errors.New("no route to destination")
+	ErrRoutingLoop  = errors.New("routing loop")
+)
+
+// Topology is the graph of nodes, linked together by the subnets they share.
+type Topology struct {
+	nodes map[string]*Node
+	names []string
+}
+
+// NewTopology links every pair of nodes that have a connected network in common.
+// nodes is keyed by the name of each node.
+func NewTopology(nodes map[string]*node.Node) *Topology {
+	t := &Topology{
+		nodes: make(map[string]*Node, len(nodes)),
+		names: make([]string, 0, len(nodes)),
+	}
+	for name, n := range nodes {
+		t.nodes[name] = &Node{Node: n, Links: make([]Link, 0)}
+		t.names = append(t.names, name)
+	}
+	sort.Strings(t.names)
+
+	for i, a := range t.names {
+		for _, b := range t.names[i+1:] {
+			na, nb := t.nodes[a], t.nodes[b]
+			for _, sa := range na.ConnectedNetworks {
+				for _, sb := range nb.ConnectedNetworks {
+					if !sa.Match(sb) {
+						continue
+					}
+					na.Links = append(na.Links, Link{Node: nb, Subnet: sb})
+					nb.Links = append(nb.Links, Link{Node: na, Subnet: sa})
+				}
+			}
+		}
+	}
+	return t
+}
+
+// Node returns the topology node with the given name.
+func (t *Topology) Node(name string) (*Node, error) {
+	n, ok := t.nodes[name]
+	if !ok {
+		return nil, fmt.Errorf("failed to get node %s: %w", name, ErrUnknownNode)
+	}
+	return n, nil
+}
+
+// Nodes returns every node, ordered by name.
+func (t *Topology) Nodes() []*Node {
+	result := make([]*Node, 0, len(t.names))
+	for _, name := range t.names {
+		result = append(result, t.nodes[name])
+	}
+	return result
+}
+
+// Path returns the names of the nodes that traffic from src to dst passes
+// through, in order. The first node is the one connected to the source, and
+// each following node is the next hop picked by longest prefix match. The
+// path ends at the node connected to the destination, or at the last known
+// node when the next hop is outside the topology.
+//
+// Every node applies its NAT rules before picking a route, so a path to a
+// public address follows the internal address it is translated to. Path
+// only knows about addresses, so NAT rules that match on a service are
+// never applied.
+func (t *Topology) Path(src, dst string) ([]string, error) {
+	srcAddr, err := ip.NewAddress(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source: %v", err)
+	}
+	dstAddr, err := ip.NewAddress(dst)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination: %v", err)
+	}
+
+	current := t.attached(srcAddr)
+	if current == nil {
+		return nil, fmt.Errorf("failed to find path from %s: %w", src, ErrNoSourceNode)
+	}
+	path := []string{current.Name}
+	visited := map[string]bool{current.Name: true}
+	flow := core.Flow{Source: *srcAddr, Destination: *dstAddr, Protocol: -1}
+	for {
+		flow, _ = core.ApplyNAT(current.NATRules(), flow)
+		dstAddr := &flow.Destination
+		if current.Connected(dstAddr) {
+			return path, nil
+		}
+		route, ok := current.Lookup(dstAddr)
+		if !ok {
+			return path, fmt.Errorf("failed to route %s on %s: %w", dst, current.Name, ErrNoRoute)
+		}
+		if route.NextHop == nil {
+			return path, nil
+		}
+		next := current.nextHop(route.NextHop)
+		if next == nil {
+			return path, nil
+		}
+		if visited[next.Name] {
+			return append(path, next.Name), fmt.Errorf("failed to route %s: %w", dst, ErrRoutingLoop)
+		}
+		visited[next.Name] = true
+		path = append(path, next.Name)
+		current = next
+	}
+}
+
+// attached returns the node with the most specific connected network
+// containing addr, nil if there is none.
+func (t *Topology) attached(addr *ip.Address) *Node {
+	var best *Node
+	prefix := -1
+	for _, name := range t.names {
+		n := t.nodes[name]
+		for _, s := range n.ConnectedNetworks {
+			if s.Contains(addr) && s.Prefix() > prefix {
+				best = n
+				prefix = s.Prefix()
+			}
+		}
+	}
+	return best
+}
+
+// nextHop returns the neighbour that owns addr. If no neighbour has addr as
+// its local address, the only neighbour on the subnet containing addr is used.
+func (n *Node) nextHop(addr *ip.Address) *Node {
+	candidates := make([]*Node, 0)
+	for _, l := range n.Links {
+		if !l.Subnet.Contains(addr) {
+			continue
+		}
+		if l.Subnet.Local != nil && *l.Subnet.Local == *addr {
+			return l.Node
+		}
+		if l.Subnet.Local == nil {
+			candidates = append(candidates, l.Node)
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package network
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Neffats/ip"
+	"github.com/Neffats/wherecp/core"
+	"github.com/Neffats/wherecp/node"
+	natstore "github.com/Neffats/wherecp/store/nat"
+)
+
+func address(t *testing.T, addr string) *ip.Address {
+	t.Helper()
+	a, err := ip.NewAddress(addr)
+	if err != nil {
+		t.Fatalf("failed to create address: %v", err)
+	}
+	return a
+}
+
+func subnet(t *testing.T, addr, mask, local string) node.Subnet {
+	t.Helper()
+	s := node.Subnet{Address: address(t, addr), Mask: address(t, mask)}
+	if local != "" {
+		s.Local = address(t, local)
+	}
+	return s
+}
+
+func route(t *testing.T, addr, mask, nextHop string) node.Route {
+	t.Helper()
+	return node.Route{Destination: subnet(t, addr, mask, ""), NextHop: address(t, nextHop)}
+}
+
+func TestPath(t *testing.T) {
+	real, err := core.NewNetwork("real", "10.2.0.10", "255.255.255.255", "")
+	if err != nil {
+		t.Fatalf("failed to create network: %v", err)
+	}
+	mapped, err := core.NewNetwork("mapped", "203.0.113.10", "255.255.255.255", "")
+	if err != nil {
+		t.Fatalf("failed to create network: %v", err)
+	}
+	realGrp, mappedGrp := core.NewGroup("real", ""), core.NewGroup("mapped", "")
+	if err := realGrp.Add(real); err != nil {
+		t.Fatalf("failed to add network to group: %v", err)
+	}
+	if err := mappedGrp.Add(mapped); err != nil {
+		t.Fatalf("failed to add network to group: %v", err)
+	}
+	static, err := core.NewStaticNAT("server", 1, realGrp, mappedGrp, "")
+	if err != nil {
+		t.Fatalf("failed to create static nat: %v", err)
+	}
+	nat := natstore.New(nil)
+	if err := nat.Insert(static); err != nil {
+		t.Fatalf("failed to insert nat rule: %v", err)
+	}
+
+	nodes := map[string]*node.Node{
+		"fw1": {
+			Name: "fw1",
+			ConnectedNetworks: []node.Subnet{
+				subnet(t, "10.0.0.0", "255.255.255.0", "10.0.0.1"),
+				subnet(t, "172.16.0.0", "255.255.255.252", "172.16.0.1"),
+			},
+			Routes: []node.Route{
+				route(t, "0.0.0.0", "0.0.0.0", "172.16.0.2"),
+			},
+		},
+		"fw2": {
+			Name: "fw2",
+			ConnectedNetworks: []node.Subnet{
+				subnet(t, "172.16.0.0", "255.255.255.252", "172.16.0.2"),
+				subnet(t, "172.16.1.0", "255.255.255.252", "172.16.1.1"),
+			},
+			Routes: []node.Route{
+				route(t, "0.0.0.0", "0.0.0.0", "203.0.113.1"),
+				route(t, "10.0.0.0", "255.0.0.0", "172.16.0.1"),
+				route(t, "10.2.0.0", "255.255.0.0", "172.16.1.2"),
+				route(t, "10.9.0.0", "255.255.0.0", "172.16.1.2"),
+			},
+			NAT: nat,
+		},
+		"fw3": {
+			Name: "fw3",
+			ConnectedNetworks: []node.Subnet{
+				subnet(t, "172.16.1.0", "255.255.255.252", "172.16.1.2"),
+				subnet(t, "10.2.0.0", "255.255.0.0", ""),
+			},
+			Routes: []node.Route{
+				route(t, "0.0.0.0", "0.0.0.0", "172.16.1.1"),
+			},
+		},
+	}
+	topo := NewTopology(nodes)
+
+	fw2, err := topo.Node("fw2")
+	if err != nil {
+		t.Fatalf("got error when not expected: %v", err)
+	}
+	if got := fw2.Neighbours(); len(got) != 2 || got[0] != "fw1" || got[1] != "fw3" {
+		t.Fatalf("expected fw2 to neighbour fw1 and fw3, got: %v", got)
+	}
+
+	tests := []struct {
+		name string
+		src  string
+		dst  string
+		want []string
+		err  error
+	}{
+		{name: "Across every node", src: "10.0.0.5", dst: "10.2.3.4", want: []string{"fw1", "fw2", "fw3"}},
+		{name: "Return path", src: "10.2.3.4", dst: "10.0.0.5", want: []string{"fw3", "fw2", "fw1"}},
+		{name: "Leaves topology", src: "10.0.0.5", dst: "8.8.8.8", want: []string{"fw1", "fw2"}},
+		{name: "Translated destination", src: "10.0.0.5", dst: "203.0.113.10", want: []string{"fw1", "fw2", "fw3"}},
+		{name: "Same node", src: "10.0.0.5", dst: "10.0.0.6", want: []string{"fw1"}},
+		{name: "Routing loop", src: "10.2.0.1", dst: "10.9.0.1", want: []string{"fw3", "fw2", "fw3"}, err: ErrRoutingLoop},
+		{name: "Unknown source", src: "192.168.5.5", dst: "10.0.0.5", err: ErrNoSourceNode},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := topo.Path(tc.src, tc.dst)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("expected error %v, got: %v", tc.err, err)
+				}
+			} else if err != nil {
+				t.Fatalf("got error when not expected: %v", err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("expected path %v, got: %v", tc.want, got)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("expected path %v, got: %v", tc.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	n := &node.Node{
+		ConnectedNetworks: []node.Subnet{subnet(t, "10.0.0.0", "255.255.255.0", "")},
+		Routes: []node.Route{
+			route(t, "0.0.0.0", "0.0.0.0", "192.168.0.1"),
+			route(t, "10.0.0.0", "255.255.255.0", "192.168.0.2"),
+			{Destination: subnet(t, "10.1.0.0", "255.255.0.0", ""), NextHop: address(t, "192.168.0.3"), Metric: 10},
+			{Destination: subnet(t, "10.1.0.0", "255.255.0.0", ""), NextHop: address(t, "192.168.0.4"), Metric: 5},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		addr    string
+		nextHop string
+	}{
+		{name: "Default route", addr: "8.8.8.8", nextHop: "192.168.0.1"},
+		{name: "Connected wins tie", addr: "10.0.0.1", nextHop: ""},
+		{name: "Lowest metric", addr: "10.1.2.3", nextHop: "192.168.0.4"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := n.Lookup(address(t, tc.addr))
+			if !ok {
+				t.Fatalf("expected a route")
+			}
+			if tc.nextHop == "" {
+				if got.NextHop != nil {
+					t.Fatalf("expected connected route, got next hop")
+				}
+				return
+			}
+			if got.NextHop == nil || *got.NextHop != *address(t, tc.nextHop) {
+				t.Fatalf("expected next hop %s", tc.nextHop)
+			}
+		})
+	}
+}
@@ -1,19 +1,175 @@
 package node
 
 import (
+	"math/bits"
+	"sort"
+
 	"github.com/Neffats/ip"
+	"github.com/Neffats/wherecp/core"
 )
 
 type Subnet struct {
 	Address *ip.Address
 	Mask    *ip.Address
+	// Local is the node's own address on the subnet, nil if unknown.
+	// Used to work out which node a next hop belongs to.
+	Local *ip.Address
+	// Interface is the node's interface on the subnet, nil if unknown.
+	Interface *core.Interface
+}
+
+// Contains returns true if addr is in the subnet.
+func (s Subnet) Contains(addr *ip.Address) bool {
+	return *ip.Mask(addr, s.Mask) == *ip.Mask(s.Address, s.Mask)
+}
+
+// Prefix returns the length of the subnet's mask i.e. 24 for 255.255.255.0.
+func (s Subnet) Prefix() int {
+	return bits.OnesCount32(uint32(*s.Mask))
+}
+
+// Match returns true if both subnets cover the same addresses.
+func (s Subnet) Match(other Subnet) bool {
+	return *s.Mask == *other.Mask && s.Contains(other.Address)
+}
+
+// Route is a single entry of a node's routing table.
+// A nil NextHop means the destination is directly reachable.
+type Route struct {
+	Destination Subnet
+	NextHop     *ip.Address
+	// Metric breaks ties between routes of the same prefix length, lowest wins.
+	Metric int
 }
 
 type Node struct {
+	// Name identifies the node, i.e. its hostname. It is also used to give
+	// the objects pulled from the node stable UIDs.
+	Name string
+	// Vendor is the kind of firewall, i.e. panos or fortigate, which picks
+	// the pullers used to fetch its configuration.
+	Vendor string
+	// Management is the address the node's configuration is pulled from.
+	Management string
+	// Credentials refers to where the credentials for Management are kept,
+	// i.e. env:FW01_TOKEN. It never holds the credentials themselves.
+	Credentials string
+	// Site is where the node is, i.e. datacenter-A.
+	Site string
+	Tags []string
+	// Metadata holds anything else known about the node.
+	Metadata map[string]string
+
 	ConnectedNetworks []Subnet
+	// Routes holds the static routes of the node, including the default
+	// route (0.0.0.0/0).
+	Routes []Route
 	Rules RuleStorer
+	// NAT holds the node's NAT rules, nil if the node doesn't do NAT.
+	NAT NATStorer
+	// Zones holds the node's security zones, empty if the node isn't zone based.
+	Zones []*core.Zone
 	Hosts HostStorer
 	Networks NetworkStorer
 	Ranges RangeStorer
 	Groups GroupStorer
 }
+
+// HasTag returns true if the node is tagged with tag.
+func (n *Node) HasTag(tag string) bool {
+	for _, t := range n.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Connected returns true if addr is in one of the node's connected networks.
+func (n *Node) Connected(addr *ip.Address) bool {
+	for _, s := range n.ConnectedNetworks {
+		if s.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns the route the node uses to reach addr, using longest prefix
+// match. Connected networks are treated as routes without a next hop and win
+// over static routes of the same length.
+func (n *Node) Lookup(addr *ip.Address) (Route, bool) {
+	candidates := make([]Route, 0)
+	for _, s := range n.ConnectedNetworks {
+		if s.Contains(addr) {
+			candidates = append(candidates, Route{Destination: s})
+		}
+	}
+	for _, r := range n.Routes {
+		if r.Destination.Contains(addr) {
+			candidates = append(candidates, r)
+		}
+	}
+	if len(candidates) == 0 {
+		return Route{}, false
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		pi, pj := candidates[i].Destination.Prefix(), candidates[j].Destination.Prefix()
+		if pi != pj {
+			return pi > pj
+		}
+		ci, cj := candidates[i].NextHop == nil, candidates[j].NextHop == nil
+		if ci != cj {
+			return ci
+		}
+		return candidates[i].Metric < candidates[j].Metric
+	})
+	return candidates[0], true
+}
+
+// NATRules returns the node's NAT rules ordered by rule number.
+func (n *Node) NATRules() []*core.NATRule {
+	if n.NAT == nil {
+		return nil
+	}
+	rules := n.NAT.All()
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].Number() < rules[j].Number()
+	})
+	return rules
+}
+
+// Interface returns the interface the node sends traffic for addr out of,
+// nil if it isn't known. For traffic arriving from addr this is the ingress
+// interface, assuming routing is symmetric.
+func (n *Node) Interface(addr *ip.Address) *core.Interface {
+	route, ok := n.Lookup(addr)
+	if !ok {
+		return nil
+	}
+	if route.NextHop == nil {
+		return route.Destination.Interface
+	}
+	// The next hop is reached through one of the connected networks.
+	for _, s := range n.ConnectedNetworks {
+		if s.Contains(route.NextHop) {
+			return s.Interface
+		}
+	}
+	return nil
+}
+
+// Zone returns the zone of the interface the node uses for addr, nil if it
+// isn't known.
+func (n *Node) Zone(addr *ip.Address) *core.Zone {
+	iface := n.Interface(addr)
+	if iface == nil {
+		return nil
+	}
+	for _, z := range n.Zones {
+		if z.HasInterface(iface) {
+			return z
+		}
+	}
+	return nil
+}
@@ -73,3 +73,15 @@ type GroupStorer interface {
 	// Returns a list of groups that have the given name.
 	WithName(name string) ([]*core.Group, error)
 }
+
+type NATStorer interface {
+	// Return every NAT rule.
+	All() []*core.NATRule
+	Insert(rule *core.NATRule) error
+	// Return a NAT rule from it's uid.
+	Get(uid string) (*core.NATRule, error)
+	// Update a NAT rule.
+	Update(uid string, updated *core.NATRule) error
+	// Delete a NAT rule from the store.
+	Delete(uid string) error
+}
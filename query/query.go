@@ -0,0 +1,198 @@
+// Package query runs rule filters across many nodes at once.
+package query
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Neffats/wherecp/core"
+	"github.com/Neffats/wherecp/handlers/rule"
+	"github.com/Neffats/wherecp/inventory"
+	"github.com/Neffats/wherecp/node"
+)
+
+// Filter decides whether a rule matches, i.e. one returned by
+// rulehandler.Parse.
+type Filter func(*core.Rule) (bool, error)
+
+// Match is a rule that matched a filter.
+type Match struct {
+	Number int
+	Name   string
+	UID    string
+	Rule   *core.Rule
+}
+
+// NodeResult holds the rules of a node that matched, in the node's order.
+// If the node couldn't be searched, i.e. it timed out, Err says why and
+// Matches holds whatever was found before it stopped.
+type NodeResult struct {
+	Node     string
+	Matches  []Match
+	Err      error
+	Duration time.Duration
+}
+
+// Executor runs filters against the nodes of a registry concurrently.
+type Executor struct {
+	Registry *inventory.Registry
+	// Timeout of the search of a single node, zero for none.
+	Timeout time.Duration
+	// Concurrency is the most nodes searched at once, zero for no limit.
+	Concurrency int
+}
+
+// Stream searches every node matched by sel and sends the result of each on
+// the returned channel as soon as it is done, so the results arrive in no
+// particular order. The channel is closed once every node has a result.
+// Cancelling ctx stops the nodes still being searched, which report ctx's
+// error.
+func (e *Executor) Stream(ctx context.Context, sel inventory.Selector, filter Filter) <-chan NodeResult {
+	return e.stream(ctx, sel, filter, time.Time{})
+}
+
+// StreamQuery is Stream for a parsed query. If the query has an asof time,
+// each node's rules are taken from its store's history at that time, and
+// nodes whose store doesn't keep a history report an error.
+func (e *Executor) StreamQuery(ctx context.Context, sel inventory.Selector, q *rulehandler.Query) <-chan NodeResult {
+	return e.stream(ctx, sel, Filter(q.Filter), q.AsOf)
+}
+
+func (e *Executor) stream(ctx context.Context, sel inventory.Selector, filter Filter, asOf time.Time) <-chan NodeResult {
+	nodes := e.Registry.Nodes(sel)
+	results := make(chan NodeResult, len(nodes))
+
+	limit := e.Concurrency
+	if limit <= 0 || limit > len(nodes) {
+		limit = len(nodes)
+	}
+	slots := make(chan struct{}, limit)
+
+	var wg sync.WaitGroup
+	for _, n := range nodes {
+		wg.Add(1)
+		go func(n *node.Node) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				results <- NodeResult{Node: n.Name, Matches: make([]Match, 0), Err: fmt.Errorf("failed to search %s: %w", n.Name, ctx.Err())}
+				return
+			}
+			results <- e.search(ctx, n, filter, asOf)
+		}(n)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// Run searches every node matched by sel and returns their results ordered by
+// node name. The error is only set if ctx was done before every node finished.
+func (e *Executor) Run(ctx context.Context, sel inventory.Selector, filter Filter) ([]NodeResult, error) {
+	return collect(ctx, e.Stream(ctx, sel, filter))
+}
+
+// RunQuery is Run for a parsed query, see StreamQuery.
+func (e *Executor) RunQuery(ctx context.Context, sel inventory.Selector, q *rulehandler.Query) ([]NodeResult, error) {
+	return collect(ctx, e.StreamQuery(ctx, sel, q))
+}
+
+func collect(ctx context.Context, results <-chan NodeResult) ([]NodeResult, error) {
+	result := make([]NodeResult, 0)
+	for r := range results {
+		result = append(result, r)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Node < result[j].Node
+	})
+	return result, ctx.Err()
+}
+
+// history is satisfied by rule stores that keep a snapshot of every pull,
+// i.e. rulestore.RuleStore.
+type history interface {
+	AsOf(t time.Time) ([]*core.Rule, error)
+}
+
+// rules returns the node's rules, as they were at asOf unless it's zero.
+func rules(n *node.Node, asOf time.Time) ([]*core.Rule, error) {
+	if asOf.IsZero() {
+		return n.Rules.All(), nil
+	}
+	h, ok := n.Rules.(history)
+	if !ok {
+		return nil, fmt.Errorf("rule store doesn't keep a history")
+	}
+	r, err := h.AsOf(asOf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rules as of %s: %v", asOf.Format(time.RFC3339), err)
+	}
+	return r, nil
+}
+
+// search runs the filter against a single node, giving up once ctx or the
+// executor's timeout is done.
+func (e *Executor) search(ctx context.Context, n *node.Node, filter Filter, asOf time.Time) NodeResult {
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
+	start := time.Now()
+
+	// The store is read in its own goroutine so that a store that is slow
+	// to answer can't hold up the result past the timeout.
+	var mux sync.Mutex
+	partial := make([]Match, 0)
+	done := make(chan error, 1)
+	go func() {
+		if n.Rules == nil {
+			done <- nil
+			return
+		}
+		all, err := rules(n, asOf)
+		if err != nil {
+			done <- err
+			return
+		}
+		for _, r := range all {
+			if ctx.Err() != nil {
+				return
+			}
+			ok, err := filter(r)
+			if err != nil {
+				done <- fmt.Errorf("failed to filter rule %d: %v", r.Number(), err)
+				return
+			}
+			if ok {
+				mux.Lock()
+				partial = append(partial, Match{Number: r.Number(), Name: r.Name(), UID: r.UID(), Rule: r})
+				mux.Unlock()
+			}
+		}
+		done <- nil
+	}()
+
+	result := NodeResult{Node: n.Name}
+	select {
+	case <-ctx.Done():
+		result.Err = fmt.Errorf("failed to search %s: %w", n.Name, ctx.Err())
+	case err := <-done:
+		if err != nil {
+			result.Err = fmt.Errorf("failed to search %s: %v", n.Name, err)
+		}
+	}
+	mux.Lock()
+	result.Matches = make([]Match, len(partial))
+	copy(result.Matches, partial)
+	mux.Unlock()
+	result.Duration = time.Since(start)
+	return result
+}
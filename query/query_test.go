@@ -0,0 +1,119 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Neffats/wherecp/core"
+	"github.com/Neffats/wherecp/handlers/rule"
+	"github.com/Neffats/wherecp/inventory"
+	"github.com/Neffats/wherecp/node"
+	rulestore "github.com/Neffats/wherecp/store/rule"
+)
+
+// slowStore is a rule store that doesn't answer until release is closed.
+type slowStore struct {
+	*rulestore.RuleStore
+	release chan struct{}
+}
+
+func (s *slowStore) All() []*core.Rule {
+	<-s.release
+	return s.RuleStore.All()
+}
+
+func TestExecutor(t *testing.T) {
+	rule := func(name string, number int, action bool) *core.Rule {
+		return core.NewNamedRule(name, number, core.NewGroup("src", ""), core.NewGroup("dst", ""), core.NewPortGroup("svc", ""), action, "")
+	}
+	store := func(rules ...*core.Rule) *rulestore.RuleStore {
+		return &rulestore.RuleStore{Rules: rules}
+	}
+	slow := &slowStore{RuleStore: store(rule("deny-all", 1, false)), release: make(chan struct{})}
+	defer close(slow.release)
+
+	registry := inventory.New()
+	for _, n := range []*node.Node{
+		{Name: "fw-edge-01", Site: "datacenter-A", Rules: store(rule("web", 10, true), rule("cleanup", 20, false))},
+		{Name: "fw-edge-02", Site: "datacenter-A", Rules: store(rule("ssh", 5, true))},
+		{Name: "fw-edge-03", Site: "datacenter-A", Rules: slow},
+		{Name: "fw-lab-01", Site: "lab", Rules: store(rule("any", 1, true))},
+	} {
+		if err := registry.Add(n); err != nil {
+			t.Fatalf("failed to add node: %v", err)
+		}
+	}
+
+	permits := func(r *core.Rule) (bool, error) { return r.Action(), nil }
+	e := &Executor{Registry: registry, Timeout: 20 * time.Millisecond, Concurrency: 2}
+	results, err := e.Run(context.Background(), inventory.Selector{Sites: []string{"datacenter-A"}}, permits)
+	if err != nil {
+		t.Fatalf("failed to run query: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected results for 3 nodes, got: %d", len(results))
+	}
+	if r := results[0]; r.Node != "fw-edge-01" || r.Err != nil || len(r.Matches) != 1 || r.Matches[0].Number != 10 || r.Matches[0].Name != "web" {
+		t.Fatalf("unexpected result for fw-edge-01: %+v", r)
+	}
+	if r := results[1]; r.Node != "fw-edge-02" || len(r.Matches) != 1 || r.Matches[0].Name != "ssh" {
+		t.Fatalf("unexpected result for fw-edge-02: %+v", r)
+	}
+	if r := results[2]; r.Node != "fw-edge-03" || !errors.Is(r.Err, context.DeadlineExceeded) {
+		t.Fatalf("expected fw-edge-03 to time out, got: %+v", r)
+	}
+
+	// A cancelled query still reports every node.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err = (&Executor{Registry: registry}).Run(ctx, inventory.Selector{}, permits)
+	if !errors.Is(err, context.Canceled) || len(results) != 4 {
+		t.Fatalf("expected 4 results and a cancelled error, got %d results and: %v", len(results), err)
+	}
+
+	failing := func(r *core.Rule) (bool, error) { return false, errors.New("bad filter") }
+	for r := range e.Stream(context.Background(), inventory.Selector{Names: []string{"fw-lab-01"}}, failing) {
+		if r.Err == nil {
+			t.Fatalf("expected the filter's error for %s", r.Node)
+		}
+	}
+}
+
+func TestExecutorQuery(t *testing.T) {
+	rule := func(name string, action bool) *core.Rule {
+		return core.NewNamedRule(name, 10, core.NewGroup("src", ""), core.NewGroup("dst", ""), core.NewPortGroup("svc", ""), action, "")
+	}
+	march := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	recorded := rulestore.New(nil)
+	if _, err := recorded.Record(march, []*core.Rule{rule("web", true)}); err != nil {
+		t.Fatalf("failed to record snapshot: %v", err)
+	}
+	recorded.Rules = []*core.Rule{rule("web", false)}
+
+	registry := inventory.New()
+	for _, n := range []*node.Node{
+		{Name: "fw-edge-01", Rules: recorded},
+		{Name: "fw-edge-02", Rules: &rulestore.RuleStore{Rules: []*core.Rule{rule("ssh", true)}}},
+	} {
+		if err := registry.Add(n); err != nil {
+			t.Fatalf("failed to add node: %v", err)
+		}
+	}
+
+	q, err := rulehandler.ParseQuery(`(asof "2024-03-02T00:00:00Z" (action "permit"))`)
+	if err != nil {
+		t.Fatalf("failed to parse query: %v", err)
+	}
+	results, err := (&Executor{Registry: registry}).RunQuery(context.Background(), inventory.Selector{}, q)
+	if err != nil {
+		t.Fatalf("failed to run query: %v", err)
+	}
+	if r := results[0]; r.Err != nil || len(r.Matches) != 1 || r.Matches[0].Name != "web" {
+		t.Fatalf("expected the rule as it was in March on fw-edge-01, got: %+v", r)
+	}
+	if r := results[1]; r.Err == nil {
+		t.Fatalf("expected fw-edge-02 without history to fail, got: %+v", r)
+	}
+}
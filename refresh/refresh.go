@@ -0,0 +1,239 @@
+// Package refresh keeps stores up to date by periodically pulling from their
+// sources in the background.
+package refresh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/Neffats/wherecp/node"
+)
+
+var (
+	ErrUnknownNode   = errors.New("unknown node")
+	ErrDuplicateNode = errors.New("node is already scheduled")
+	ErrNoStores      = errors.New("node has no stores that can be refreshed")
+)
+
+// Refresher is satisfied by stores that can pull from their source again,
+// i.e. rulestore.RuleStore. Refresh must leave the store as it was if ctx is
+// done before the pull finishes.
+type Refresher interface {
+	Refresh(ctx context.Context) error
+}
+
+// Config controls how often a node is refreshed.
+type Config struct {
+	// Interval between the end of one refresh and the start of the next.
+	Interval time.Duration
+	// Jitter is the most that is randomly added to each wait, to stop nodes
+	// with the same interval from all being pulled at once.
+	Jitter time.Duration
+	// Timeout of a single refresh of all the node's stores, zero for none.
+	Timeout time.Duration
+	// After a failed refresh the next one is tried after Backoff, doubling
+	// with every failure in a row up to MaxBackoff. A zero Backoff retries
+	// after Interval.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// wait returns how long to wait before the next refresh after the given
+// number of failures in a row. jitter returns a random duration below its
+// argument.
+func (c Config) wait(failures int, jitter func(time.Duration) time.Duration) time.Duration {
+	d := c.Interval
+	if failures > 0 && c.Backoff > 0 {
+		d = c.Backoff
+		for i := 1; i < failures && (c.MaxBackoff <= 0 || d < c.MaxBackoff); i++ {
+			d *= 2
+		}
+		if c.MaxBackoff > 0 && d > c.MaxBackoff {
+			d = c.MaxBackoff
+		}
+	}
+	if c.Jitter > 0 {
+		d += jitter(c.Jitter)
+	}
+	return d
+}
+
+// Status is the outcome of the refreshes of a node so far.
+type Status struct {
+	// LastSuccess is when every store of the node was last refreshed,
+	// zero if that hasn't happened yet.
+	LastSuccess time.Time
+	// LastError is the error of the last failed refresh, and LastFailure
+	// when it happened.
+	LastError   error
+	LastFailure time.Time
+	// Failures is the number of refreshes that have failed in a row.
+	Failures int
+}
+
+type job struct {
+	name   string
+	config Config
+	stores []Refresher
+	status Status
+}
+
+// Scheduler refreshes the stores of a number of nodes, each on its own
+// interval. Stores swap newly pulled objects in themselves, so readers keep
+// seeing the old objects until a pull has finished.
+type Scheduler struct {
+	jobs map[string]*job
+	wg   sync.WaitGroup
+
+	// rand isn't safe for concurrent use, so has its own lock.
+	rand    *rand.Rand
+	randMux sync.Mutex
+
+	mux sync.RWMutex
+}
+
+// New returns a Scheduler without any nodes.
+func New() *Scheduler {
+	return &Scheduler{
+		jobs: make(map[string]*job),
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Add schedules the refresh of stores under the node's name. It must be called
+// before Start.
+func (s *Scheduler) Add(name string, config Config, stores ...Refresher) error {
+	if config.Interval <= 0 {
+		return fmt.Errorf("failed to schedule %s: interval must be positive", name)
+	}
+	if len(stores) == 0 {
+		return fmt.Errorf("failed to schedule %s: %w", name, ErrNoStores)
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, ok := s.jobs[name]; ok {
+		return fmt.Errorf("failed to schedule %s: %w", name, ErrDuplicateNode)
+	}
+	s.jobs[name] = &job{name: name, config: config, stores: stores}
+	return nil
+}
+
+// AddNode schedules the refresh of every store of n that is a Refresher.
+func (s *Scheduler) AddNode(name string, n *node.Node, config Config) error {
+	stores := make([]Refresher, 0)
+	for _, store := range []interface{}{n.Rules, n.NAT, n.Hosts, n.Networks, n.Ranges, n.Groups} {
+		if r, ok := store.(Refresher); ok {
+			stores = append(stores, r)
+		}
+	}
+	return s.Add(name, config, stores...)
+}
+
+// Start refreshes every node in the background, each straight away and then
+// after every wait, until ctx is done. Use Wait to wait for them to stop.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.run(ctx, j)
+	}
+}
+
+// Wait blocks until every node has stopped being refreshed after the context
+// passed to Start is done.
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Scheduler) run(ctx context.Context, j *job) {
+	defer s.wg.Done()
+	for {
+		s.refresh(ctx, j)
+
+		s.mux.RLock()
+		failures := j.status.Failures
+		s.mux.RUnlock()
+		wait := j.config.wait(failures, s.jitter)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// jitter returns a random duration in [0, max).
+func (s *Scheduler) jitter(max time.Duration) time.Duration {
+	s.randMux.Lock()
+	defer s.randMux.Unlock()
+	return time.Duration(s.rand.Int63n(int64(max)))
+}
+
+// RefreshNow refreshes the named node straight away, outside of its schedule.
+func (s *Scheduler) RefreshNow(ctx context.Context, name string) error {
+	s.mux.RLock()
+	j, ok := s.jobs[name]
+	s.mux.RUnlock()
+	if !ok {
+		return fmt.Errorf("failed to refresh %s: %w", name, ErrUnknownNode)
+	}
+	return s.refresh(ctx, j)
+}
+
+// refresh refreshes every store of a node and records the outcome. A store
+// failing doesn't stop the others from being refreshed.
+func (s *Scheduler) refresh(ctx context.Context, j *job) error {
+	if j.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.config.Timeout)
+		defer cancel()
+	}
+	var failed error
+	for _, store := range j.stores {
+		if err := store.Refresh(ctx); err != nil && failed == nil {
+			failed = fmt.Errorf("failed to refresh %s: %w", j.name, err)
+		}
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if failed != nil {
+		j.status.LastError = failed
+		j.status.LastFailure = time.Now()
+		j.status.Failures++
+		return failed
+	}
+	j.status.LastSuccess = time.Now()
+	j.status.Failures = 0
+	return nil
+}
+
+// Status returns the outcome of the named node's refreshes so far.
+func (s *Scheduler) Status(name string) (Status, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	j, ok := s.jobs[name]
+	if !ok {
+		return Status{}, fmt.Errorf("failed to get status of %s: %w", name, ErrUnknownNode)
+	}
+	return j.status, nil
+}
+
+// Statuses returns the status of every node by name.
+func (s *Scheduler) Statuses() map[string]Status {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	result := make(map[string]Status, len(s.jobs))
+	for name, j := range s.jobs {
+		result[name] = j.status
+	}
+	return result
+}
@@ -0,0 +1,146 @@
+package refresh
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Neffats/wherecp/core"
+	hoststore "github.com/Neffats/wherecp/store/host"
+)
+
+// testPuller returns a single host, blocking until release is closed if it's
+// set, or fails if err is set.
+type testPuller struct {
+	release chan struct{}
+	err     error
+
+	mux   sync.Mutex
+	pulls int
+}
+
+func (tp *testPuller) PullHosts() ([]*core.Host, error) {
+	if tp.release != nil {
+		<-tp.release
+	}
+	tp.mux.Lock()
+	tp.pulls++
+	tp.mux.Unlock()
+	if tp.err != nil {
+		return nil, tp.err
+	}
+	h, err := core.NewHost("web", "10.0.0.1", "")
+	return []*core.Host{h}, err
+}
+
+func (tp *testPuller) count() int {
+	tp.mux.Lock()
+	defer tp.mux.Unlock()
+	return tp.pulls
+}
+
+func TestConfigWait(t *testing.T) {
+	noJitter := func(time.Duration) time.Duration { return 0 }
+	tests := []struct {
+		name     string
+		config   Config
+		failures int
+		want     time.Duration
+	}{
+		{name: "Success", config: Config{Interval: time.Minute, Backoff: time.Second}, want: time.Minute},
+		{name: "First failure", config: Config{Interval: time.Minute, Backoff: time.Second}, failures: 1, want: time.Second},
+		{name: "Doubles", config: Config{Interval: time.Minute, Backoff: time.Second}, failures: 4, want: 8 * time.Second},
+		{name: "Capped", config: Config{Interval: time.Minute, Backoff: time.Second, MaxBackoff: 5 * time.Second}, failures: 10, want: 5 * time.Second},
+		{name: "No backoff", config: Config{Interval: time.Minute}, failures: 3, want: time.Minute},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.config.wait(tc.failures, noJitter); got != tc.want {
+				t.Fatalf("want: %s, got: %s", tc.want, got)
+			}
+		})
+	}
+
+	s := New()
+	for i := 0; i < 100; i++ {
+		got := Config{Interval: time.Minute, Jitter: time.Second}.wait(0, s.jitter)
+		if got < time.Minute || got >= time.Minute+time.Second {
+			t.Fatalf("jittered wait out of range: %s", got)
+		}
+	}
+}
+
+func TestRefreshNow(t *testing.T) {
+	failing := &testPuller{err: errors.New("connection refused")}
+	blocked := &testPuller{release: make(chan struct{})}
+	defer close(blocked.release)
+	slow := hoststore.New(blocked)
+
+	s := New()
+	if err := s.Add("fw01", Config{Interval: time.Hour}, hoststore.New(&testPuller{})); err != nil {
+		t.Fatalf("failed to add fw01: %v", err)
+	}
+	if err := s.Add("fw02", Config{Interval: time.Hour}, hoststore.New(failing)); err != nil {
+		t.Fatalf("failed to add fw02: %v", err)
+	}
+	if err := s.Add("fw03", Config{Interval: time.Hour, Timeout: 10 * time.Millisecond}, slow); err != nil {
+		t.Fatalf("failed to add fw03: %v", err)
+	}
+	if err := s.Add("fw01", Config{Interval: time.Hour}, slow); !errors.Is(err, ErrDuplicateNode) {
+		t.Fatalf("Expected error: %v\nError received: %v", ErrDuplicateNode, err)
+	}
+
+	ctx := context.Background()
+	if err := s.RefreshNow(ctx, "fw01"); err != nil {
+		t.Fatalf("failed to refresh fw01: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.RefreshNow(ctx, "fw02"); err == nil {
+			t.Fatalf("expected fw02 to fail")
+		}
+	}
+	if err := s.RefreshNow(ctx, "fw03"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected fw03 to time out, got: %v", err)
+	}
+	if err := s.RefreshNow(ctx, "fw04"); !errors.Is(err, ErrUnknownNode) {
+		t.Fatalf("Expected error: %v\nError received: %v", ErrUnknownNode, err)
+	}
+
+	statuses := s.Statuses()
+	if st := statuses["fw01"]; st.LastSuccess.IsZero() || st.LastError != nil {
+		t.Errorf("fw01 should have succeeded: %+v", st)
+	}
+	if st := statuses["fw02"]; !st.LastSuccess.IsZero() || st.Failures != 2 || st.LastFailure.IsZero() {
+		t.Errorf("fw02 should have failed twice: %+v", st)
+	}
+	if len(slow.All()) != 0 {
+		t.Errorf("timed out refresh changed the store")
+	}
+}
+
+func TestStart(t *testing.T) {
+	puller := &testPuller{}
+	store := hoststore.New(puller)
+	s := New()
+	if err := s.Add("fw01", Config{Interval: time.Millisecond}, store); err != nil {
+		t.Fatalf("failed to add fw01: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for puller.count() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	s.Wait()
+
+	if puller.count() < 3 {
+		t.Fatalf("expected at least 3 refreshes, got: %d", puller.count())
+	}
+	if len(store.All()) != 1 {
+		t.Fatalf("expected the pulled host in the store, got: %d", len(store.All()))
+	}
+}
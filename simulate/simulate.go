@@ -0,0 +1,276 @@
+// Package simulate works out the impact of a proposed change to a node's
+// rules before it is deployed.
+package simulate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Neffats/wherecp/core"
+	rulestore "github.com/Neffats/wherecp/store/rule"
+)
+
+var (
+	ErrRuleNotInPolicy = errors.New("rule not in policy")
+)
+
+// Change is a single proposed change to a node's rules.
+type Change interface {
+	apply(s *simulation) error
+}
+
+// Insert adds a new rule at Position (1 being the top of the policy).
+// A Position of 0, or past the end of the policy, appends the rule.
+type Insert struct {
+	Rule     *core.Rule
+	Position int
+}
+
+// Delete removes an existing rule.
+type Delete struct {
+	UID string
+}
+
+// Move moves an existing rule to Position (1 being the top of the policy).
+type Move struct {
+	UID      string
+	Position int
+}
+
+// RuleRef identifies a rule in the simulated policy. Number is the rule's
+// position once the changes have been applied.
+type RuleRef struct {
+	UID    string `json:"uid"`
+	Name   string `json:"name,omitempty"`
+	Number int    `json:"number"`
+}
+
+// Shadowing describes the overlap between a proposed rule and an existing one.
+// Full is true when the shadowed rule can never match anything the other rule
+// doesn't already match. Conflict is true when the two rules have different actions.
+// Only addresses and services are compared, so a rule limited to zones,
+// applications, users or a schedule (see core.Rule.Scoped) isn't taken to
+// shadow the rules after it: they may never see the same traffic.
+type Shadowing struct {
+	Proposed RuleRef `json:"proposed"`
+	Rule     RuleRef `json:"rule"`
+	Full     bool    `json:"full"`
+	Conflict bool    `json:"conflict"`
+}
+
+// Check is a compliance check that is run against both the current and the
+// simulated policy. Rules are passed in policy order.
+type Check interface {
+	Name() string
+	Check(rules []*core.Rule) ([]Violation, error)
+}
+
+// Violation is a single failed compliance check.
+type Violation struct {
+	Check    string  `json:"check"`
+	Severity string  `json:"severity,omitempty"`
+	Rule     RuleRef `json:"rule"`
+	Message  string  `json:"message"`
+}
+
+// Result holds the impact of a set of changes.
+type Result struct {
+	// Rules is the simulated policy in order.
+	Rules []*core.Rule `json:"-"`
+	// Shadows lists existing rules that a proposed rule would (partly) hide.
+	Shadows []Shadowing `json:"shadows"`
+	// ShadowedBy lists existing rules that would (partly) hide a proposed rule.
+	ShadowedBy []Shadowing `json:"shadowed_by"`
+	// Verdicts lists the test cases whose outcome changed.
+	Verdicts []VerdictChange `json:"verdicts"`
+	// Violations lists compliance failures introduced by the changes.
+	Violations []Violation `json:"violations"`
+}
+
+type simulation struct {
+	view *rulestore.View
+	// order holds the uid of every rule in the view, in policy order.
+	order []string
+	// proposed holds the uids of inserted or moved rules.
+	proposed map[string]bool
+}
+
+// Run applies the changes to a copy-on-write view of the store and reports
+// their impact. The store itself is never modified.
+func Run(store *rulestore.RuleStore, changes []Change, tests []TestCase, checks ...Check) (*Result, error) {
+	before := ordered(store.All())
+
+	sim := &simulation{
+		view:     store.View(),
+		order:    make([]string, 0, len(before)),
+		proposed: make(map[string]bool),
+	}
+	for _, r := range before {
+		sim.order = append(sim.order, r.UID())
+	}
+	for _, c := range changes {
+		if err := c.apply(sim); err != nil {
+			return nil, fmt.Errorf("failed to apply change: %v", err)
+		}
+	}
+	after, err := sim.rules()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build simulated policy: %v", err)
+	}
+
+	result := &Result{Rules: after}
+	result.Shadows, result.ShadowedBy = shadowing(after, sim.proposed)
+	result.Verdicts, err = verdicts(before, after, tests)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate test cases: %v", err)
+	}
+	result.Violations, err = violations(before, after, checks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run compliance checks: %v", err)
+	}
+	return result, nil
+}
+
+func (c Insert) apply(s *simulation) error {
+	if err := s.view.Insert(c.Rule); err != nil {
+		return fmt.Errorf("failed to insert rule: %v", err)
+	}
+	s.order = place(s.order, c.Rule.UID(), c.Position)
+	s.proposed[c.Rule.UID()] = true
+	return nil
+}
+
+func (c Delete) apply(s *simulation) error {
+	if err := s.view.Delete(c.UID); err != nil {
+		return fmt.Errorf("failed to delete rule %s: %v", c.UID, err)
+	}
+	s.order = remove(s.order, c.UID)
+	delete(s.proposed, c.UID)
+	return nil
+}
+
+func (c Move) apply(s *simulation) error {
+	order := remove(s.order, c.UID)
+	if len(order) == len(s.order) {
+		return fmt.Errorf("failed to move rule %s: %w", c.UID, ErrRuleNotInPolicy)
+	}
+	s.order = place(order, c.UID, c.Position)
+	s.proposed[c.UID] = true
+	return nil
+}
+
+func (s *simulation) rules() ([]*core.Rule, error) {
+	result := make([]*core.Rule, 0, len(s.order))
+	for _, uid := range s.order {
+		r, err := s.view.Get(uid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get rule %s: %v", uid, err)
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+func place(order []string, uid string, position int) []string {
+	i := position - 1
+	if i < 0 || i > len(order) {
+		i = len(order)
+	}
+	result := make([]string, len(order)+1)
+	copy(result[:i], order[:i])
+	copy(result[i+1:], order[i:])
+	result[i] = uid
+	return result
+}
+
+func remove(order []string, uid string) []string {
+	result := make([]string, 0, len(order))
+	for _, o := range order {
+		if o != uid {
+			result = append(result, o)
+		}
+	}
+	return result
+}
+
+// ordered returns a copy of the rules sorted by rule number.
+func ordered(rules []*core.Rule) []*core.Rule {
+	result := make([]*core.Rule, len(rules))
+	copy(result, rules)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Number() < result[j].Number()
+	})
+	return result
+}
+
+func ref(r *core.Rule, i int) RuleRef {
+	return RuleRef{UID: r.UID(), Name: r.Name(), Number: i + 1}
+}
+
+func shadowing(rules []*core.Rule, proposed map[string]bool) (shadows, shadowedBy []Shadowing) {
+	shadows = make([]Shadowing, 0)
+	shadowedBy = make([]Shadowing, 0)
+
+	traffic := make([]core.Traffic, len(rules))
+	for i, r := range rules {
+		traffic[i] = r.Traffic()
+	}
+
+	for p, r := range rules {
+		if !proposed[r.UID()] {
+			continue
+		}
+		for i, other := range rules {
+			if i == p || proposed[other.UID()] {
+				continue
+			}
+			earlier := rules[p]
+			if i < p {
+				earlier = other
+			}
+			if earlier.Scoped() || traffic[p].Intersect(traffic[i]).Empty() {
+				continue
+			}
+			s := Shadowing{
+				Proposed: ref(r, p),
+				Rule:     ref(other, i),
+				Conflict: r.Action() != other.Action(),
+			}
+			if i < p {
+				s.Full = len(traffic[p].Subtract(traffic[i])) == 0
+				shadowedBy = append(shadowedBy, s)
+			} else {
+				s.Full = len(traffic[i].Subtract(traffic[p])) == 0
+				shadows = append(shadows, s)
+			}
+		}
+	}
+	return shadows, shadowedBy
+}
+
+func violations(before, after []*core.Rule, checks []Check) ([]Violation, error) {
+	result := make([]Violation, 0)
+	for _, c := range checks {
+		existing, err := c.Check(before)
+		if err != nil {
+			return nil, fmt.Errorf("check %s failed on current policy: %v", c.Name(), err)
+		}
+		seen := make(map[string]bool)
+		for _, v := range existing {
+			seen[v.Rule.UID+v.Message] = true
+		}
+
+		simulated, err := c.Check(after)
+		if err != nil {
+			return nil, fmt.Errorf("check %s failed on simulated policy: %v", c.Name(), err)
+		}
+		// Only report the violations that the changes introduce.
+		for _, v := range simulated {
+			if !seen[v.Rule.UID+v.Message] {
+				result = append(result, v)
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,159 @@
+package simulate
+
+import (
+	"testing"
+
+	"github.com/Neffats/wherecp/core"
+	rulestore "github.com/Neffats/wherecp/store/rule"
+)
+
+type testPuller struct{}
+
+func (tp *testPuller) PullRules() ([]*core.Rule, error) {
+	return make([]*core.Rule, 0), nil
+}
+
+func network(t *testing.T, name, addr, mask string) *core.Group {
+	t.Helper()
+	n, err := core.NewNetwork(name, addr, mask, "")
+	if err != nil {
+		t.Fatalf("failed to create network: %v", err)
+	}
+	grp := core.NewGroup(name, "")
+	if err := grp.Add(n); err != nil {
+		t.Fatalf("failed to add network to group: %v", err)
+	}
+	return grp
+}
+
+func service(t *testing.T, name string, port uint) *core.PortGroup {
+	t.Helper()
+	p, err := core.NewPort(name, port, "tcp", "")
+	if err != nil {
+		t.Fatalf("failed to create port: %v", err)
+	}
+	pg := core.NewPortGroup(name, "")
+	if err := pg.Add(p); err != nil {
+		t.Fatalf("failed to add port to group: %v", err)
+	}
+	return pg
+}
+
+// sshCheck flags every rule that permits ssh.
+type sshCheck struct{}
+
+func (c sshCheck) Name() string {
+	return "no ssh"
+}
+
+func (c sshCheck) Check(rules []*core.Rule) ([]Violation, error) {
+	ssh, err := core.NewPort("ssh", 22, "tcp", "")
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Violation, 0)
+	for i, r := range rules {
+		if r.Action() && r.Port().Contains(ssh) {
+			result = append(result, Violation{Check: c.Name(), Rule: ref(r, i), Message: "permits ssh"})
+		}
+	}
+	return result, nil
+}
+
+func TestRun(t *testing.T) {
+	any := network(t, "any", "0.0.0.0", "0.0.0.0")
+	clients := network(t, "clients", "10.0.0.0", "255.255.255.0")
+	web := network(t, "web", "10.1.0.0", "255.255.255.0")
+
+	allowWeb := core.NewNamedRule("allow-web", 1, clients, web, service(t, "http", 80), true, "")
+	denySSH := core.NewNamedRule("deny-ssh", 2, any, any, service(t, "ssh", 22), false, "")
+	store := rulestore.New(&testPuller{})
+	store.Rules = []*core.Rule{allowWeb, denySSH}
+
+	tests := []TestCase{
+		{Name: "client ssh", Source: "10.0.0.1", Destination: "10.1.0.1", Protocol: "tcp", Port: 22},
+		{Name: "client web", Source: "10.0.0.1", Destination: "10.1.0.1", Protocol: "tcp", Port: 80},
+	}
+
+	t.Run("Insert opening rule", func(t *testing.T) {
+		allowSSH := core.NewNamedRule("allow-ssh", 0, clients, web, service(t, "ssh", 22), true, "")
+		result, err := Run(store, []Change{Insert{Rule: allowSSH, Position: 1}}, tests, sshCheck{})
+		if err != nil {
+			t.Fatalf("got error when not expected: %v", err)
+		}
+
+		if len(result.Rules) != 3 || result.Rules[0] != allowSSH {
+			t.Fatalf("expected proposed rule at the top of the policy, got: %+v", result.Rules)
+		}
+		if len(result.Shadows) != 1 || result.Shadows[0].Rule.Name != "deny-ssh" ||
+			result.Shadows[0].Full || !result.Shadows[0].Conflict {
+			t.Fatalf("expected proposed rule to partly shadow deny-ssh, got: %+v", result.Shadows)
+		}
+		if len(result.Verdicts) != 1 || result.Verdicts[0].Test.Name != "client ssh" || !result.Verdicts[0].After.Permit {
+			t.Fatalf("expected client ssh to become permitted, got: %+v", result.Verdicts)
+		}
+		if len(result.Violations) != 1 || result.Violations[0].Rule.Name != "allow-ssh" {
+			t.Fatalf("expected allow-ssh to violate the ssh check, got: %+v", result.Violations)
+		}
+		if len(store.All()) != 2 {
+			t.Fatalf("simulation modified the store")
+		}
+	})
+
+	t.Run("Insert redundant rule", func(t *testing.T) {
+		redundant := core.NewNamedRule("redundant", 0, clients, web, service(t, "http", 80), true, "")
+		result, err := Run(store, []Change{Insert{Rule: redundant}}, tests)
+		if err != nil {
+			t.Fatalf("got error when not expected: %v", err)
+		}
+		if len(result.ShadowedBy) != 1 || result.ShadowedBy[0].Rule.Name != "allow-web" || !result.ShadowedBy[0].Full {
+			t.Fatalf("expected proposed rule to be fully shadowed by allow-web, got: %+v", result.ShadowedBy)
+		}
+		if len(result.Verdicts) != 0 {
+			t.Fatalf("expected no verdict changes, got: %+v", result.Verdicts)
+		}
+	})
+
+	t.Run("Insert zone scoped rule", func(t *testing.T) {
+		// Above allow-web the scoped rule only sees traffic from trust, so
+		// it doesn't shadow it. Below, allow-web still hides all of it.
+		scoped := func(name string) *core.Rule {
+			r := core.NewNamedRule(name, 0, clients, web, service(t, "http", 80), false, "")
+			r.AddFromZone(core.NewZone("trust", ""))
+			return r
+		}
+		top, bottom := scoped("trust-top"), scoped("trust-bottom")
+		result, err := Run(store, []Change{Insert{Rule: top, Position: 1}, Insert{Rule: bottom}}, nil)
+		if err != nil {
+			t.Fatalf("got error when not expected: %v", err)
+		}
+		if len(result.Shadows) != 0 {
+			t.Fatalf("expected scoped rule not to shadow anything, got: %+v", result.Shadows)
+		}
+		if len(result.ShadowedBy) != 1 || result.ShadowedBy[0].Proposed.Name != "trust-bottom" ||
+			result.ShadowedBy[0].Rule.Name != "allow-web" || !result.ShadowedBy[0].Full {
+			t.Fatalf("expected trust-bottom to be fully shadowed by allow-web, got: %+v", result.ShadowedBy)
+		}
+	})
+
+	t.Run("Delete and move", func(t *testing.T) {
+		changes := []Change{
+			Move{UID: denySSH.UID(), Position: 1},
+			Delete{UID: allowWeb.UID()},
+		}
+		result, err := Run(store, changes, tests)
+		if err != nil {
+			t.Fatalf("got error when not expected: %v", err)
+		}
+		if len(result.Verdicts) != 1 || result.Verdicts[0].Test.Name != "client web" || result.Verdicts[0].After.Permit {
+			t.Fatalf("expected client web to become denied, got: %+v", result.Verdicts)
+		}
+	})
+
+	t.Run("Move unknown rule", func(t *testing.T) {
+		_, err := Run(store, []Change{Move{UID: "unknown", Position: 1}}, tests)
+		if err == nil {
+			t.Fatalf("expected error")
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package simulate
+
+import (
+	"fmt"
+
+	"github.com/Neffats/wherecp/core"
+	"github.com/Neffats/wherecp/eval"
+)
+
+// TestCase is a flow whose verdict is compared before and after the changes.
+type TestCase struct {
+	Name        string `json:"name"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Protocol    string `json:"protocol"`
+	Port        uint   `json:"port"`
+}
+
+// Verdict is what the policy does with a test case. Rule is nil when no rule
+// matched and the default deny applied.
+type Verdict struct {
+	Permit bool     `json:"permit"`
+	Rule   *RuleRef `json:"rule,omitempty"`
+}
+
+// VerdictChange is a test case whose verdict is different after the changes.
+type VerdictChange struct {
+	Test   TestCase `json:"test"`
+	Before Verdict  `json:"before"`
+	After  Verdict  `json:"after"`
+}
+
+func verdicts(before, after []*core.Rule, tests []TestCase) ([]VerdictChange, error) {
+	oldEval := eval.New(before)
+	newEval := eval.New(after)
+
+	result := make([]VerdictChange, 0)
+	for _, tc := range tests {
+		pkt := eval.Packet{
+			Source:          tc.Source,
+			Destination:     tc.Destination,
+			Protocol:        tc.Protocol,
+			DestinationPort: tc.Port,
+		}
+		old, err := oldEval.Evaluate(pkt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid test case %q: %v", tc.Name, err)
+		}
+		new, err := newEval.Evaluate(pkt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid test case %q: %v", tc.Name, err)
+		}
+		if old.Permit == new.Permit {
+			continue
+		}
+		result = append(result, VerdictChange{Test: tc, Before: verdict(old), After: verdict(new)})
+	}
+	return result, nil
+}
+
+func verdict(r *eval.Result) Verdict {
+	if r.Default() {
+		return Verdict{Permit: r.Permit}
+	}
+	matched := ref(r.Rule, r.Position-1)
+	return Verdict{Permit: r.Permit, Rule: &matched}
+}
@@ -1,11 +1,16 @@
 package hoststore
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"sync"
 	
 	"github.com/Neffats/wherecp/core"
+	"github.com/Neffats/wherecp/event"
+	"github.com/Neffats/wherecp/store/internal/pulls"
 )
 
 var (
@@ -16,10 +21,22 @@ type HostPuller interface {
 	PullHosts() ([]*core.Host, error)
 }
 
+// HostContextPuller is a HostPuller that gives up on a pull once ctx is done.
+// Refresh uses it when the store's Puller satisfies it.
+type HostContextPuller interface {
+	PullHostsContext(ctx context.Context) ([]*core.Host, error)
+}
+
 type HostStore struct {
 	Hosts []*core.Host
 	Puller HostPuller
+	// Node is the name of the node the store belongs to. If set, pulled
+	// objects are given stable UIDs derived from it, see core.Identifier.
+	Node string
+
+	pulls pulls.Group[[]*core.Host]
 
+	events event.Broker
 	mux sync.RWMutex
 }
 
@@ -30,15 +47,86 @@ func New(puller HostPuller) *HostStore {
 	}
 }
 
+// Init pulls the hosts from the source, replacing the ones in the store.
 func (hs *HostStore) Init() error {
-	hosts, err := hs.Puller.PullHosts()
-	if err != nil {
-		return fmt.Errorf("failed to pull hosts from source: %v", err)
+	return hs.Refresh(context.Background())
+}
+
+// Refresh pulls the hosts from the source and swaps them in for the ones in
+// the store. Readers aren't blocked while pulling. If ctx is done before the
+// pull returns, the store is left as it was.
+// A Refresh that finds the pull of an earlier one still running waits on
+// that pull instead of starting another.
+func (hs *HostStore) Refresh(ctx context.Context) error {
+	if err := hs.pulls.Do(ctx, hs.pull, hs.apply); err != nil {
+		return fmt.Errorf("failed to refresh hosts: %w", err)
 	}
+	return nil
+}
+
+// apply swaps in the result of a pull.
+func (hs *HostStore) apply(hosts []*core.Host) error {
+	if hs.Node != "" {
+		for _, h := range hosts {
+			h.Identify(hs.Node)
+		}
+	}
+	hs.mux.Lock()
+	defer hs.mux.Unlock()
+	hs.events.Publish(hs.changes(hs.Hosts, hosts)...)
 	hs.Hosts = hosts
 	return nil
 }
 
+// pull pulls the hosts from the source, giving up once ctx is done if the
+// Puller is a HostContextPuller.
+func (hs *HostStore) pull(ctx context.Context) ([]*core.Host, error) {
+	var hosts []*core.Host
+	var err error
+	if cp, ok := hs.Puller.(HostContextPuller); ok {
+		hosts, err = cp.PullHostsContext(ctx)
+	} else {
+		hosts, err = hs.Puller.PullHosts()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull hosts from source: %w", err)
+	}
+	return hosts, nil
+}
+
+// changes returns an event for every host that differs between old and new.
+func (hs *HostStore) changes(old, new []*core.Host) []event.Event {
+	result := make([]event.Event, 0)
+	previous := make(map[string]*core.Host, len(old))
+	for _, h := range old {
+		previous[h.UID()] = h
+	}
+	for _, h := range new {
+		p, ok := previous[h.UID()]
+		delete(previous, h.UID())
+		if !ok {
+			result = append(result, event.New(event.Insert, "host", hs.Node, h.UID(), h))
+			continue
+		}
+		pJSON, pErr := json.Marshal(p)
+		hJSON, hErr := json.Marshal(h)
+		if pErr != nil || hErr != nil || !bytes.Equal(pJSON, hJSON) {
+			result = append(result, event.New(event.Update, "host", hs.Node, h.UID(), h))
+		}
+	}
+	for _, h := range old {
+		if _, ok := previous[h.UID()]; ok {
+			result = append(result, event.New(event.Delete, "host", hs.Node, h.UID(), h))
+		}
+	}
+	return result
+}
+
+// Subscribe returns a subscription to every change made to the store's hosts.
+func (hs *HostStore) Subscribe(buffer int) *event.Subscription {
+	return hs.events.Subscribe(buffer)
+}
+
 func (hs *HostStore) All() []*core.Host {
 	hs.mux.RLock()
 	defer hs.mux.RUnlock()
@@ -58,6 +146,7 @@ func (hs *HostStore) Create(host *core.Host) error {
 	hs.mux.Lock()
 	defer hs.mux.Unlock()
 	hs.Hosts = append(hs.Hosts, host)
+	hs.events.Publish(event.New(event.Insert, "host", hs.Node, host.UID(), host))
 	return nil
 }
 
@@ -75,13 +164,12 @@ func (hs *HostStore) Get(uid string) (*core.Host, error) {
 }
 
 func (hs *HostStore) Update(uid string, updated *core.Host) error {
-	hs.mux.RLock()
-	defer hs.mux.RUnlock()
+	hs.mux.Lock()
+	defer hs.mux.Unlock()
 	for i, h := range hs.Hosts {
 		if h.UID() == uid {
-			hs.mux.Lock()
 			hs.Hosts[i] = updated
-			hs.mux.Unlock()
+			hs.events.Publish(event.New(event.Update, "host", hs.Node, uid, updated))
 			return nil
 		}
 	}
@@ -89,14 +177,15 @@ func (hs *HostStore) Update(uid string, updated *core.Host) error {
 }
 
 func (hs *HostStore) Delete(uid string) error {
+	hs.mux.Lock()
+	defer hs.mux.Unlock()
 	for i, h := range hs.Hosts {
 		if h.UID() == uid {
-			hs.mux.Lock()
 			newHosts := make([]*core.Host, len(hs.Hosts)-1)
 			copy(newHosts[:i], hs.Hosts[:i])
 			copy(newHosts[i:], hs.Hosts[i+1:])
 			hs.Hosts = newHosts
-			hs.mux.Unlock()
+			hs.events.Publish(event.New(event.Delete, "host", hs.Node, uid, h))
 			return nil
 		}
 	}
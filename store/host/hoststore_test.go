@@ -238,3 +238,35 @@ func TestDelete(t *testing.T) {
 	}
 	
 }
+
+func TestUpdate(t *testing.T) {
+	host1, err := core.NewHost("host1", "192.168.1.1", "host1")
+	if err != nil {
+		t.Fatalf("failed to create host1: %v", err)
+	}
+	testStore := &HostStore{
+		Hosts:  []*core.Host{host1},
+		Puller: &testPuller{},
+	}
+
+	moved, err := host1.WithAddress("192.168.1.2")
+	if err != nil {
+		t.Fatalf("failed to update host address: %v", err)
+	}
+	if err := testStore.Update(host1.UID(), moved.WithComment("moved")); err != nil {
+		t.Fatalf("failed to update host: %v", err)
+	}
+	got, err := testStore.Get(host1.UID())
+	if err != nil {
+		t.Fatalf("failed to get updated host: %v", err)
+	}
+	if got.Address() != "192.168.1.2" || got.Comment() != "moved" {
+		t.Errorf("want: 192.168.1.2 (moved)\ngot: %s (%s)", got.Address(), got.Comment())
+	}
+	if host1.Address() != "192.168.1.1" {
+		t.Errorf("original host was changed: %s", host1.Address())
+	}
+	if err := testStore.Update("missing", moved); !errors.Is(err, ErrHostNotFound) {
+		t.Errorf("Expected error: %v\nError received: %v", ErrHostNotFound, err)
+	}
+}
@@ -0,0 +1,103 @@
+// Package pulls lets a store share a pull from its source between the
+// Refreshes that overlap it.
+package pulls
+
+import (
+	"context"
+	"sync"
+)
+
+// Group runs one pull at a time. Do calls that overlap a running pull wait on
+// it instead of starting another, so a source that hangs doesn't pile up
+// pulls. The zero Group is ready to use.
+type Group[T any] struct {
+	mux     sync.Mutex
+	pending *call[T]
+}
+
+type call[T any] struct {
+	done   chan struct{}
+	result T
+	err    error
+
+	// waiters is the number of Do calls waiting on the pull. The pull's
+	// ctx is cancelled once all of them have given up.
+	waiters  int
+	cancel   context.CancelFunc
+	canceled bool
+
+	apply    sync.Once
+	applyErr error
+}
+
+// Do runs pull and waits for it to return or for ctx to be done, whichever is
+// first. If the pull of an earlier Do is still running, Do waits on that one
+// instead. The pull's ctx isn't tied to any single caller: it's only
+// cancelled when every Do waiting on it has returned early.
+//
+// Once the pull returns, apply is called with its result by one of the Do
+// calls waiting on it, and each of them returns the pull's or apply's error.
+// If ctx is done first, ctx.Err() is returned.
+func (g *Group[T]) Do(ctx context.Context, pull func(context.Context) (T, error), apply func(T) error) error {
+	for {
+		g.mux.Lock()
+		c := g.pending
+		if c != nil && c.canceled {
+			// Nobody wants the result of the cancelled pull, start a new
+			// one once it has returned.
+			g.mux.Unlock()
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-c.done:
+			}
+			continue
+		}
+		if c == nil {
+			c = g.start(pull)
+		}
+		c.waiters++
+		g.mux.Unlock()
+
+		select {
+		case <-ctx.Done():
+			g.leave(c)
+			return ctx.Err()
+		case <-c.done:
+		}
+		if c.err != nil {
+			return c.err
+		}
+		c.apply.Do(func() {
+			c.applyErr = apply(c.result)
+		})
+		return c.applyErr
+	}
+}
+
+// start runs pull in the background as the pending pull. g.mux must be held.
+func (g *Group[T]) start(pull func(context.Context) (T, error)) *call[T] {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &call[T]{done: make(chan struct{}), cancel: cancel}
+	g.pending = c
+	go func() {
+		c.result, c.err = pull(ctx)
+		cancel()
+		g.mux.Lock()
+		g.pending = nil
+		g.mux.Unlock()
+		close(c.done)
+	}()
+	return c
+}
+
+// leave gives up waiting on c, cancelling it if nobody else is.
+func (g *Group[T]) leave(c *call[T]) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	c.waiters--
+	if c.waiters == 0 {
+		c.canceled = true
+		c.cancel()
+	}
+}
@@ -0,0 +1,136 @@
+package pulls
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSource counts its pulls, which block until release is closed or their
+// ctx is done.
+type testSource struct {
+	release chan struct{}
+	// ignoreCtx makes pulls block on release only.
+	ignoreCtx bool
+
+	mux   sync.Mutex
+	pulls int
+}
+
+func (ts *testSource) pull(ctx context.Context) (int, error) {
+	ts.mux.Lock()
+	ts.pulls++
+	n := ts.pulls
+	ts.mux.Unlock()
+	if ts.ignoreCtx {
+		<-ts.release
+		return n, nil
+	}
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-ts.release:
+		return n, nil
+	}
+}
+
+func (ts *testSource) count() int {
+	ts.mux.Lock()
+	defer ts.mux.Unlock()
+	return ts.pulls
+}
+
+func TestDo(t *testing.T) {
+	tests := []struct {
+		name      string
+		ignoreCtx bool
+		// first and second are the timeouts of two overlapping Do calls,
+		// zero for none.
+		first, second time.Duration
+		wantFirst     error
+		wantSecond    error
+		wantPulls     int
+	}{
+		{name: "Joined pull outlives first caller",
+			first: 10 * time.Millisecond, wantFirst: context.DeadlineExceeded,
+			wantPulls: 1},
+		{name: "Hung pull ignoring ctx isn't pulled again",
+			ignoreCtx: true, first: 10 * time.Millisecond, second: 20 * time.Millisecond,
+			wantFirst: context.DeadlineExceeded, wantSecond: context.DeadlineExceeded,
+			wantPulls: 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			src := &testSource{release: make(chan struct{}), ignoreCtx: tc.ignoreCtx}
+			var g Group[int]
+			applied := make([]int, 0)
+			apply := func(n int) error {
+				applied = append(applied, n)
+				return nil
+			}
+			do := func(timeout time.Duration) chan error {
+				ctx, cancel := context.Background(), context.CancelFunc(func() {})
+				if timeout > 0 {
+					ctx, cancel = context.WithTimeout(ctx, timeout)
+				}
+				result := make(chan error, 1)
+				go func() {
+					defer cancel()
+					result <- g.Do(ctx, src.pull, apply)
+				}()
+				return result
+			}
+
+			first := do(tc.first)
+			for src.count() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			second := do(tc.second)
+			if err := <-first; !errors.Is(err, tc.wantFirst) {
+				t.Fatalf("first: want: %v, got: %v", tc.wantFirst, err)
+			}
+			if tc.wantSecond != nil {
+				if err := <-second; !errors.Is(err, tc.wantSecond) {
+					t.Fatalf("second: want: %v, got: %v", tc.wantSecond, err)
+				}
+			}
+			close(src.release)
+			if tc.wantSecond == nil {
+				if err := <-second; err != nil {
+					t.Fatalf("second: unexpected error: %v", err)
+				}
+				if len(applied) != 1 || applied[0] != 1 {
+					t.Fatalf("want the first pull applied once, got: %v", applied)
+				}
+			}
+			if got := src.count(); got != tc.wantPulls {
+				t.Fatalf("want %d pulls, got: %d", tc.wantPulls, got)
+			}
+		})
+	}
+}
+
+func TestDoCancel(t *testing.T) {
+	src := &testSource{release: make(chan struct{})}
+	var g Group[int]
+	apply := func(int) error { return nil }
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := g.Do(ctx, src.pull, apply); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want: %v, got: %v", context.DeadlineExceeded, err)
+	}
+
+	// The abandoned pull was cancelled, so the next Do starts its own
+	// rather than getting the cancelled one's error.
+	close(src.release)
+	if err := g.Do(context.Background(), src.pull, apply); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := src.count(); got != 2 {
+		t.Fatalf("want 2 pulls, got: %d", got)
+	}
+}
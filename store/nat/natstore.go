@@ -0,0 +1,217 @@
+package natstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Neffats/wherecp/core"
+	"github.com/Neffats/wherecp/event"
+	"github.com/Neffats/wherecp/store/internal/pulls"
+)
+
+var (
+	ErrNATRuleNotFound = errors.New("nat rule not found")
+)
+
+// NATPuller is the interface that any vendor specific source of NAT rules
+// must satisfy.
+type NATPuller interface {
+	PullNATRules() ([]*core.NATRule, error)
+}
+
+// NATContextPuller is a NATPuller that gives up on a pull once ctx is done.
+// Refresh uses it when the store's Puller satisfies it.
+type NATContextPuller interface {
+	PullNATRulesContext(ctx context.Context) ([]*core.NATRule, error)
+}
+
+type NATStore struct {
+	Rules  []*core.NATRule
+	Puller NATPuller
+	// Node names the firewall the NAT rules are pulled from, used to give
+	// them stable UIDs. Pulled UIDs are kept if empty.
+	Node string
+
+	pulls pulls.Group[[]*core.NATRule]
+
+	events event.Broker
+	mux    sync.RWMutex
+}
+
+func New(puller NATPuller) *NATStore {
+	return &NATStore{
+		Rules:  make([]*core.NATRule, 0),
+		Puller: puller,
+	}
+}
+
+// Init pulls the NAT rules from the source, replacing the ones in the store.
+func (ns *NATStore) Init() error {
+	return ns.Refresh(context.Background())
+}
+
+// Refresh pulls the NAT rules from the source and swaps them in for the ones in
+// the store. Readers aren't blocked while pulling. If ctx is done before the
+// pull returns, the store is left as it was.
+// A Refresh that finds the pull of an earlier one still running waits on
+// that pull instead of starting another.
+func (ns *NATStore) Refresh(ctx context.Context) error {
+	if err := ns.pulls.Do(ctx, ns.pull, ns.apply); err != nil {
+		return fmt.Errorf("failed to refresh nat rules: %w", err)
+	}
+	return nil
+}
+
+// apply swaps in the result of a pull.
+func (ns *NATStore) apply(rules []*core.NATRule) error {
+	if ns.Node != "" {
+		for _, r := range rules {
+			r.Identify(ns.Node)
+		}
+	}
+	ns.mux.Lock()
+	defer ns.mux.Unlock()
+	ns.events.Publish(ns.changes(ns.Rules, rules)...)
+	ns.Rules = rules
+	return nil
+}
+
+// pull pulls the nat rules from the source, giving up once ctx is done if the
+// Puller is a NATContextPuller.
+func (ns *NATStore) pull(ctx context.Context) ([]*core.NATRule, error) {
+	var rules []*core.NATRule
+	var err error
+	if cp, ok := ns.Puller.(NATContextPuller); ok {
+		rules, err = cp.PullNATRulesContext(ctx)
+	} else {
+		rules, err = ns.Puller.PullNATRules()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull nat rules from source: %w", err)
+	}
+	return rules, nil
+}
+
+// changes returns an event for every NAT rule that differs between old and
+// new.
+func (ns *NATStore) changes(old, new []*core.NATRule) []event.Event {
+	result := make([]event.Event, 0)
+	previous := make(map[string]*core.NATRule, len(old))
+	for _, r := range old {
+		previous[r.UID()] = r
+	}
+	for _, r := range new {
+		p, ok := previous[r.UID()]
+		delete(previous, r.UID())
+		switch {
+		case !ok:
+			result = append(result, event.New(event.Insert, "nat-rule", ns.Node, r.UID(), r))
+		case !sameNATRule(p, r):
+			result = append(result, event.New(event.Update, "nat-rule", ns.Node, r.UID(), r))
+		}
+	}
+	for _, r := range old {
+		if _, ok := previous[r.UID()]; ok {
+			result = append(result, event.New(event.Delete, "nat-rule", ns.Node, r.UID(), r))
+		}
+	}
+	return result
+}
+
+// sameNATRule returns true if both NAT rules have the same content, including
+// the contents of the groups they reference.
+func sameNATRule(a, b *core.NATRule) bool {
+	if a == b {
+		return true
+	}
+	if a.Name() != b.Name() || a.Number() != b.Number() || a.Type() != b.Type() ||
+		a.TranslatedPort() != b.TranslatedPort() || a.Comment() != b.Comment() {
+		return false
+	}
+	parts := func(n *core.NATRule) []interface{} {
+		return []interface{}{n.Source(), n.Destination(), n.Service(), n.TranslatedSource(), n.TranslatedDestination()}
+	}
+	aJSON, aErr := json.Marshal(parts(a))
+	bJSON, bErr := json.Marshal(parts(b))
+	return aErr == nil && bErr == nil && bytes.Equal(aJSON, bJSON)
+}
+
+// Subscribe returns a subscription to every change made to the store's NAT
+// rules.
+func (ns *NATStore) Subscribe(buffer int) *event.Subscription {
+	return ns.events.Subscribe(buffer)
+}
+
+// All return all of the NAT rules in the store.
+func (ns *NATStore) All() []*core.NATRule {
+	ns.mux.RLock()
+	defer ns.mux.RUnlock()
+	// Create a new copy of rules to stop accidental modification.
+	r := make([]*core.NATRule, len(ns.Rules))
+	copy(r, ns.Rules)
+	return r
+}
+
+func (ns *NATStore) Insert(rule *core.NATRule) error {
+	ns.mux.Lock()
+	defer ns.mux.Unlock()
+	if ns.index(rule.UID()) != -1 {
+		return fmt.Errorf("nat rule is already in store")
+	}
+	ns.Rules = append(ns.Rules, rule)
+	ns.events.Publish(event.New(event.Insert, "nat-rule", ns.Node, rule.UID(), rule))
+	return nil
+}
+
+func (ns *NATStore) Get(uid string) (*core.NATRule, error) {
+	ns.mux.RLock()
+	defer ns.mux.RUnlock()
+	i := ns.index(uid)
+	if i == -1 {
+		return nil, ErrNATRuleNotFound
+	}
+	return ns.Rules[i], nil
+}
+
+func (ns *NATStore) Update(uid string, updated *core.NATRule) error {
+	ns.mux.Lock()
+	defer ns.mux.Unlock()
+	i := ns.index(uid)
+	if i == -1 {
+		return ErrNATRuleNotFound
+	}
+	ns.Rules[i] = updated
+	ns.events.Publish(event.New(event.Update, "nat-rule", ns.Node, uid, updated))
+	return nil
+}
+
+func (ns *NATStore) Delete(uid string) error {
+	ns.mux.Lock()
+	defer ns.mux.Unlock()
+	i := ns.index(uid)
+	if i == -1 {
+		return ErrNATRuleNotFound
+	}
+	deleted := ns.Rules[i]
+	newRules := make([]*core.NATRule, len(ns.Rules)-1)
+	copy(newRules[:i], ns.Rules[:i])
+	copy(newRules[i:], ns.Rules[i+1:])
+	ns.Rules = newRules
+	ns.events.Publish(event.New(event.Delete, "nat-rule", ns.Node, uid, deleted))
+	return nil
+}
+
+// index returns the position of the rule with the given uid, -1 if it isn't
+// in the store. The caller must hold the lock.
+func (ns *NATStore) index(uid string) int {
+	for i, r := range ns.Rules {
+		if r.UID() == uid {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,55 @@
+package natstore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Neffats/wherecp/core"
+)
+
+type testPuller struct {
+	rules []*core.NATRule
+}
+
+func (tp *testPuller) PullNATRules() ([]*core.NATRule, error) {
+	return tp.rules, nil
+}
+
+func TestNATStore(t *testing.T) {
+	real := core.NewGroup("real", "")
+	pool := core.NewGroup("pool", "")
+	first := core.NewDynamicNAT("first", 1, real, pool, "")
+	second := core.NewDynamicNAT("second", 2, real, pool, "")
+
+	store := New(&testPuller{rules: []*core.NATRule{first}})
+	if err := store.Init(); err != nil {
+		t.Fatalf("failed to init store: %v", err)
+	}
+	if err := store.Insert(second); err != nil {
+		t.Fatalf("failed to insert rule: %v", err)
+	}
+	if err := store.Insert(second); err == nil {
+		t.Fatalf("expected error inserting duplicate rule")
+	}
+	if got := store.All(); len(got) != 2 || got[0] != first || got[1] != second {
+		t.Fatalf("expected both rules in the store, got: %v", got)
+	}
+
+	updated := core.NewDynamicNAT("updated", 2, real, pool, "")
+	if err := store.Update(second.UID(), updated); err != nil {
+		t.Fatalf("failed to update rule: %v", err)
+	}
+	if got, err := store.Get(updated.UID()); err != nil || got != updated {
+		t.Fatalf("expected updated rule, got: %v, %v", got, err)
+	}
+
+	if err := store.Delete(first.UID()); err != nil {
+		t.Fatalf("failed to delete rule: %v", err)
+	}
+	if _, err := store.Get(first.UID()); !errors.Is(err, ErrNATRuleNotFound) {
+		t.Fatalf("expected rule not found, got: %v", err)
+	}
+	if err := store.Delete(first.UID()); !errors.Is(err, ErrNATRuleNotFound) {
+		t.Fatalf("expected rule not found, got: %v", err)
+	}
+}
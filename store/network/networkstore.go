@@ -1,10 +1,17 @@
 package networkstore
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
 	"sync"
 	
 	"github.com/Neffats/wherecp/core"
+	"github.com/Neffats/wherecp/event"
+	"github.com/Neffats/wherecp/store/internal/pulls"
 )
 
 var (
@@ -15,10 +22,22 @@ type NetworkPuller interface {
 	PullNetworks() ([]*core.Network, error)
 }
 
+// NetworkContextPuller is a NetworkPuller that gives up on a pull once ctx is done.
+// Refresh uses it when the store's Puller satisfies it.
+type NetworkContextPuller interface {
+	PullNetworksContext(ctx context.Context) ([]*core.Network, error)
+}
+
 type NetworkStore struct {
 	Networks []*core.Network
 	Puller NetworkPuller
+	// Node names the firewall the networks are pulled from, used to give
+	// them stable UIDs. Pulled UIDs are kept if empty.
+	Node string
 
+	pulls pulls.Group[[]*core.Network]
+
+	events event.Broker
 	mux sync.RWMutex
 }
 
@@ -29,15 +48,87 @@ func New(puller NetworkPuller) *NetworkStore {
 	}
 }
 
+// Init pulls the networks from the source, replacing the ones in the store.
 func (ns *NetworkStore) Init() error {
-	networks, err := ns.Puller.PullNetworks()
-	if err != nil {
-		return err
+	return ns.Refresh(context.Background())
+}
+
+// Refresh pulls the networks from the source and swaps them in for the ones in
+// the store. Readers aren't blocked while pulling. If ctx is done before the
+// pull returns, the store is left as it was.
+// A Refresh that finds the pull of an earlier one still running waits on
+// that pull instead of starting another.
+func (ns *NetworkStore) Refresh(ctx context.Context) error {
+	if err := ns.pulls.Do(ctx, ns.pull, ns.apply); err != nil {
+		return fmt.Errorf("failed to refresh networks: %w", err)
+	}
+	return nil
+}
+
+// apply swaps in the result of a pull.
+func (ns *NetworkStore) apply(networks []*core.Network) error {
+	if ns.Node != "" {
+		for _, n := range networks {
+			n.Identify(ns.Node)
+		}
 	}
+	ns.mux.Lock()
+	defer ns.mux.Unlock()
+	ns.events.Publish(ns.changes(ns.Networks, networks)...)
 	ns.Networks = networks
 	return nil
 }
 
+// pull pulls the networks from the source, giving up once ctx is done if the
+// Puller is a NetworkContextPuller.
+func (ns *NetworkStore) pull(ctx context.Context) ([]*core.Network, error) {
+	var networks []*core.Network
+	var err error
+	if cp, ok := ns.Puller.(NetworkContextPuller); ok {
+		networks, err = cp.PullNetworksContext(ctx)
+	} else {
+		networks, err = ns.Puller.PullNetworks()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull networks from source: %w", err)
+	}
+	return networks, nil
+}
+
+// changes returns an event for every network that differs between old and new.
+func (ns *NetworkStore) changes(old, new []*core.Network) []event.Event {
+	result := make([]event.Event, 0)
+	previous := make(map[string]*core.Network, len(old))
+	for _, n := range old {
+		previous[n.UID()] = n
+	}
+	for _, n := range new {
+		p, ok := previous[n.UID()]
+		delete(previous, n.UID())
+		if !ok {
+			result = append(result, event.New(event.Insert, "network", ns.Node, n.UID(), n))
+			continue
+		}
+		pJSON, pErr := json.Marshal(p)
+		nJSON, nErr := json.Marshal(n)
+		if pErr != nil || nErr != nil || !bytes.Equal(pJSON, nJSON) {
+			result = append(result, event.New(event.Update, "network", ns.Node, n.UID(), n))
+		}
+	}
+	for _, n := range old {
+		if _, ok := previous[n.UID()]; ok {
+			result = append(result, event.New(event.Delete, "network", ns.Node, n.UID(), n))
+		}
+	}
+	return result
+}
+
+// Subscribe returns a subscription to every change made to the store's
+// networks.
+func (ns *NetworkStore) Subscribe(buffer int) *event.Subscription {
+	return ns.events.Subscribe(buffer)
+}
+
 func (ns *NetworkStore) All() []*core.Network {
 	ns.mux.RLock()
 	defer ns.mux.RUnlock()
@@ -70,6 +161,7 @@ func (ns *NetworkStore) Insert(network *core.Network) error {
 	ns.mux.Lock()
 	defer ns.mux.Unlock()
 	ns.Networks = newNetworks
+	ns.events.Publish(event.New(event.Insert, "network", ns.Node, network.UID(), network))
 	return nil
 }
 
@@ -86,13 +178,12 @@ func (ns *NetworkStore) Get(uid string) (*core.Network, error) {
 }
 
 func (ns *NetworkStore) Update(uid string, updated *core.Network) error {
-	rs.mux.RLock()
-	defer rs.mux.RUnlock()
+	ns.mux.Lock()
+	defer ns.mux.Unlock()
 	for i, network := range ns.Networks {
 		if network.UID() == uid {
-			ns.mux.Lock()
 			ns.Networks[i] = updated
-			ns.mux.Unlock()
+			ns.events.Publish(event.New(event.Update, "network", ns.Node, uid, updated))
 			return nil
 		}
 	}
@@ -0,0 +1,105 @@
+package networkstore
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Neffats/wherecp/core"
+)
+
+type testPuller struct{}
+
+func (tp *testPuller) PullNetworks() ([]*core.Network, error) {
+	return make([]*core.Network, 0), nil
+}
+
+func TestUpdate(t *testing.T) {
+	net1, err := core.NewNetwork("net1", "10.0.0.0", "255.255.255.0", "net1")
+	if err != nil {
+		t.Fatalf("failed to create net1: %v", err)
+	}
+	testStore := &NetworkStore{
+		Networks: []*core.Network{net1},
+		Puller:   &testPuller{},
+	}
+
+	moved, err := net1.WithAddress("10.0.1.0", "255.255.255.0")
+	if err != nil {
+		t.Fatalf("failed to update network address: %v", err)
+	}
+	if err := testStore.Update(net1.UID(), moved.WithComment("moved")); err != nil {
+		t.Fatalf("failed to update network: %v", err)
+	}
+	got, err := testStore.Get(net1.UID())
+	if err != nil {
+		t.Fatalf("failed to get updated network: %v", err)
+	}
+	if got.CIDR() != "10.0.1.0/24" || got.Comment() != "moved" {
+		t.Errorf("want: 10.0.1.0/24 (moved)\ngot: %s (%s)", got.CIDR(), got.Comment())
+	}
+	if net1.CIDR() != "10.0.0.0/24" {
+		t.Errorf("original network was changed: %s", net1.CIDR())
+	}
+	if err := testStore.Update("missing", moved); !errors.Is(err, ErrNetworkNotFound) {
+		t.Errorf("Expected error: %v\nError received: %v", ErrNetworkNotFound, err)
+	}
+}
+
+// stepPuller returns the next set of networks on every pull.
+type stepPuller struct {
+	pulls [][]*core.Network
+}
+
+func (sp *stepPuller) PullNetworks() ([]*core.Network, error) {
+	networks := sp.pulls[0]
+	sp.pulls = sp.pulls[1:]
+	return networks, nil
+}
+
+func TestRefreshEvents(t *testing.T) {
+	network := func(name, addr string) *core.Network {
+		n, err := core.NewNetwork(name, addr, "255.255.255.0", "")
+		if err != nil {
+			t.Fatalf("failed to create network: %v", err)
+		}
+		return n
+	}
+	puller := &stepPuller{pulls: [][]*core.Network{
+		{network("kept", "10.0.0.0"), network("changed", "10.0.1.0"), network("removed", "10.0.2.0")},
+		{network("kept", "10.0.0.0"), network("changed", "10.0.9.0"), network("added", "10.0.3.0")},
+	}}
+	testStore := New(puller)
+	testStore.Node = "fw01"
+	if err := testStore.Init(); err != nil {
+		t.Fatalf("failed to init store: %v", err)
+	}
+
+	sub := testStore.Subscribe(10)
+	defer sub.Close()
+	if err := testStore.Init(); err != nil {
+		t.Fatalf("failed to refresh store: %v", err)
+	}
+	kept := testStore.All()[0]
+	if err := testStore.Update(kept.UID(), kept.WithComment("updated")); err != nil {
+		t.Fatalf("failed to update network: %v", err)
+	}
+	if err := testStore.Insert(network("inserted", "10.0.4.0")); err != nil {
+		t.Fatalf("failed to insert network: %v", err)
+	}
+
+	want := []string{"update changed", "insert added", "delete removed", "update kept", "insert inserted"}
+	for _, w := range want {
+		select {
+		case e := <-sub.C:
+			if got := fmt.Sprintf("%s %s", e.Op, e.Object.(*core.Network).Name()); got != w || e.Node != "fw01" || e.Kind != "network" {
+				t.Fatalf("want: network %s on fw01, got: %s %s on %s", w, e.Kind, got, e.Node)
+			}
+		default:
+			t.Fatalf("missing event: %s", w)
+		}
+	}
+	if len(sub.C) != 0 {
+		t.Fatalf("unexpected event: %+v", <-sub.C)
+	}
+}
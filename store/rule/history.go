@@ -0,0 +1,209 @@
+package rulestore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Neffats/wherecp/core"
+)
+
+var (
+	ErrNoSnapshot = errors.New("no snapshot at or before the given time")
+)
+
+// Snapshot is the rule base of a node as it was pulled at a point in time.
+// Snapshots are never changed once recorded.
+type Snapshot struct {
+	time  time.Time
+	rules []*core.Rule
+}
+
+// Time returns when the rules were pulled.
+func (s *Snapshot) Time() time.Time {
+	return s.time
+}
+
+// Rules returns a copy of the snapshot's rules in the order they were pulled.
+// The rules are shared with other snapshots and the store, so they mustn't be
+// modified; use the rule's With methods to make a changed copy.
+func (s *Snapshot) Rules() []*core.Rule {
+	r := make([]*core.Rule, len(s.rules))
+	copy(r, s.rules)
+	return r
+}
+
+// Record adds a snapshot of rules pulled at t to the store's history. Rules
+// that haven't changed since the latest earlier snapshot, down to the members
+// of their nested groups, are replaced by the rule from that snapshot, so
+// unchanged rules are only kept once. Of the rules that did change, the
+// source, destination and service groups that didn't are replaced by the
+// same group from that snapshot. Groups nested in a changed group aren't
+// shared. Rules and groups are matched up by UID, so stable UIDs (see the
+// Node field) should be used.
+//
+// If the history then has more than MaxSnapshots, the oldest are dropped.
+// Record doesn't change the store's current rules.
+func (rs *RuleStore) Record(t time.Time, rules []*core.Rule) (*Snapshot, error) {
+	rs.mux.Lock()
+	defer rs.mux.Unlock()
+
+	i := len(rs.history)
+	for i > 0 && rs.history[i-1].time.After(t) {
+		i--
+	}
+	previous := make(map[string]*core.Rule)
+	groups := newGroupIndex()
+	if i > 0 {
+		for _, r := range rs.history[i-1].rules {
+			previous[r.UID()] = r
+			groups.add(r)
+		}
+	}
+
+	snapshot := &Snapshot{time: t, rules: make([]*core.Rule, len(rules))}
+	for j, r := range rules {
+		snapshot.rules[j] = groups.intern(r)
+		old, ok := previous[r.UID()]
+		if !ok {
+			continue
+		}
+		same, err := sameRule(old, r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compare rule %s with the previous snapshot: %v", r.UID(), err)
+		}
+		if same {
+			snapshot.rules[j] = old
+		}
+	}
+
+	history := make([]*Snapshot, len(rs.history)+1)
+	copy(history[:i], rs.history[:i])
+	copy(history[i+1:], rs.history[i:])
+	history[i] = snapshot
+	if rs.MaxSnapshots > 0 && len(history) > rs.MaxSnapshots {
+		history = history[len(history)-rs.MaxSnapshots:]
+	}
+	rs.history = history
+	return snapshot, nil
+}
+
+// groupIndex holds the groups of a snapshot's rules by UID.
+type groupIndex struct {
+	groups     map[string]*core.Group
+	portGroups map[string]*core.PortGroup
+}
+
+func newGroupIndex() *groupIndex {
+	return &groupIndex{
+		groups:     make(map[string]*core.Group),
+		portGroups: make(map[string]*core.PortGroup),
+	}
+}
+
+func (gi *groupIndex) add(r *core.Rule) {
+	for _, g := range []*core.Group{r.Source(), r.Destination()} {
+		if g != nil {
+			gi.groups[g.UID()] = g
+		}
+	}
+	if r.Port() != nil {
+		gi.portGroups[r.Port().UID()] = r.Port()
+	}
+}
+
+// intern returns r with the source, destination and service groups that are
+// the same as those in the index replaced by them, r itself if there are
+// none.
+func (gi *groupIndex) intern(r *core.Rule) *core.Rule {
+	if g, ok := gi.groups[uid(r.Source())]; ok && g != r.Source() && sameGroup(g, r.Source()) {
+		r = r.WithSource(g)
+	}
+	if g, ok := gi.groups[uid(r.Destination())]; ok && g != r.Destination() && sameGroup(g, r.Destination()) {
+		r = r.WithDestination(g)
+	}
+	if pg := r.Port(); pg != nil {
+		if g, ok := gi.portGroups[pg.UID()]; ok && g != pg && samePortGroup(g, pg) {
+			r = r.WithPort(g)
+		}
+	}
+	return r
+}
+
+func uid(g *core.Group) string {
+	if g == nil {
+		return ""
+	}
+	return g.UID()
+}
+
+// sameRule returns true if both rules have the same content, including the
+// contents of every object they reference. The JSON encoding covers the
+// rule's own fields, but only refers to nested groups by UID, so the groups
+// are compared member by member and by the addresses and services they
+// flatten to as well.
+func sameRule(a, b *core.Rule) (bool, error) {
+	if a == b {
+		return true, nil
+	}
+	aJSON, err := json.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	bJSON, err := json.Marshal(b)
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(aJSON, bJSON) {
+		return false, nil
+	}
+	return sameGroup(a.Source(), b.Source()) &&
+		sameGroup(a.Destination(), b.Destination()) &&
+		samePortGroup(a.Port(), b.Port()), nil
+}
+
+func sameGroup(a, b *core.Group) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Match(b) && a.Flatten().String() == b.Flatten().String()
+}
+
+func samePortGroup(a, b *core.PortGroup) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Match(b) && a.Flatten().String() == b.Flatten().String()
+}
+
+// Snapshots returns every snapshot in the store's history, oldest first.
+func (rs *RuleStore) Snapshots() []*Snapshot {
+	rs.mux.RLock()
+	defer rs.mux.RUnlock()
+	s := make([]*Snapshot, len(rs.history))
+	copy(s, rs.history)
+	return s
+}
+
+// Snapshot returns the latest snapshot taken at or before t.
+func (rs *RuleStore) Snapshot(t time.Time) (*Snapshot, error) {
+	rs.mux.RLock()
+	defer rs.mux.RUnlock()
+	for i := len(rs.history) - 1; i >= 0; i-- {
+		if !rs.history[i].time.After(t) {
+			return rs.history[i], nil
+		}
+	}
+	return nil, fmt.Errorf("failed to find snapshot for %s: %w", t.Format(time.RFC3339), ErrNoSnapshot)
+}
+
+// AsOf returns the rules of the node as they were at t.
+func (rs *RuleStore) AsOf(t time.Time) ([]*core.Rule, error) {
+	s, err := rs.Snapshot(t)
+	if err != nil {
+		return nil, err
+	}
+	return s.Rules(), nil
+}
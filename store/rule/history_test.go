@@ -0,0 +1,177 @@
+package rulestore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Neffats/wherecp/core"
+	"github.com/Neffats/wherecp/event"
+)
+
+func TestRecord(t *testing.T) {
+	// pull returns the rules as a puller would, new objects every time.
+	pull := func(action bool) []*core.Rule {
+		host, err := core.NewHost("web", "10.0.0.1", "")
+		if err != nil {
+			t.Fatalf("failed to create host: %v", err)
+		}
+		dst := core.NewGroup("dst", "")
+		if err := dst.Add(host); err != nil {
+			t.Fatalf("failed to add host: %v", err)
+		}
+		rules := []*core.Rule{
+			core.NewNamedRule("web", 1, core.NewGroup("src", ""), dst, core.NewPortGroup("svc", ""), action, ""),
+			core.NewNamedRule("cleanup", 2, core.NewGroup("any", ""), core.NewGroup("any", ""), core.NewPortGroup("any", ""), false, ""),
+		}
+		for _, r := range rules {
+			r.Identify("fw01")
+		}
+		return rules
+	}
+
+	start := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	testStore := New(&testPuller{})
+	first, err := testStore.Record(start, pull(false))
+	if err != nil {
+		t.Fatalf("failed to record first snapshot: %v", err)
+	}
+	second, err := testStore.Record(start.Add(48*time.Hour), pull(true))
+	if err != nil {
+		t.Fatalf("failed to record second snapshot: %v", err)
+	}
+
+	if first.Rules()[1] != second.Rules()[1] {
+		t.Errorf("unchanged rule wasn't deduplicated")
+	}
+	if first.Rules()[0] == second.Rules()[0] || !second.Rules()[0].Action() {
+		t.Errorf("changed rule was replaced by its old version")
+	}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want *Snapshot
+		err  error
+	}{
+		{name: "Before history", at: start.Add(-time.Hour), err: ErrNoSnapshot},
+		{name: "At first pull", at: start, want: first},
+		{name: "Between pulls", at: start.Add(24 * time.Hour), want: first},
+		{name: "After last pull", at: start.Add(72 * time.Hour), want: second},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := testStore.Snapshot(tc.at)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("Expected error: %v\nError received: %v", tc.err, err)
+			}
+			if got != tc.want {
+				t.Fatalf("got the wrong snapshot: %v", got)
+			}
+		})
+	}
+}
+
+func TestRecordSharesGroups(t *testing.T) {
+	// pull returns a rule with new groups every time.
+	pull := func(comment string) []*core.Rule {
+		host, err := core.NewHost("web", "10.0.0.1", "")
+		if err != nil {
+			t.Fatalf("failed to create host: %v", err)
+		}
+		dst := core.NewGroup("dst", "")
+		if err := dst.Add(host); err != nil {
+			t.Fatalf("failed to add host: %v", err)
+		}
+		r := core.NewNamedRule("web", 1, core.NewGroup("src", ""), dst, core.NewPortGroup("svc", ""), true, comment)
+		r.Identify("fw01")
+		return []*core.Rule{r}
+	}
+
+	start := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	testStore := New(&testPuller{})
+	first, err := testStore.Record(start, pull("Change 1"))
+	if err != nil {
+		t.Fatalf("failed to record first snapshot: %v", err)
+	}
+	second, err := testStore.Record(start.Add(time.Hour), pull("Change 2"))
+	if err != nil {
+		t.Fatalf("failed to record second snapshot: %v", err)
+	}
+
+	before, after := first.Rules()[0], second.Rules()[0]
+	if before == after || after.Comment() != "Change 2" {
+		t.Fatalf("changed rule was replaced by its old version")
+	}
+	if after.Source() != before.Source() || after.Destination() != before.Destination() || after.Port() != before.Port() {
+		t.Errorf("unchanged groups of a changed rule weren't shared")
+	}
+}
+
+func TestRecordMaxSnapshots(t *testing.T) {
+	start := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	testStore := New(&testPuller{})
+	testStore.MaxSnapshots = 2
+	for i := 0; i < 3; i++ {
+		if _, err := testStore.Record(start.Add(time.Duration(i)*time.Hour), make([]*core.Rule, 0)); err != nil {
+			t.Fatalf("failed to record snapshot: %v", err)
+		}
+	}
+
+	snapshots := testStore.Snapshots()
+	if len(snapshots) != 2 || !snapshots[0].Time().Equal(start.Add(time.Hour)) {
+		t.Fatalf("expected the two latest snapshots, got: %d", len(snapshots))
+	}
+	if _, err := testStore.Snapshot(start); !errors.Is(err, ErrNoSnapshot) {
+		t.Fatalf("Expected error: %v\nError received: %v", ErrNoSnapshot, err)
+	}
+}
+
+func TestRecordNestedChange(t *testing.T) {
+	// pull returns a rule whose destination nests a group holding addr. The
+	// nested group keeps its UID, so only its members change.
+	pull := func(addr string) []*core.Rule {
+		host, err := core.NewHost("", addr, "")
+		if err != nil {
+			t.Fatalf("failed to create host: %v", err)
+		}
+		inner := core.NewGroup("inner", "")
+		if err := inner.Add(host); err != nil {
+			t.Fatalf("failed to add host: %v", err)
+		}
+		dst := core.NewGroup("dst", "")
+		if err := dst.Add(inner); err != nil {
+			t.Fatalf("failed to add nested group: %v", err)
+		}
+		return []*core.Rule{core.NewNamedRule("web", 1, core.NewGroup("src", ""), dst, core.NewPortGroup("svc", ""), true, "")}
+	}
+	puller := &stepPuller{pulls: [][]*core.Rule{pull("10.0.0.1"), pull("10.0.0.2")}}
+	testStore := New(puller)
+	testStore.Node = "fw01"
+	if err := testStore.Init(); err != nil {
+		t.Fatalf("failed to init store: %v", err)
+	}
+	before := testStore.All()[0]
+
+	sub := testStore.Subscribe(10)
+	defer sub.Close()
+	if err := testStore.Init(); err != nil {
+		t.Fatalf("failed to refresh store: %v", err)
+	}
+
+	after := testStore.All()[0]
+	if after == before || after.Destination().Groups()[0].UID() != before.Destination().Groups()[0].UID() {
+		t.Fatalf("expected a new rule with the same nested group UID")
+	}
+	if got := after.Destination().Flatten().String(); got != "10.0.0.2" {
+		t.Fatalf("store kept stale nested members: %s", got)
+	}
+	select {
+	case e := <-sub.C:
+		if e.Op != event.Update || e.UID != after.UID() {
+			t.Fatalf("want update of %s, got: %s %s", after.UID(), e.Op, e.UID)
+		}
+	default:
+		t.Fatalf("missing update event")
+	}
+}
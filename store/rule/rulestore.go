@@ -1,12 +1,16 @@
 package rulestore
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sort"
 	"sync"
+	"time"
 	
 	"github.com/Neffats/wherecp/core"
+	"github.com/Neffats/wherecp/event"
+	"github.com/Neffats/wherecp/store/internal/pulls"
 )
 
 var (
@@ -18,29 +22,126 @@ type RulePuller interface {
 	PullRules() ([]*core.Rule, error)
 }
 
+// RuleContextPuller is a RulePuller that gives up on a pull once ctx is done.
+// Refresh uses it when the store's Puller satisfies it.
+type RuleContextPuller interface {
+	PullRulesContext(ctx context.Context) ([]*core.Rule, error)
+}
+
 type RuleStore struct {
 	Rules []*core.Rule
 	Puller RulePuller
+	// Node names the firewall the rules are pulled from. Pulled rules and
+	// the objects they reference get stable UIDs from it unless it's empty.
+	Node string
+
+	// MaxSnapshots is the most snapshots kept in the history, the oldest
+	// being dropped first. Zero keeps every snapshot.
+	MaxSnapshots int
+
+	// Every pull of the rules, oldest first.
+	history []*Snapshot
+
+	pulls pulls.Group[[]*core.Rule]
 
+	events event.Broker
 	mux sync.RWMutex
 }
 
+// DefaultMaxSnapshots is the MaxSnapshots of stores made with New, a little
+// over a month of pulls every hour.
+const DefaultMaxSnapshots = 750
+
 func New(puller RulePuller) *RuleStore {
 	return &RuleStore{
 		Rules: make([]*core.Rule, 0),
 		Puller: puller,
+		MaxSnapshots: DefaultMaxSnapshots,
 	}
 }
 
+// Init pulls the rules from the source, replacing the ones in the store, and
+// records them as a new snapshot in the store's history.
 func (rs *RuleStore) Init() error {
-	rules, err := rs.Puller.PullRules()
+	return rs.Refresh(context.Background())
+}
+
+// Refresh pulls the rules from the source, records them as a new snapshot and
+// swaps them in for the ones in the store. Readers aren't blocked while
+// pulling. If ctx is done before the pull returns, the store is left as it was.
+// A Refresh that finds the pull of an earlier one still running waits on
+// that pull instead of starting another.
+func (rs *RuleStore) Refresh(ctx context.Context) error {
+	if err := rs.pulls.Do(ctx, rs.pull, rs.apply); err != nil {
+		return fmt.Errorf("failed to refresh rules: %w", err)
+	}
+	return nil
+}
+
+// apply swaps in the result of a pull.
+func (rs *RuleStore) apply(rules []*core.Rule) error {
+	if rs.Node != "" {
+		core.IdentifyRules(rs.Node, rules)
+	}
+	snapshot, err := rs.Record(time.Now(), rules)
 	if err != nil {
-		return fmt.Errorf("failed to pull rules from source: %v", err)
+		return fmt.Errorf("failed to record snapshot of pulled rules: %v", err)
 	}
-	rs.Rules = rules
+	rs.mux.Lock()
+	defer rs.mux.Unlock()
+	rs.events.Publish(rs.changes(rs.Rules, snapshot.rules)...)
+	rs.Rules = snapshot.Rules()
 	return nil
 }
 
+// pull pulls the rules from the source, giving up once ctx is done if the
+// Puller is a RuleContextPuller.
+func (rs *RuleStore) pull(ctx context.Context) ([]*core.Rule, error) {
+	var rules []*core.Rule
+	var err error
+	if cp, ok := rs.Puller.(RuleContextPuller); ok {
+		rules, err = cp.PullRulesContext(ctx)
+	} else {
+		rules, err = rs.Puller.PullRules()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull rules from source: %w", err)
+	}
+	return rules, nil
+}
+
+// changes returns an event for every rule that differs between old and new.
+// Record reuses unchanged rules, so rules that are the same are the same
+// pointer.
+func (rs *RuleStore) changes(old, new []*core.Rule) []event.Event {
+	result := make([]event.Event, 0)
+	previous := make(map[string]*core.Rule, len(old))
+	for _, r := range old {
+		previous[r.UID()] = r
+	}
+	for _, r := range new {
+		p, ok := previous[r.UID()]
+		delete(previous, r.UID())
+		switch {
+		case !ok:
+			result = append(result, event.New(event.Insert, "rule", rs.Node, r.UID(), r))
+		case p != r:
+			result = append(result, event.New(event.Update, "rule", rs.Node, r.UID(), r))
+		}
+	}
+	for _, r := range old {
+		if _, ok := previous[r.UID()]; ok {
+			result = append(result, event.New(event.Delete, "rule", rs.Node, r.UID(), r))
+		}
+	}
+	return result
+}
+
+// Subscribe returns a subscription to every change made to the store's rules.
+func (rs *RuleStore) Subscribe(buffer int) *event.Subscription {
+	return rs.events.Subscribe(buffer)
+}
+
 // All return all of the rules in the store. 
 func (rs *RuleStore) All() []*core.Rule {
 	rs.mux.RLock()
@@ -75,6 +176,7 @@ func (rs *RuleStore) Insert(rule *core.Rule) error {
 	rs.mux.Lock()
 	defer rs.mux.Unlock()
 	rs.Rules = newRules
+	rs.events.Publish(event.New(event.Insert, "rule", rs.Node, rule.UID(), rule))
 	return nil
 }
 
@@ -91,13 +193,12 @@ func (rs *RuleStore) Get(uid string) (*core.Rule, error) {
 }
 
 func (rs *RuleStore) Update(uid string, updated *core.Rule) error {
-	rs.mux.RLock()
-	defer rs.mux.RUnlock()
+	rs.mux.Lock()
+	defer rs.mux.Unlock()
 	for i, rule := range rs.Rules {
 		if rule.UID() == uid {
-			rs.mux.Lock()
 			rs.Rules[i] = updated
-			rs.mux.Unlock()
+			rs.events.Publish(event.New(event.Update, "rule", rs.Node, uid, updated))
 			return nil
 		}
 	}
@@ -105,16 +206,15 @@ func (rs *RuleStore) Update(uid string, updated *core.Rule) error {
 }
 
 func (rs *RuleStore) Delete(uid string) error {
-	//rs.mux.RLock()
-	//defer rs.mux.RUnlock()
+	rs.mux.Lock()
+	defer rs.mux.Unlock()
 	for i, rule := range rs.Rules {
 		if rule.UID() == uid {
-			rs.mux.Lock()
 			newRules := make([]*core.Rule, len(rs.Rules)-1)
 			copy(newRules[:i], rs.Rules[:i])
 			copy(newRules[i:], rs.Rules[i+1:])
 			rs.Rules = newRules
-			rs.mux.Unlock()
+			rs.events.Publish(event.New(event.Delete, "rule", rs.Node, uid, rule))
 			return nil
 		}
 	}
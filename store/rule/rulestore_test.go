@@ -1,9 +1,13 @@
 package rulestore
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/Neffats/wherecp/core"
 )
@@ -323,3 +327,173 @@ func TestDelete(t *testing.T) {
 	}
 	
 }
+
+// blockingPuller doesn't return from a pull until release is closed.
+type blockingPuller struct {
+	release chan struct{}
+
+	mux   sync.Mutex
+	pulls int
+}
+
+func (bp *blockingPuller) PullRules() ([]*core.Rule, error) {
+	bp.mux.Lock()
+	bp.pulls++
+	bp.mux.Unlock()
+	<-bp.release
+	rule := core.NewRule(1, core.NewGroup("src", ""), core.NewGroup("dst", ""), core.NewPortGroup("svc", ""), true, "")
+	return []*core.Rule{rule}, nil
+}
+
+func (bp *blockingPuller) count() int {
+	bp.mux.Lock()
+	defer bp.mux.Unlock()
+	return bp.pulls
+}
+
+// contextPuller blocks until ctx is done, closing returned once it is.
+type contextPuller struct {
+	testPuller
+	returned chan struct{}
+}
+
+func (cp *contextPuller) PullRulesContext(ctx context.Context) ([]*core.Rule, error) {
+	defer close(cp.returned)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestRefreshPending(t *testing.T) {
+	puller := &blockingPuller{release: make(chan struct{})}
+	store := New(puller)
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		err := store.Refresh(ctx)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected refresh %d to time out, got: %v", i, err)
+		}
+	}
+	if got := puller.count(); got != 1 {
+		t.Fatalf("expected a single pull while it hangs, got: %d", got)
+	}
+
+	close(puller.release)
+	if err := store.Refresh(context.Background()); err != nil {
+		t.Fatalf("failed to refresh: %v", err)
+	}
+	if got := len(store.All()); got != 1 {
+		t.Fatalf("expected the pulled rule in the store, got: %d rules", got)
+	}
+}
+
+func TestRefreshContextPuller(t *testing.T) {
+	puller := &contextPuller{returned: make(chan struct{})}
+	store := New(puller)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := store.Refresh(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected refresh to time out, got: %v", err)
+	}
+	select {
+	case <-puller.returned:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the pull to return once ctx is done")
+	}
+}
+
+// releasePuller is a blockingPuller that also gives up once ctx is done.
+type releasePuller struct {
+	blockingPuller
+}
+
+func (rp *releasePuller) PullRulesContext(ctx context.Context) ([]*core.Rule, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-rp.release:
+	}
+	return rp.PullRules()
+}
+
+func TestRefreshOverlapping(t *testing.T) {
+	puller := &releasePuller{blockingPuller{release: make(chan struct{})}}
+	store := New(puller)
+
+	// The scheduler's refresh times out while RefreshNow's is still waiting
+	// on the same pull.
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		first <- store.Refresh(ctx)
+	}()
+	second := make(chan error, 1)
+	go func() {
+		second <- store.Refresh(context.Background())
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected first refresh to be cancelled, got: %v", err)
+	}
+	close(puller.release)
+	if err := <-second; err != nil {
+		t.Fatalf("second refresh failed: %v", err)
+	}
+	if got := len(store.All()); got != 1 {
+		t.Fatalf("expected the pulled rule in the store, got: %d rules", got)
+	}
+}
+
+// stepPuller returns the next set of rules on every pull.
+type stepPuller struct {
+	pulls [][]*core.Rule
+}
+
+func (sp *stepPuller) PullRules() ([]*core.Rule, error) {
+	rules := sp.pulls[0]
+	sp.pulls = sp.pulls[1:]
+	return rules, nil
+}
+
+func TestRefreshEvents(t *testing.T) {
+	rule := func(name string, action bool) *core.Rule {
+		return core.NewNamedRule(name, 1, core.NewGroup("src", ""), core.NewGroup("dst", ""), core.NewPortGroup("svc", ""), action, "")
+	}
+	puller := &stepPuller{pulls: [][]*core.Rule{
+		{rule("kept", true), rule("changed", true), rule("removed", true)},
+		{rule("kept", true), rule("changed", false), rule("added", true)},
+	}}
+	testStore := New(puller)
+	testStore.Node = "fw01"
+	if err := testStore.Init(); err != nil {
+		t.Fatalf("failed to init store: %v", err)
+	}
+
+	sub := testStore.Subscribe(10)
+	defer sub.Close()
+	if err := testStore.Init(); err != nil {
+		t.Fatalf("failed to refresh store: %v", err)
+	}
+	if err := testStore.Delete(core.StableUID("fw01", "rule", "kept", "")); err != nil {
+		t.Fatalf("failed to delete rule: %v", err)
+	}
+
+	want := []string{"update changed", "insert added", "delete removed", "delete kept"}
+	for _, w := range want {
+		select {
+		case e := <-sub.C:
+			if got := fmt.Sprintf("%s %s", e.Op, e.Object.(*core.Rule).Name()); got != w || e.Node != "fw01" {
+				t.Fatalf("want: %s on fw01, got: %s on %s", w, got, e.Node)
+			}
+		default:
+			t.Fatalf("missing event: %s", w)
+		}
+	}
+	if len(sub.C) != 0 {
+		t.Fatalf("unexpected event: %+v", <-sub.C)
+	}
+}
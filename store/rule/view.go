@@ -0,0 +1,122 @@
+package rulestore
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Neffats/wherecp/core"
+)
+
+// View is a copy-on-write view of a RuleStore. Changes made through the view
+// are kept in the view and never reach the underlying store, which makes it
+// safe to try out changes to a policy without committing them.
+type View struct {
+	base     *RuleStore
+	inserted []*core.Rule
+	updated  map[string]*core.Rule
+	deleted  map[string]bool
+
+	mux sync.RWMutex
+}
+
+// View returns a new copy-on-write view of the store.
+func (rs *RuleStore) View() *View {
+	return &View{
+		base:     rs,
+		inserted: make([]*core.Rule, 0),
+		updated:  make(map[string]*core.Rule),
+		deleted:  make(map[string]bool),
+	}
+}
+
+// All returns every rule in the store as seen through the view.
+func (v *View) All() []*core.Rule {
+	v.mux.RLock()
+	defer v.mux.RUnlock()
+	result := make([]*core.Rule, 0)
+	for _, r := range v.base.All() {
+		if v.deleted[r.UID()] {
+			continue
+		}
+		if updated, ok := v.updated[r.UID()]; ok {
+			r = updated
+		}
+		result = append(result, r)
+	}
+	result = append(result, v.inserted...)
+	return result
+}
+
+func (v *View) Insert(rule *core.Rule) error {
+	_, err := v.Get(rule.UID())
+	if err == nil {
+		return fmt.Errorf("rule is already in store")
+	}
+	if !errors.Is(err, ErrRuleNotFound) {
+		return fmt.Errorf("failed to determine whether rule is already present: %v", err)
+	}
+
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	// A rule that was deleted from the view can be inserted again.
+	delete(v.deleted, rule.UID())
+	if _, err := v.base.Get(rule.UID()); err == nil {
+		v.updated[rule.UID()] = rule
+		return nil
+	}
+	v.inserted = append(v.inserted, rule)
+	return nil
+}
+
+func (v *View) Get(uid string) (*core.Rule, error) {
+	v.mux.RLock()
+	defer v.mux.RUnlock()
+	if v.deleted[uid] {
+		return nil, ErrRuleNotFound
+	}
+	if r, ok := v.updated[uid]; ok {
+		return r, nil
+	}
+	for _, r := range v.inserted {
+		if r.UID() == uid {
+			return r, nil
+		}
+	}
+	return v.base.Get(uid)
+}
+
+func (v *View) Update(uid string, updated *core.Rule) error {
+	if _, err := v.Get(uid); err != nil {
+		return err
+	}
+
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	for i, r := range v.inserted {
+		if r.UID() == uid {
+			v.inserted[i] = updated
+			return nil
+		}
+	}
+	v.updated[uid] = updated
+	return nil
+}
+
+func (v *View) Delete(uid string) error {
+	if _, err := v.Get(uid); err != nil {
+		return err
+	}
+
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	for i, r := range v.inserted {
+		if r.UID() == uid {
+			v.inserted = append(v.inserted[:i], v.inserted[i+1:]...)
+			return nil
+		}
+	}
+	delete(v.updated, uid)
+	v.deleted[uid] = true
+	return nil
+}
@@ -0,0 +1,68 @@
+package rulestore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Neffats/wherecp/core"
+)
+
+func TestView(t *testing.T) {
+	src := core.NewGroup("src", "src")
+	dst := core.NewGroup("dst", "dst")
+	svc := core.NewPortGroup("svc", "svc")
+
+	rule1 := core.NewRule(1, src, dst, svc, true, "")
+	rule2 := core.NewRule(2, dst, src, svc, true, "")
+	rule3 := core.NewRule(3, src, src, svc, false, "")
+
+	testStore := &RuleStore{
+		Rules:  []*core.Rule{rule1, rule2},
+		Puller: &testPuller{},
+	}
+	view := testStore.View()
+
+	if err := view.Insert(rule3); err != nil {
+		t.Fatalf("failed to insert rule into view: %v", err)
+	}
+	if err := view.Delete(rule1.UID()); err != nil {
+		t.Fatalf("failed to delete rule from view: %v", err)
+	}
+	updated := core.NewRule(2, src, dst, svc, false, "updated")
+	if err := view.Update(rule2.UID(), updated); err != nil {
+		t.Fatalf("failed to update rule in view: %v", err)
+	}
+
+	t.Run("View sees changes", func(t *testing.T) {
+		got := view.All()
+		if len(got) != 2 || got[0] != updated || got[1] != rule3 {
+			t.Fatalf("unexpected rules in view: %+v", got)
+		}
+		if _, err := view.Get(rule1.UID()); !errors.Is(err, ErrRuleNotFound) {
+			t.Fatalf("expected deleted rule to be missing from view, got: %v", err)
+		}
+	})
+
+	t.Run("Store is untouched", func(t *testing.T) {
+		got := testStore.All()
+		if len(got) != 2 || got[0] != rule1 || got[1] != rule2 {
+			t.Fatalf("underlying store was modified: %+v", got)
+		}
+	})
+
+	t.Run("Present rule can't be inserted", func(t *testing.T) {
+		err := view.Insert(rule3)
+		if err == nil || err.Error() != "rule is already in store" {
+			t.Fatalf("expected rule is already in store, got: %v", err)
+		}
+	})
+
+	t.Run("Deleted rule can be restored", func(t *testing.T) {
+		if err := view.Insert(rule1); err != nil {
+			t.Fatalf("failed to insert deleted rule: %v", err)
+		}
+		if _, err := view.Get(rule1.UID()); err != nil {
+			t.Fatalf("expected restored rule to be in view: %v", err)
+		}
+	})
+}